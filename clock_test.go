@@ -0,0 +1,206 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock is a clock that only advances when sleeping,
+// and records the duration of each sleep.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	return nil
+}
+
+func TestFindFakeClock(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	t.Run("retries", func(t *testing.T) {
+		clock := newFakeClock()
+		err := Find(WithClock(clock), MaxRetries(3), RetryJitter(0))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "after 4 attempts over 0s")
+		assert.Equal(t, []time.Duration{time.Microsecond, 2 * time.Microsecond, 4 * time.Microsecond}, clock.sleeps)
+	})
+
+	t.Run("max sleep", func(t *testing.T) {
+		clock := newFakeClock()
+		require.Error(t, Find(WithClock(clock), MaxRetries(4), MaxSleep(3*time.Microsecond), RetryJitter(0)))
+		assert.Equal(t, []time.Duration{
+			time.Microsecond, 2 * time.Microsecond, 3 * time.Microsecond, 3 * time.Microsecond,
+		}, clock.sleeps)
+	})
+
+	t.Run("total budget", func(t *testing.T) {
+		clock := newFakeClock()
+		err := Find(WithClock(clock), TotalBudget(5*time.Microsecond), RetryJitter(0))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "after 4 attempts")
+		assert.Equal(t, []time.Duration{time.Microsecond, 2 * time.Microsecond, 2 * time.Microsecond}, clock.sleeps,
+			"The last sleep should be capped by the budget")
+	})
+
+	t.Run("resample", func(t *testing.T) {
+		clock := newFakeClock()
+		err := Find(WithClock(clock), MaxRetries(0), Resample(time.Hour))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "unchanged after 1h0m0s")
+		assert.Equal(t, []time.Duration{time.Hour}, clock.sleeps)
+	})
+}
+
+func TestFindCleanChecksFakeClock(t *testing.T) {
+	// The fake clock doesn't wait for goroutines from earlier tests to exit.
+	require.NoError(t, Find(), "Expected no leaks before the test")
+
+	t.Run("clean", func(t *testing.T) {
+		clock := newFakeClock()
+		require.NoError(t, Find(WithClock(clock), RequireCleanChecks(3, time.Second)))
+		assert.Equal(t, []time.Duration{time.Second, time.Second}, clock.sleeps)
+	})
+
+	t.Run("total budget", func(t *testing.T) {
+		clock := newFakeClock()
+		require.NoError(t, Find(WithClock(clock), RequireCleanChecks(10, time.Second), TotalBudget(1500*time.Millisecond)))
+		assert.Equal(t, []time.Duration{time.Second, 500 * time.Millisecond}, clock.sleeps,
+			"Clean checks should stop once the budget is used up")
+	})
+
+	t.Run("leak after clean check", func(t *testing.T) {
+		var bg *blockedG
+		clock := &hookClock{fakeClock: newFakeClock(), onSleep: func() {
+			if bg == nil {
+				bg = startBlockedG()
+			}
+		}}
+		defer func() { bg.unblock() }()
+
+		err := Find(WithClock(clock), RequireCleanChecks(3, time.Second), MaxRetries(2), RetryJitter(0))
+		require.Error(t, err, "Should find goroutine started after the first clean check")
+		assert.Contains(t, err.Error(), "blockedG")
+		assert.Equal(t, []time.Duration{time.Second, time.Microsecond, 2 * time.Microsecond}, clock.sleeps)
+	})
+}
+
+// hookClock is a fakeClock that calls onSleep after each sleep.
+type hookClock struct {
+	*fakeClock
+	onSleep func()
+}
+
+func (c *hookClock) Sleep(ctx context.Context, d time.Duration) error {
+	err := c.fakeClock.Sleep(ctx, d)
+	c.onSleep()
+	return err
+}
+
+func TestFindContextFakeClock(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	t.Run("retries", func(t *testing.T) {
+		clock := newFakeClock()
+		err := FindContext(context.Background(), WithClock(clock), MaxRetries(3), RetryJitter(0))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "after 4 attempts")
+		assert.Len(t, clock.sleeps, 3)
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		clock := newFakeClock()
+		err := FindContext(ctx, WithClock(clock), MaxRetries(3), Resample(time.Hour))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "after 1 attempt over")
+		assert.NotContains(t, err.Error(), "after 1h0m0s", "Should not resample once cancelled")
+		assert.Empty(t, clock.sleeps, "Should not sleep once cancelled")
+	})
+}
+
+func TestRealClockSleep(t *testing.T) {
+	require.NoError(t, realClock{}.Sleep(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.Equal(t, context.DeadlineExceeded, realClock{}.Sleep(ctx, time.Hour))
+	assert.Less(t, time.Since(start), time.Minute, "Sleep should stop once the context is done")
+}
+
+func TestWaitForStoppedFakeClock(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	clock := newFakeClock()
+	err := waitForStopped(clock, "go.uber.org/goleak.(*blockedG).run", 250*time.Millisecond)
+	require.Error(t, err, "blockedG should not stop")
+
+	var total time.Duration
+	for _, d := range clock.sleeps {
+		total += d
+	}
+	assert.Equal(t, 250*time.Millisecond, total, "Should sleep until the timeout")
+}
+
+// errClock is a fakeClock whose Sleep fails.
+type errClock struct {
+	*fakeClock
+
+	err error
+}
+
+func (c errClock) Sleep(ctx context.Context, d time.Duration) error {
+	return c.err
+}
+
+func TestWaitForStoppedSleepError(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	sleepErr := errors.New("sleep failed")
+	err := waitForStopped(errClock{newFakeClock(), sleepErr}, "go.uber.org/goleak.(*blockedG).run", time.Second)
+	assert.Equal(t, sleepErr, err, "Expected the error from Sleep")
+}
@@ -0,0 +1,253 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// goleak reports suspected goroutine leaks in a goroutine dump, such as
+// a traceback printed on SIGQUIT or the output of the goroutine profile
+// with debug=2, using the same rules as goleak.Find.
+//
+// Usage:
+//
+//	goleak [flags] [file]
+//
+// The dump is read from the file, or from stdin if no file is given.
+// Goroutines that are ignored by default in tests and the runtime's
+// background goroutines are not reported, and other goroutines can be
+// ignored using the flags, which can be repeated:
+//
+//	goleak -ignore-top net/http.(*persistConn).readLoop dump.txt
+//
+// Goroutines with the same stack are reported once, along with their count
+// and IDs, unless -group-by=none is set. The report is colorized if stdout
+// is a terminal, which can be changed using -color.
+//
+// goleak exits with status 1 if any goroutines are reported,
+// and 2 if the dump could not be read or parsed.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.uber.org/goleak"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// stringsFlag is a flag that can be repeated to collect multiple values.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
+
+// groupByFlag is a flag that selects a goleak.Grouping by name.
+type groupByFlag goleak.Grouping
+
+var _groupings = map[string]goleak.Grouping{
+	"none":       goleak.GroupByNone,
+	"signature":  goleak.GroupBySignature,
+	"created-by": goleak.GroupByCreatedBy,
+}
+
+func (f *groupByFlag) String() string {
+	for name, g := range _groupings {
+		if g == goleak.Grouping(*f) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f *groupByFlag) Set(v string) error {
+	g, ok := _groupings[v]
+	if !ok {
+		return errors.New(`must be one of "none", "signature" or "created-by"`)
+	}
+	*f = groupByFlag(g)
+	return nil
+}
+
+// colorFlag is a flag that selects a goleak.ColorMode by name.
+type colorFlag goleak.ColorMode
+
+var _colorModes = map[string]goleak.ColorMode{
+	"never":  goleak.ColorNever,
+	"auto":   goleak.ColorAuto,
+	"always": goleak.ColorAlways,
+}
+
+func (f *colorFlag) String() string {
+	for name, m := range _colorModes {
+		if m == goleak.ColorMode(*f) {
+			return name
+		}
+	}
+	return ""
+}
+
+func (f *colorFlag) Set(v string) error {
+	m, ok := _colorModes[v]
+	if !ok {
+		return errors.New(`must be one of "never", "auto" or "always"`)
+	}
+	*f = colorFlag(m)
+	return nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var (
+		ignoreTop       stringsFlag
+		ignoreAny       stringsFlag
+		ignoreCreatedBy stringsFlag
+		ignorePackage   stringsFlag
+		ignoreRegex     stringsFlag
+		ignoreStates    stringsFlag
+		onlyStates      stringsFlag
+	)
+	flags := flag.NewFlagSet("goleak", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprintln(stderr, "usage: goleak [flags] [file]")
+		flags.PrintDefaults()
+	}
+	flags.Var(&ignoreTop, "ignore-top", "ignore goroutines with this `function` at the top of the stack")
+	flags.Var(&ignoreAny, "ignore-any", "ignore goroutines with this `function` anywhere on the stack")
+	flags.Var(&ignoreCreatedBy, "ignore-created-by", "ignore goroutines created by this `function`")
+	flags.Var(&ignorePackage, "ignore-package-prefix", "ignore goroutines in packages with this import path `prefix`")
+	flags.Var(&ignoreRegex, "ignore-regex", "ignore goroutines with a stack matching this regular `expression`")
+	flags.Var(&ignoreStates, "ignore-state", "ignore goroutines in this `state`, e.g., select")
+	flags.Var(&onlyStates, "only-state", "only consider goroutines in this `state`, e.g., chan receive")
+	groupBy := groupByFlag(goleak.GroupBySignature)
+	flags.Var(&groupBy, "group-by", "collapse goroutines by `grouping`: none, signature or created-by")
+	minBlocked := flags.Duration("min-blocked", 0, "ignore goroutines blocked for less than this `duration`")
+	maxFrames := flags.Int("max-frames", 0, "limit each stack to the top `n` frames, if n > 0")
+	sortByWait := flags.Bool("sort-by-wait", false, "report the goroutines that have been blocked the longest first")
+	suggest := flags.Bool("suggest", false, "suggest goleak options to ignore the reported goroutines")
+	color := colorFlag(goleak.ColorAuto)
+	flags.Var(&color, "color", "colorize the report: never, auto (if stdout is a terminal) or always")
+	htmlPath := flags.String("html", "", "also write an HTML report to the `file`")
+	includeRuntime := flags.Bool("include-runtime", false, "report goroutines that only have runtime frames, such as GC workers")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return 2
+	}
+
+	opts := []goleak.Option{goleak.GroupBy(goleak.Grouping(groupBy))}
+	for _, f := range ignoreTop {
+		opts = append(opts, goleak.IgnoreTopFunction(f))
+	}
+	for _, f := range ignoreAny {
+		opts = append(opts, goleak.IgnoreAnyFunction(f))
+	}
+	for _, f := range ignoreCreatedBy {
+		opts = append(opts, goleak.IgnoreCreatedBy(f))
+	}
+	if len(ignorePackage) > 0 {
+		opts = append(opts, goleak.IgnorePackagePrefix(ignorePackage...))
+	}
+	for _, re := range ignoreRegex {
+		// IgnoreStackRegex panics on invalid expressions.
+		if _, err := regexp.Compile(re); err != nil {
+			fmt.Fprintf(stderr, "goleak: invalid -ignore-regex: %v\n", err)
+			return 2
+		}
+		opts = append(opts, goleak.IgnoreStackRegex(re))
+	}
+	if len(ignoreStates) > 0 {
+		opts = append(opts, goleak.IgnoreStates(ignoreStates...))
+	}
+	if len(onlyStates) > 0 {
+		opts = append(opts, goleak.OnlyStates(onlyStates...))
+	}
+	if *minBlocked > 0 {
+		opts = append(opts, goleak.MinBlockedDuration(*minBlocked))
+	}
+	if !*includeRuntime {
+		opts = append(opts, goleak.IgnoreRuntimeInternal())
+	}
+	if *maxFrames > 0 {
+		opts = append(opts, goleak.MaxFrames(*maxFrames))
+	}
+	if *sortByWait {
+		opts = append(opts, goleak.SortByWaitDuration())
+	}
+	if *suggest {
+		opts = append(opts, goleak.SuggestIgnores())
+	}
+	if mode := goleak.ColorMode(color); mode == goleak.ColorAlways || (mode == goleak.ColorAuto && goleak.UseColor(stdout)) {
+		opts = append(opts, goleak.Colorize(goleak.ColorAlways))
+	}
+
+	r := stdin
+	if name := flags.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(stderr, "goleak: %v\n", err)
+			return 2
+		}
+		defer f.Close()
+		r = f
+	}
+
+	report, err := goleak.Analyze(r, opts...)
+	if err != nil {
+		fmt.Fprintf(stderr, "goleak: %v\n", err)
+		return 2
+	}
+	if *htmlPath != "" {
+		if err := writeHTML(*htmlPath, report); err != nil {
+			fmt.Fprintf(stderr, "goleak: failed to write HTML report: %v\n", err)
+			return 2
+		}
+	}
+	if len(report.Stacks()) == 0 {
+		return 0
+	}
+	fmt.Fprintln(stdout, report)
+	return 1
+}
+
+// writeHTML writes the HTML page for the given report to the file at path.
+func writeHTML(path string, report *goleak.Report) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := report.WriteHTML(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
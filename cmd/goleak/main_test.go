@@ -0,0 +1,250 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+const _dump = `panic: something went wrong
+
+goroutine 1 [running]:
+main.main()
+	/path/to/main.go:10 +0x1f
+
+goroutine 6 [chan receive, 3 minutes]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+
+goroutine 7 [chan receive, 3 minutes]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+
+goroutine 8 [select]:
+main.ticker()
+	/path/to/main.go:30 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:8 +0x6
+
+goroutine 3 [GC sweep wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:424 +0xce
+runtime.bgsweep(0xc000040070)
+	/usr/local/go/src/runtime/mgcsweep.go:317 +0xdf
+runtime.gcenable.gowrap1()
+	/usr/local/go/src/runtime/mgc.go:203 +0x17
+created by runtime.gcenable in goroutine 1
+	/usr/local/go/src/runtime/mgc.go:203 +0x66
+exit status 2
+`
+
+func TestRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dump.txt")
+	require.NoError(t, os.WriteFile(path, []byte(_dump), 0o644))
+
+	tests := []struct {
+		msg        string
+		args       []string
+		stdin      string
+		wantCode   int
+		wantOut    []string
+		wantNotOut []string
+		wantErr    string
+	}{
+		{
+			msg:        "stdin",
+			stdin:      _dump,
+			wantCode:   1,
+			wantOut:    []string{"Goroutine 1 ", "2 goroutines with the same stack (IDs: 6, 7)", "Goroutine 8 "},
+			wantNotOut: []string{"Goroutine 3 ", "exit status"},
+		},
+		{
+			msg:      "file",
+			args:     []string{path},
+			wantCode: 1,
+			wantOut:  []string{"Goroutine 1 ", "Goroutine 6 "},
+		},
+		{
+			msg:      "include runtime",
+			args:     []string{"-include-runtime", path},
+			wantCode: 1,
+			wantOut:  []string{"Goroutine 3 "},
+		},
+		{
+			msg: "ignored",
+			args: []string{
+				"-ignore-top", "main.main",
+				"-ignore-created-by", "main.main",
+				path,
+			},
+			wantCode: 0,
+		},
+		{
+			msg:        "repeated flags",
+			args:       []string{"-ignore-top", "main.main", "-ignore-top", "main.worker", "-ignore-state", "select", path},
+			wantCode:   0,
+			wantNotOut: []string{"Goroutine"},
+		},
+		{
+			msg:      "color",
+			args:     []string{"-color", "always", path},
+			wantCode: 1,
+			wantOut:  []string{"in state \x1b[33mselect\x1b[0m,"},
+		},
+		{
+			msg:        "no color",
+			args:       []string{"-color", "auto", path},
+			wantCode:   1,
+			wantNotOut: []string{"\x1b["},
+		},
+		{
+			msg:      "invalid color",
+			args:     []string{"-color", "sometimes", path},
+			wantCode: 2,
+			wantErr:  `must be one of "never", "auto" or "always"`,
+		},
+		{
+			msg:        "only state",
+			args:       []string{"-only-state", "chan receive", path},
+			wantCode:   1,
+			wantOut:    []string{"IDs: 6, 7"},
+			wantNotOut: []string{"Goroutine 1 ", "Goroutine 8 "},
+		},
+		{
+			msg:        "ignore regex",
+			args:       []string{"-ignore-regex", `main\.(main|ticker)\(`, path},
+			wantCode:   1,
+			wantOut:    []string{"IDs: 6, 7"},
+			wantNotOut: []string{"Goroutine 1 ", "Goroutine 8 "},
+		},
+		{
+			msg:        "not grouped",
+			args:       []string{"-group-by", "none", "-ignore-any", "main.main", "-ignore-any", "main.ticker", path},
+			wantCode:   1,
+			wantOut:    []string{"Goroutine 6 ", "Goroutine 7 "},
+			wantNotOut: []string{"goroutines with the same stack", "Goroutine 8 "},
+		},
+		{
+			msg:      "grouped by creator",
+			args:     []string{"-group-by", "created-by", path},
+			wantCode: 1,
+			wantOut:  []string{"3 goroutines created by main.main (IDs: 6, 7, 8)"},
+		},
+		{
+			msg:      "suggest",
+			args:     []string{"-suggest", "-ignore-top", "main.main", path},
+			wantCode: 1,
+			wantOut: []string{
+				"suggested options to ignore these goroutines:\n" +
+					"\tgoleak.IgnoreTopFunction(\"main.worker\"), // or\n" +
+					"\tgoleak.IgnoreCreatedBy(\"main.main\"),\n" +
+					"\tgoleak.IgnoreTopFunction(\"main.ticker\"), // or\n" +
+					"\tgoleak.IgnoreCreatedBy(\"main.main\"),\n",
+			},
+		},
+		{
+			msg:      "invalid grouping",
+			args:     []string{"-group-by", "state", path},
+			wantCode: 2,
+			wantErr:  `invalid value "state" for flag -group-by`,
+		},
+		{
+			msg:      "invalid regex",
+			args:     []string{"-ignore-regex", "(", path},
+			wantCode: 2,
+			wantErr:  "goleak: invalid -ignore-regex",
+		},
+		{
+			msg:      "too many files",
+			args:     []string{path, path},
+			wantCode: 2,
+			wantErr:  "usage: goleak",
+		},
+		{
+			msg:      "missing file",
+			args:     []string{filepath.Join(t.TempDir(), "missing.txt")},
+			wantCode: 2,
+			wantErr:  "missing.txt",
+		},
+		{
+			msg:      "invalid dump",
+			stdin:    "goroutine x [running]:\nmain.main()\n",
+			wantCode: 2,
+			wantErr:  "failed to parse goroutine stacks",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(tt.args, strings.NewReader(tt.stdin), &stdout, &stderr)
+			assert.Equal(t, tt.wantCode, code, "Unexpected exit code, stderr: %v", stderr.String())
+			for _, want := range tt.wantOut {
+				assert.Contains(t, stdout.String(), want)
+			}
+			for _, notWant := range tt.wantNotOut {
+				assert.NotContains(t, stdout.String(), notWant)
+			}
+			if tt.wantErr != "" {
+				assert.Contains(t, stderr.String(), tt.wantErr)
+			} else {
+				assert.Empty(t, stderr.String())
+			}
+			if tt.wantCode == 0 {
+				assert.Empty(t, stdout.String(), "Expect no output without leaks")
+			}
+		})
+	}
+}
+
+func TestRunHTML(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "dump.txt")
+	require.NoError(t, os.WriteFile(path, []byte(_dump), 0o644))
+
+	htmlPath := filepath.Join(dir, "report.html")
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run([]string{"-html", htmlPath, path}, nil, &stdout, &stderr))
+	b, err := os.ReadFile(htmlPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(b), "<title>goleak: 4 unexpected goroutines</title>")
+	assert.Contains(t, stdout.String(), "Goroutine 1 ", "Report should still be printed")
+
+	stderr.Reset()
+	assert.Equal(t, 2, run([]string{"-html", filepath.Join(dir, "missing", "report.html"), path}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "goleak: failed to write HTML report")
+}
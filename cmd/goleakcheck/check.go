@@ -0,0 +1,200 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"flag"
+	"go/ast"
+	"go/types"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+const _goleakImportPath = "go.uber.org/goleak"
+
+// _checkFuncs are the goleak functions that check for leaks.
+var _checkFuncs = map[string]bool{
+	"VerifyTestMain":    true,
+	"VerifyNone":        true,
+	"VerifyNoneContext": true,
+	"VerifyNoneB":       true,
+	"VerifyNoNewLeaks":  true,
+	"Check":             true,
+	"Track":             true,
+	"NewFuzzChecker":    true,
+}
+
+// _message describes the problem reported for packages with tests that
+// don't check for leaks.
+const _message = "tests don't check for goroutine leaks using goleak.VerifyTestMain or goleak.VerifyNone"
+
+// checksLeaks is the fact exported for packages whose tests check for leaks,
+// so that the external tests of the package are considered checked.
+type checksLeaks struct {
+	// Func is the goleak function used to check for leaks.
+	Func string
+}
+
+func (*checksLeaks) AFact() {}
+
+func (f *checksLeaks) String() string {
+	return "checksLeaks(" + f.Func + ")"
+}
+
+// newAnalyzer returns the analyzer that reports test packages that don't
+// check for leaks.
+func newAnalyzer() *analysis.Analyzer {
+	var exempt string
+	a := &analysis.Analyzer{
+		Name:      "goleakcheck",
+		Doc:       "report test packages that don't check for goroutine leaks using goleak",
+		Flags:     *flag.NewFlagSet("goleakcheck", flag.ExitOnError),
+		FactTypes: []analysis.Fact{new(checksLeaks)},
+		Run: func(pass *analysis.Pass) (interface{}, error) {
+			return nil, checkPackage(pass, exempt)
+		},
+	}
+	a.Flags.StringVar(&exempt, "exempt", "", "comma-separated import `paths` of packages that don't need to check for leaks")
+	return a
+}
+
+// checkPackage reports the package being analyzed if it has tests that don't
+// check for leaks, and isn't in the comma-separated list of exempt packages.
+func checkPackage(pass *analysis.Pass, exempt string) error {
+	var (
+		tests    []*ast.File
+		hasTests bool
+	)
+	for _, f := range pass.Files {
+		if strings.HasSuffix(pass.Fset.File(f.Pos()).Name(), "_test.go") {
+			tests = append(tests, f)
+			hasTests = hasTests || declaresTests(f)
+		}
+	}
+
+	if fn := checkFunc(pass, tests); fn != "" {
+		pass.ExportPackageFact(&checksLeaks{Func: fn})
+		return nil
+	}
+	if !hasTests || isExempt(pass.Pkg.Path(), exempt) || checkedByPackage(pass) {
+		return nil
+	}
+	pass.Reportf(tests[0].Package, _message)
+	return nil
+}
+
+// checkedByPackage reports whether the package being analyzed is an external
+// test package, and the tests of the package it tests check for leaks.
+func checkedByPackage(pass *analysis.Pass) bool {
+	path := strings.TrimSuffix(pass.Pkg.Path(), "_test")
+	if path == pass.Pkg.Path() {
+		return false
+	}
+	for _, imp := range pass.Pkg.Imports() {
+		if imp.Path() == path {
+			return pass.ImportPackageFact(imp, new(checksLeaks))
+		}
+	}
+	return false
+}
+
+// declaresTests reports whether the file declares a test or TestMain.
+func declaresTests(f *ast.File) bool {
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if ok && fn.Recv == nil && isTest(fn.Name.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTest reports whether name is the name of a test function, using the
+// same rules as go test, e.g., TestFoo but not Testfoo.
+func isTest(name string) bool {
+	if !strings.HasPrefix(name, "Test") {
+		return false
+	}
+	if len(name) == len("Test") {
+		return true
+	}
+	r, _ := utf8.DecodeRuneInString(name[len("Test"):])
+	return !unicode.IsLower(r)
+}
+
+// checkFunc returns the name of a goleak function that checks for leaks
+// used by the given files, or an empty string if there's none. Uses are
+// found using type information, so they're found with any import name,
+// and in goleak's own tests.
+func checkFunc(pass *analysis.Pass, files []*ast.File) string {
+	var found string
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if id, ok := n.(*ast.Ident); ok && isCheckFunc(pass.TypesInfo.Uses[id]) {
+				found = id.Name
+			}
+			return found == ""
+		})
+		if found != "" {
+			break
+		}
+	}
+	return found
+}
+
+// isCheckFunc reports whether obj is one of the goleak functions that check
+// for leaks.
+func isCheckFunc(obj types.Object) bool {
+	fn, ok := obj.(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != _goleakImportPath {
+		return false
+	}
+	return fn.Type().(*types.Signature).Recv() == nil && _checkFuncs[fn.Name()]
+}
+
+// isExempt reports whether the package with the given import path is in the
+// comma-separated list of exempt import paths.
+func isExempt(importPath, exempt string) bool {
+	// The import paths of test variants may have a suffix, e.g.,
+	// "pkg [pkg.test]", and external test packages have a "_test" suffix.
+	if idx := strings.Index(importPath, " "); idx >= 0 {
+		importPath = importPath[:idx]
+	}
+	importPath = strings.TrimSuffix(importPath, "_test")
+
+	for _, path := range strings.Split(exempt, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if prefix := strings.TrimSuffix(path, "/..."); prefix != path {
+			if importPath == prefix || strings.HasPrefix(importPath, prefix+"/") {
+				return true
+			}
+		} else if importPath == path {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// goleakcheck reports test packages that don't check for goroutine leaks
+// using goleak, to enforce leak checking across many packages. It's run
+// by go vet:
+//
+//	go vet -vettool=$(which goleakcheck) ./...
+//
+// A package is reported if it has tests, but none of its test files call
+// goleak.VerifyTestMain, VerifyNone or another function that checks for
+// leaks. Packages can be exempted using -goleakcheck.exempt, with a
+// comma-separated list of import paths, where a path ending in "/..." also
+// matches the packages below it:
+//
+//	go vet -vettool=$(which goleakcheck) -goleakcheck.exempt=example.com/legacy/... ./...
+//
+// go vet checks the tests of a package, and its external test package, as
+// separate units. The external tests are considered checked if the tests of
+// the package check for leaks, e.g., using VerifyTestMain, which covers the
+// whole test binary, but not the other way around, so packages that only
+// call VerifyTestMain from their external tests should be exempted.
+//
+// Only calls in the test files are found, so packages that check for leaks
+// through helpers in other packages should also be exempted.
+package main
+
+import "golang.org/x/tools/go/analysis/unitchecker"
+
+func main() {
+	unitchecker.Main(newAnalyzer())
+}
@@ -0,0 +1,281 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+	"golang.org/x/tools/go/analysis"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// unit is a package checked by go vet, such as the tests of a package,
+// or its external test package.
+type unit struct {
+	path  string
+	files map[string]string
+}
+
+var (
+	_fset           = token.NewFileSet()
+	_sourceOnce     sync.Once
+	_sourceImporter types.Importer
+)
+
+// analyze runs the analyzer on the given units in order, like go vet does
+// for a package and its tests, and returns the problems reported as
+// "file:line:column: message", with paths relative to the package.
+//
+// Packages imported by a unit are the earlier units with the import path,
+// or are otherwise type-checked from source, and the facts exported for
+// earlier units are available to later ones.
+func analyze(t *testing.T, a *analysis.Analyzer, units ...unit) []string {
+	if runtime.GOOS == "js" {
+		t.Skip("type-checking from source runs go list, which isn't supported on js")
+	}
+
+	// Share the packages type-checked from source between tests.
+	_sourceOnce.Do(func() {
+		_sourceImporter = importer.ForCompiler(_fset, "source", nil)
+	})
+	fset, fromSource := _fset, _sourceImporter
+	checked := make(map[string]*types.Package)
+	facts := make(map[*types.Package]analysis.Fact)
+
+	var problems []string
+	for _, u := range units {
+		var names []string
+		for name := range u.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		var files []*ast.File
+		for _, name := range names {
+			f, err := parser.ParseFile(fset, filepath.Join("pkg", name), u.files[name], 0)
+			require.NoError(t, err, "failed to parse %v", name)
+			files = append(files, f)
+		}
+
+		info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+		conf := types.Config{Importer: importerFunc(func(path string) (*types.Package, error) {
+			if pkg, ok := checked[path]; ok {
+				return pkg, nil
+			}
+			return fromSource.Import(path)
+		})}
+		pkg, err := conf.Check(u.path, fset, files, info)
+		require.NoError(t, err, "failed to type-check %v", u.path)
+		checked[u.path] = pkg
+
+		pass := &analysis.Pass{
+			Analyzer:  a,
+			Fset:      fset,
+			Files:     files,
+			Pkg:       pkg,
+			TypesInfo: info,
+			Report: func(d analysis.Diagnostic) {
+				problems = append(problems, fmt.Sprintf("%v: %v", fset.Position(d.Pos), d.Message))
+			},
+			ImportPackageFact: func(pkg *types.Package, fact analysis.Fact) bool {
+				f, ok := facts[pkg]
+				if ok {
+					reflect.ValueOf(fact).Elem().Set(reflect.ValueOf(f).Elem())
+				}
+				return ok
+			},
+			ExportPackageFact: func(fact analysis.Fact) {
+				facts[pkg] = fact
+			},
+		}
+		_, err = a.Run(pass)
+		require.NoError(t, err)
+	}
+	return problems
+}
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+func TestAnalyzer(t *testing.T) {
+	const (
+		pkg     = "package pkg\n\nfunc F() {}\n"
+		noCheck = "package pkg\n\nimport \"testing\"\n\nfunc TestFoo(t *testing.T) {}\n"
+		verify  = "package pkg\n\nimport (\n\t\"testing\"\n\n\t\"go.uber.org/goleak\"\n)\n\n" +
+			"func TestMain(m *testing.M) {\n\tgoleak.VerifyTestMain(m)\n}\n"
+		external        = "package pkg_test\n\nimport (\n\t\"testing\"\n\n\t\"example.com/pkg\"\n)\n\nfunc TestF(t *testing.T) {\n\tpkg.F()\n}\n"
+		externalNoCheck = "package pkg_test\n\nimport \"testing\"\n\nfunc TestBar(t *testing.T) {}\n"
+		verifyExternal  = "package pkg_test\n\nimport (\n\t\"testing\"\n\n\t\"go.uber.org/goleak\"\n)\n\n" +
+			"func TestMain(m *testing.M) {\n\tgoleak.VerifyTestMain(m)\n}\n"
+	)
+	problem := func(file string) string {
+		return filepath.Join("pkg", file) + ":1:1: " + _message
+	}
+
+	tests := []struct {
+		msg    string
+		units  []unit
+		exempt string
+		want   []string
+	}{
+		{
+			msg:   "no checks",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": noCheck}}},
+			want:  []string{problem("pkg_test.go")},
+		},
+		{
+			msg:    "exempt",
+			units:  []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": noCheck}}},
+			exempt: "example.com/other,example.com/pkg",
+		},
+		{
+			msg:    "exempt parent",
+			units:  []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": noCheck}}},
+			exempt: "example.com/...",
+		},
+		{
+			msg:   "no tests",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": "package pkg\n\nimport \"testing\"\n\nfunc Testfoo(t *testing.T) {}\n"}}},
+		},
+		{
+			msg:   "no test files",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg}}},
+		},
+		{
+			msg:   "reported for first test file",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg.go": pkg, "a_test.go": "package pkg\n", "b_test.go": noCheck}}},
+			want:  []string{problem("a_test.go")},
+		},
+		{
+			msg: "checked by any test file",
+			units: []unit{{"example.com/pkg", map[string]string{
+				"pkg.go": pkg, "pkg_test.go": noCheck, "main_test.go": verify,
+			}}},
+		},
+		{
+			msg: "external tests checked by package tests",
+			units: []unit{
+				{"example.com/pkg", map[string]string{"pkg.go": pkg, "main_test.go": verify}},
+				{"example.com/pkg_test", map[string]string{"ext_test.go": external}},
+			},
+		},
+		{
+			msg: "external tests without checks",
+			units: []unit{
+				{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": noCheck}},
+				{"example.com/pkg_test", map[string]string{"ext_test.go": external}},
+			},
+			want: []string{problem("pkg_test.go"), problem("ext_test.go")},
+		},
+		{
+			msg: "external tests that don't import the package",
+			units: []unit{
+				{"example.com/pkg", map[string]string{"pkg.go": pkg, "main_test.go": verify}},
+				{"example.com/pkg_test", map[string]string{"bar_test.go": externalNoCheck}},
+			},
+			want: []string{problem("bar_test.go")},
+		},
+		{
+			msg: "package tests checked by external tests",
+			units: []unit{
+				{"example.com/pkg", map[string]string{"pkg.go": pkg, "pkg_test.go": noCheck}},
+				{"example.com/pkg_test", map[string]string{"main_test.go": verifyExternal}},
+			},
+			// The tests of a package are checked before its external tests.
+			want: []string{problem("pkg_test.go")},
+		},
+		{
+			msg: "renamed import",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg_test.go": "package pkg\n\nimport (\n\t\"testing\"\n\n\tleak \"go.uber.org/goleak\"\n)\n\n" +
+				"func TestFoo(t *testing.T) {\n\tdefer leak.VerifyNone(t)\n}\n"}}},
+		},
+		{
+			msg: "dot import",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg_test.go": "package pkg\n\nimport (\n\t\"testing\"\n\n\t. \"go.uber.org/goleak\"\n)\n\n" +
+				"func TestFoo(t *testing.T) {\n\tCheck(t)\n}\n"}}},
+		},
+		{
+			msg: "other functions",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg_test.go": "package pkg\n\nimport (\n\t\"testing\"\n\n\t\"go.uber.org/goleak\"\n)\n\n" +
+				"func TestFoo(t *testing.T) {\n\t_ = goleak.Find()\n}\n"}}},
+			want: []string{problem("pkg_test.go")},
+		},
+		{
+			msg: "function with the same name",
+			units: []unit{{"example.com/pkg", map[string]string{"pkg_test.go": "package pkg\n\nimport \"testing\"\n\n" +
+				"func VerifyNone(t *testing.T) {}\n\nfunc TestFoo(t *testing.T) {\n\tVerifyNone(t)\n}\n"}}},
+			want: []string{problem("pkg_test.go")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			a := newAnalyzer()
+			require.NoError(t, a.Flags.Set("exempt", tt.exempt))
+			assert.Equal(t, tt.want, analyze(t, a, tt.units...))
+		})
+	}
+}
+
+func TestIsExempt(t *testing.T) {
+	tests := []struct {
+		importPath string
+		exempt     string
+		want       bool
+	}{
+		{"example.com/pkg", "", false},
+		{"example.com/pkg", "example.com/pkg", true},
+		{"example.com/pkg [example.com/pkg.test]", "example.com/pkg", true},
+		{"example.com/pkg_test", "example.com/pkg", true},
+		{"example.com/pkg", "example.com/other, example.com/pkg", true},
+		{"example.com/pkg/sub", "example.com/pkg", false},
+		{"example.com/pkg/sub", "example.com/pkg/...", true},
+		{"example.com/pkg", "example.com/pkg/...", true},
+		{"example.com/pkgs", "example.com/pkg/...", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isExempt(tt.importPath, tt.exempt), "isExempt(%q, %q)", tt.importPath, tt.exempt)
+	}
+}
+
+func TestAnalyzerValid(t *testing.T) {
+	require.NoError(t, analysis.Validate([]*analysis.Analyzer{newAnalyzer()}))
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// ANSI escape sequences used to colorize leaked stacks.
+const (
+	_colorReset    = "\x1b[0m"
+	_colorBold     = "\x1b[1m"
+	_colorState    = "\x1b[33m"   // yellow
+	_colorFunction = "\x1b[1;36m" // bold cyan
+	_colorCreator  = "\x1b[32m"   // green
+)
+
+// ColorMode controls whether leaked stacks are colorized.
+type ColorMode int
+
+const (
+	// ColorNever doesn't colorize leaked stacks.
+	ColorNever ColorMode = iota
+
+	// ColorAuto colorizes leaked stacks if standard error is a terminal,
+	// unless the process is running in CI, as indicated by the CI
+	// environment variable, or the NO_COLOR environment variable is set.
+	ColorAuto
+
+	// ColorAlways colorizes leaked stacks.
+	ColorAlways
+)
+
+// Colorize highlights the state, the function on top of the stack and the
+// creator of each leaked goroutine in the error returned by Find using ANSI
+// escape sequences, to make large reports easier to scan in a terminal:
+//
+//	goleak.VerifyTestMain(m, goleak.Colorize(goleak.ColorAuto))
+//
+// Since the escape sequences end up in the error message, this should only be
+// used when the message is written to a terminal.
+func Colorize(mode ColorMode) Option {
+	return optionFunc(func(opts *opts) {
+		switch mode {
+		case ColorAuto:
+			opts.color = UseColor(os.Stderr)
+		default:
+			opts.color = mode == ColorAlways
+		}
+	})
+}
+
+// UseColor reports whether output written to w should be colorized, as done
+// by Colorize with ColorAuto for standard error. This is true if w is a
+// terminal, and neither the CI nor the NO_COLOR environment variables are
+// set, and TERM is not "dumb".
+func UseColor(w io.Writer) bool {
+	if os.Getenv("CI") != "" || os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return _isTerminal(w)
+}
+
+// _isTerminal reports whether w is a terminal, and is stubbed in tests.
+var _isTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorizeStack highlights the given description of a leaked stack,
+// as returned by Stack.String.
+func colorizeStack(text string, s stack.Stack) string {
+	if state := "in state " + s.State() + ","; strings.Contains(text, state) {
+		text = strings.Replace(text, state, "in state "+_colorState+s.State()+_colorReset+",", 1)
+	}
+	if fn := s.FirstFunction(); fn != "" {
+		top := "with " + fn + " on top"
+		text = strings.Replace(text, top, "with "+_colorFunction+fn+_colorReset+" on top", 1)
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "created by ") {
+			body := strings.TrimSuffix(line, "\n")
+			lines[i] = _colorCreator + body + _colorReset + line[len(body):]
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// colorizeGroup highlights the description of a group of leaked stacks.
+func colorizeGroup(desc string) string {
+	body := strings.TrimSuffix(desc, "\n")
+	return _colorBold + body + _colorReset + desc[len(body):]
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestColorize(t *testing.T) {
+	parse := func(id int) stack.Stack {
+		s, err := stack.ParseStack(fmt.Sprintf(`goroutine %v [chan receive]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+`, id))
+		require.NoError(t, err)
+		return s
+	}
+	res := findResult{stacks: []stack.Stack{parse(6), parse(7)}}
+
+	out := formatStacks(res, buildOpts(Colorize(ColorAlways), GroupBy(GroupBySignature)))
+	assert.Contains(t, out, "[\x1b[1m2 goroutines with the same stack (IDs: 6, 7), such as:\x1b[0m\n")
+	assert.Contains(t, out, "Goroutine 6 in state \x1b[33mchan receive\x1b[0m, with \x1b[1;36mmain.worker\x1b[0m on top of the stack:\n")
+	assert.Contains(t, out, "\x1b[32mcreated by main.main in goroutine 1\x1b[0m\n\t/path/to/main.go:9 +0x6")
+
+	assert.NotContains(t, formatStacks(res, buildOpts()), "\x1b[", "Expected no colors by default")
+	assert.NotContains(t, formatStacks(res, buildOpts(Colorize(ColorNever))), "\x1b[")
+}
+
+func TestUseColor(t *testing.T) {
+	defer func(isTerminal func(io.Writer) bool) { _isTerminal = isTerminal }(_isTerminal)
+
+	tests := []struct {
+		msg      string
+		terminal bool
+		env      map[string]string
+		want     bool
+	}{
+		{msg: "terminal", terminal: true, want: true},
+		{msg: "not a terminal", terminal: false, want: false},
+		{msg: "CI", terminal: true, env: map[string]string{"CI": "true"}, want: false},
+		{msg: "NO_COLOR", terminal: true, env: map[string]string{"NO_COLOR": "1"}, want: false},
+		{msg: "dumb terminal", terminal: true, env: map[string]string{"TERM": "dumb"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			t.Setenv("CI", "")
+			t.Setenv("NO_COLOR", "")
+			t.Setenv("TERM", "xterm")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			_isTerminal = func(io.Writer) bool { return tt.terminal }
+
+			assert.Equal(t, tt.want, UseColor(io.Discard))
+			assert.Equal(t, tt.want, buildOpts(Colorize(ColorAuto)).color)
+		})
+	}
+}
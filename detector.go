@@ -0,0 +1,61 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sync"
+
+	"go.uber.org/goleak/stack"
+)
+
+// Detector looks for extra goroutines like Find, using options that are
+// applied once when the Detector is created, and reusing the buffer for
+// the stacks of all goroutines between checks. This reduces the cost of
+// checking for leaks repeatedly, e.g., after each iteration of a stress test:
+//
+//	d := goleak.NewDetector(goleak.IgnoreCurrent())
+//	for i := 0; i < 1000; i++ {
+//		// run an iteration
+//		require.NoError(t, d.Check())
+//	}
+//
+// A Detector is safe for concurrent use, but concurrent checks are serialized.
+type Detector struct {
+	mu      sync.Mutex
+	opts    *opts
+	sampler stack.Sampler
+}
+
+// NewDetector returns a Detector that uses the given options.
+func NewDetector(options ...Option) *Detector {
+	d := &Detector{opts: buildOpts(options...)}
+	d.opts.sample = d.sampler.All
+	return d
+}
+
+// Check looks for extra goroutines, and returns a descriptive error if
+// any are found, like Find.
+func (d *Detector) Check() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return findError(d.opts)
+}
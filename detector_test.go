@@ -0,0 +1,79 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetector(t *testing.T) {
+	d := NewDetector(testOptions())
+	require.NoError(t, d.Check(), "Expected no leaks")
+
+	bg := startBlockedG()
+	err := d.Check()
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "blockedG")
+
+	bg.unblock()
+	require.NoError(t, NewDetector().Check(), "Expected no leaks after unblocking")
+	require.NoError(t, d.Check(), "Detector should be reusable")
+}
+
+func TestDetectorConcurrent(t *testing.T) {
+	d := NewDetector(testOptions())
+
+	// The goroutines checking concurrently report each other as leaks,
+	// so this only checks that concurrent checks are safe.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = d.Check()
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkFind(b *testing.B) {
+	// Ignore the goroutines running benchmarks.
+	ignore := IgnoreCurrent()
+	for i := 0; i < b.N; i++ {
+		if err := Find(ignore); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDetector(b *testing.B) {
+	// Ignore the goroutines running benchmarks.
+	d := NewDetector(IgnoreCurrent())
+	for i := 0; i < b.N; i++ {
+		if err := d.Check(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"flag"
+	"os"
+
+	"go.uber.org/goleak/stack"
+)
+
+// writeStackDump writes the full stacks of the given goroutines to the given
+// path for DumpStacksOnFailure, or to a new file in the test output directory
+// if path is empty, and returns the path of the file.
+func writeStackDump(path string, stacks []stack.Stack) (string, error) {
+	var (
+		f   *os.File
+		err error
+	)
+	if path != "" {
+		f, err = os.Create(path)
+	} else {
+		f, err = os.CreateTemp(testOutputDir(), "goleak-stacks-*.txt")
+	}
+	if err != nil {
+		return "", err
+	}
+
+	for _, s := range stacks {
+		if _, err := f.WriteString(s.Full()); err != nil {
+			f.Close()
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// testOutputDir returns the directory set using go test -outputdir,
+// or os.TempDir if it's not set, e.g., outside of tests.
+func testOutputDir() string {
+	if f := flag.Lookup("test.outputdir"); f != nil {
+		if dir := f.Value.String(); dir != "" {
+			return dir
+		}
+	}
+	return os.TempDir()
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// Environment variables that let CI operators change leak checks without
+// changing the tests.
+const (
+	// _disableEnv disables looking for goroutine leaks in Find and the
+	// functions that use it, e.g., VerifyNone and VerifyTestMain, when set to
+	// a true value like "1" or "true". Functions that only report goroutines,
+	// like Summary, FindReport, Analyze and Monitor, are not affected.
+	_disableEnv = "GOLEAK_DISABLE"
+
+	// _ignoreEnv is a comma-separated list of functions to ignore like
+	// IgnoreAnyFunction.
+	_ignoreEnv = "GOLEAK_IGNORE"
+)
+
+// disabledByEnv reports whether looking for leaks is disabled using the
+// GOLEAK_DISABLE environment variable. Values that aren't true, including
+// invalid ones, leave leak checks enabled.
+func disabledByEnv() bool {
+	disabled, err := strconv.ParseBool(os.Getenv(_disableEnv))
+	return err == nil && disabled
+}
+
+// ignoredByEnv returns a filter for the functions to ignore from the
+// GOLEAK_IGNORE environment variable, or nil if none are specified.
+func ignoredByEnv() func(stack.Stack) bool {
+	var funcs []string
+	for _, f := range strings.Split(os.Getenv(_ignoreEnv), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			funcs = append(funcs, f)
+		}
+	}
+	if len(funcs) == 0 {
+		return nil
+	}
+	return func(s stack.Stack) bool {
+		for _, f := range funcs {
+			if s.HasFunction(f) {
+				return true
+			}
+		}
+		return false
+	}
+}
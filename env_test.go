@@ -0,0 +1,90 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestDisableEnv(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	t.Setenv(_disableEnv, "1")
+	require.NoError(t, Find(testOptions()), "Expected leak checks to be disabled")
+
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions())
+	assert.Empty(t, ft.errors, "Expected leak checks to be disabled")
+
+	for _, v := range []string{"", "0", "false", "invalid"} {
+		t.Setenv(_disableEnv, v)
+		require.Error(t, Find(testOptions()), "Expected leak checks to be enabled for %q", v)
+	}
+
+	t.Setenv(_disableEnv, "true")
+	require.NoError(t, Find(testOptions()), "Expected leak checks to be disabled")
+	summary, err := Summary(testOptions())
+	require.NoError(t, err)
+	assert.Contains(t, summary, "blockedG", "Expected Summary to ignore GOLEAK_DISABLE")
+}
+
+func TestIgnoreEnv(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	t.Setenv(_ignoreEnv, "main.other, go.uber.org/goleak.(*blockedG).run")
+	require.NoError(t, Find(testOptions()), "Expected blockedG to be ignored")
+
+	t.Setenv(_ignoreEnv, "main.other")
+	require.Error(t, Find(testOptions()), "Expected blockedG to be reported")
+}
+
+func TestIgnoredByEnv(t *testing.T) {
+	s, err := stack.ParseStack("goroutine 7 [chan receive]:\n" +
+		"main.blocked()\n\t/path/to/main.go:10 +0x1f\n" +
+		"main.worker()\n\t/path/to/main.go:20 +0x1f\n")
+	require.NoError(t, err)
+
+	tests := []struct {
+		env  string
+		want bool
+	}{
+		{env: "main.worker", want: true},
+		{env: "main.other,main.blocked", want: true},
+		{env: " main.other , main.worker ", want: true},
+		{env: "main.other", want: false},
+		{env: ",main.main,", want: false},
+	}
+	for _, tt := range tests {
+		t.Setenv(_ignoreEnv, tt.env)
+		filter := ignoredByEnv()
+		require.NotNil(t, filter, "ignoredByEnv() with %q", tt.env)
+		assert.Equal(t, tt.want, filter(s), "ignoredByEnv() with %q", tt.env)
+	}
+
+	for _, env := range []string{"", " , "} {
+		t.Setenv(_ignoreEnv, env)
+		assert.Nil(t, ignoredByEnv(), "ignoredByEnv() with %q", env)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fdSet maps the open file descriptors of the process to what they refer to,
+// e.g., a file path, or "socket:[12345]" for a socket.
+type fdSet map[int]string
+
+// openFD is a file descriptor, and what it refers to.
+type openFD struct {
+	fd     int
+	target string
+}
+
+// leakedFDs returns the file descriptors in after that were not open in
+// before, or that now refer to something else, ordered by descriptor.
+func leakedFDs(before, after fdSet) []openFD {
+	var leaked []openFD
+	for fd, target := range after {
+		if prev, ok := before[fd]; ok && prev == target {
+			continue
+		}
+		leaked = append(leaked, openFD{fd: fd, target: target})
+	}
+	sort.Slice(leaked, func(i, j int) bool {
+		return leaked[i].fd < leaked[j].fd
+	})
+	return leaked
+}
+
+// fdLeakError returns the error reported by VerifyTestMain for the given
+// leaked file descriptors.
+func fdLeakError(fds []openFD) error {
+	var b strings.Builder
+	for _, f := range fds {
+		fmt.Fprintf(&b, "\n\tfd %v: %v", f.fd, f.target)
+	}
+	return fmt.Errorf("found unexpected open file descriptors:%s", b.String())
+}
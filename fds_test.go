@@ -0,0 +1,59 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeakedFDs(t *testing.T) {
+	before := fdSet{
+		0: "/dev/null",
+		1: "pipe:[100]",
+		2: "pipe:[101]",
+		5: "/tmp/reused.txt",
+		6: "/tmp/closed.txt",
+	}
+	after := fdSet{
+		0: "/dev/null",
+		1: "pipe:[100]",
+		2: "pipe:[101]",
+		5: "socket:[200]",
+		9: "/tmp/leaked.txt",
+		7: "socket:[201]",
+	}
+	assert.Equal(t, []openFD{
+		{fd: 5, target: "socket:[200]"},
+		{fd: 7, target: "socket:[201]"},
+		{fd: 9, target: "/tmp/leaked.txt"},
+	}, leakedFDs(before, after))
+	assert.Empty(t, leakedFDs(before, before), "Expected no leaks without changes")
+}
+
+func TestFDLeakError(t *testing.T) {
+	err := fdLeakError([]openFD{
+		{fd: 7, target: "/tmp/leaked.txt"},
+		{fd: 8, target: "socket:[12345]"},
+	})
+	assert.Equal(t, "found unexpected open file descriptors:\n\tfd 7: /tmp/leaked.txt\n\tfd 8: socket:[12345]", err.Error())
+}
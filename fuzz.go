@@ -0,0 +1,123 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// FuzzChecker checks each iteration of a fuzz target for leaks, and reports
+// the input that caused them, so leaking inputs found by the fuzzer are
+// flagged rather than surfacing as a leak once fuzzing stops:
+//
+//	func FuzzParse(f *testing.F) {
+//		leaks := goleak.NewFuzzChecker()
+//		f.Fuzz(func(t *testing.T, data []byte) {
+//			leaks.Check(t, data)
+//			// fuzz logic here.
+//		})
+//	}
+//
+// Goroutines that were running at the start of each iteration, such as those
+// started by the fuzzing engine or leaked by an earlier iteration, are
+// ignored, so leaks are only reported for the input that caused them.
+// Iterations must not run in parallel.
+type FuzzChecker struct {
+	opts    *opts
+	sampler stack.Sampler
+
+	// before is the IDs of the goroutines running at the start of the
+	// current iteration.
+	before map[int]bool
+}
+
+// NewFuzzChecker returns a FuzzChecker that uses the given options.
+func NewFuzzChecker(options ...Option) *FuzzChecker {
+	c := &FuzzChecker{}
+	// Copy the options so we don't modify the caller's slice.
+	c.opts = buildOpts(append(options[:len(options):len(options)], addFilter(func(s stack.Stack) bool {
+		return c.before[s.ID()]
+	}))...)
+	c.opts.sample = c.sampler.All
+	return c
+}
+
+// Check marks the given test as failed if the current fuzz iteration leaks
+// any goroutines, including the given input in the error. It should be
+// called at the start of the fuzz function with the fuzzed arguments, and
+// checks for leaks once the iteration completes.
+//
+// Since the fuzzer runs many iterations, the leak check is skipped if no
+// goroutines were started since the start of the iteration are running, and
+// only falls back to a full check, with retries, otherwise.
+func (c *FuzzChecker) Check(t TestingCleanupT, input ...interface{}) {
+	// Any goroutines that could not be parsed are reported by the full check.
+	stacks, _ := c.sampler.All()
+	before := make(map[int]bool, len(stacks))
+	for _, s := range stacks {
+		before[s.ID()] = true
+	}
+
+	t.Cleanup(func() {
+		if h, ok := t.(helperT); ok {
+			h.Helper()
+		}
+		if !c.startedSince(before) {
+			return
+		}
+		c.before = before
+		if err := findError(c.opts); err != nil {
+			t.Error(fmt.Sprintf("leaked goroutines with fuzz input (%v): %v", formatFuzzInput(input), err))
+		}
+	})
+}
+
+// startedSince reports whether any goroutines that are not in before are
+// running, or if the goroutines can't be determined.
+func (c *FuzzChecker) startedSince(before map[int]bool) bool {
+	stacks, err := c.sampler.All()
+	if err != nil {
+		return true
+	}
+	for _, s := range stacks {
+		if !before[s.ID()] {
+			return true
+		}
+	}
+	return false
+}
+
+// formatFuzzInput formats the arguments of a fuzz iteration like Go values,
+// showing byte slices as strings for readability.
+func formatFuzzInput(input []interface{}) string {
+	args := make([]string, len(input))
+	for i, arg := range input {
+		if b, ok := arg.([]byte); ok {
+			args[i] = fmt.Sprintf("[]byte(%q)", b)
+		} else {
+			args[i] = fmt.Sprintf("%#v", arg)
+		}
+	}
+	return strings.Join(args, ", ")
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuzzChecker(t *testing.T) {
+	before := startBlockedG()
+	defer before.unblock()
+
+	c := NewFuzzChecker(testOptions())
+	iterate := func(f func()) *fakeCleanupT {
+		ft := &fakeCleanupT{}
+		c.Check(ft, []byte("input"), 42)
+		f()
+		require.Len(t, ft.cleanups, 1, "Expected check to be registered as a cleanup")
+		ft.runCleanups()
+		return ft
+	}
+
+	ft := iterate(func() {})
+	assert.Empty(t, ft.errors, "Goroutines running before the first iteration should be ignored")
+
+	ft = iterate(func() {
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+	assert.Empty(t, ft.errors, "Goroutines that exit should not be reported")
+
+	var bg *blockedG
+	ft = iterate(func() {
+		bg = startBlockedG()
+	})
+	defer bg.unblock()
+	require.Len(t, ft.errors, 1, "Expected leaked goroutine to be reported")
+	assert.Contains(t, ft.errors[0], `leaked goroutines with fuzz input ([]byte("input"), 42): found unexpected goroutines`)
+	assert.Contains(t, ft.errors[0], "blockedG")
+}
+
+func TestFuzzCheckerBlamesLeakingInput(t *testing.T) {
+	c := NewFuzzChecker(testOptions())
+	iterate := func(input string, f func()) *fakeCleanupT {
+		ft := &fakeCleanupT{}
+		c.Check(ft, input)
+		f()
+		ft.runCleanups()
+		return ft
+	}
+
+	var leaked *blockedG
+	ft := iterate("leaky", func() {
+		leaked = startBlockedG()
+	})
+	defer func() {
+		if leaked != nil {
+			leaked.unblock()
+		}
+	}()
+	require.Len(t, ft.errors, 1, "Expected leaked goroutine to be reported")
+	assert.Contains(t, ft.errors[0], `fuzz input ("leaky")`)
+
+	ft = iterate("clean", func() {
+		done := make(chan struct{})
+		go close(done)
+		<-done
+	})
+	assert.Empty(t, ft.errors, "Goroutines leaked by earlier iterations should not be reported")
+
+	// A goroutine that exits while another leaks keeps the count the same.
+	var replaced *blockedG
+	ft = iterate("replaced", func() {
+		leaked.unblock()
+		leaked = nil
+		replaced = startBlockedG()
+	})
+	defer replaced.unblock()
+	require.Len(t, ft.errors, 1, "Expected leak to be reported when another goroutine exits")
+	assert.Contains(t, ft.errors[0], `fuzz input ("replaced")`)
+}
+
+func TestFormatFuzzInput(t *testing.T) {
+	assert.Equal(t, "", formatFuzzInput(nil))
+	assert.Equal(t, `[]byte("a\x00"), "b", 3, true`, formatFuzzInput([]interface{}{[]byte("a\x00"), "b", 3, true}))
+}
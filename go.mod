@@ -5,13 +5,13 @@ go 1.17
 require (
 	github.com/stretchr/testify v1.7.0
 	golang.org/x/lint v0.0.0-20190930215403-16217165b5de
+	golang.org/x/tools v0.1.5
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.0 // indirect
 	github.com/kr/pretty v0.1.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	golang.org/x/tools v0.1.5 // indirect
 	gopkg.in/check.v1 v1.0.0-20180628173108-788fd7840127 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
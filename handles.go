@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"time"
+)
+
+// Variables for stubbing in unit tests.
+var _handleCounts = handleCounts
+
+// _handlesPerRuntimeThread is the most handles that the Go runtime opens for
+// each thread it starts on Windows, e.g., for the thread itself, and for the
+// events and timers it waits on.
+//
+// Only threads started while the tests run are allowed these handles, but as
+// the allowance is an upper bound, a few leaked handles can be hidden by the
+// runtime starting threads that use fewer handles.
+const _handlesPerRuntimeThread = 6
+
+// handleCount is the number of open handles of the process.
+type handleCount struct {
+	// os is the number of handles reported by the OS.
+	os int
+
+	// goRuntimeThreads is the number of threads started by the Go runtime,
+	// which each have handles that won't be closed till the thread exits.
+	goRuntimeThreads int
+}
+
+// leakedSince returns the number of handles opened since before that were
+// not opened by the Go runtime for the threads it started since before.
+func (c handleCount) leakedSince(before handleCount) int {
+	newThreads := c.goRuntimeThreads - before.goRuntimeThreads
+	if newThreads < 0 {
+		newThreads = 0
+	}
+	return c.os - before.os - _handlesPerRuntimeThread*newThreads
+}
+
+// findHandleLeaks returns the number of handles that were opened beyond those
+// counted in before, retrying as specified by opts to allow handles that are
+// being closed, e.g., by finalizers, to be closed.
+func findHandleLeaks(before handleCount, opts *opts) (int, error) {
+	var deadline time.Time
+	if opts.totalBudget > 0 {
+		deadline = opts.clock.Now().Add(opts.totalBudget)
+	}
+
+	for i := 0; ; i++ {
+		after, err := _handleCounts()
+		if err != nil {
+			return 0, err
+		}
+		leaked := after.leakedSince(before)
+		if leaked <= 0 || !opts.retry(i, deadline) {
+			return leaked, nil
+		}
+	}
+}
+
+// handleLeakError returns the error reported by VerifyTestMain for the given
+// number of leaked handles.
+func handleLeakError(leaked int) error {
+	return fmt.Errorf("found %v, e.g., for files, events or registry keys that were not closed", pluralize(leaked, "unexpected open handle"))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubHandleCounts makes _handleCounts return the given counts in order,
+// repeating the last one, and returns a function to undo the stub.
+func stubHandleCounts(counts ...handleCount) func() {
+	orig := _handleCounts
+	_handleCounts = func() (handleCount, error) {
+		c := counts[0]
+		if len(counts) > 1 {
+			counts = counts[1:]
+		}
+		return c, nil
+	}
+	return func() { _handleCounts = orig }
+}
+
+func TestHandleCounts(t *testing.T) {
+	c, err := handleCounts()
+	if runtime.GOOS != "windows" {
+		require.Error(t, err, "Expected handle counts to be unsupported")
+		return
+	}
+	require.NoError(t, err)
+	assert.NotZero(t, c.os, "Expected handles to be counted")
+	assert.NotZero(t, c.goRuntimeThreads, "Expected threads started by the runtime")
+}
+
+func TestFindHandleLeaks(t *testing.T) {
+	before := handleCount{os: 100, goRuntimeThreads: 5}
+
+	t.Run("no leaks", func(t *testing.T) {
+		// Handles of threads started by the runtime are not leaks.
+		defer stubHandleCounts(handleCount{os: 100 + 2*_handlesPerRuntimeThread, goRuntimeThreads: 7})()
+		leaked, err := findHandleLeaks(before, buildOpts(WithClock(newFakeClock())))
+		require.NoError(t, err)
+		assert.Equal(t, 0, leaked)
+	})
+
+	t.Run("leaks", func(t *testing.T) {
+		defer stubHandleCounts(handleCount{os: 103 + _handlesPerRuntimeThread, goRuntimeThreads: 6})()
+		clock := newFakeClock()
+		leaked, err := findHandleLeaks(before, buildOpts(WithClock(clock), MaxRetries(3)))
+		require.NoError(t, err)
+		assert.Equal(t, 3, leaked)
+		assert.Len(t, clock.sleeps, 3, "Expected retries before reporting leaks")
+	})
+
+	t.Run("leaks with new runtime threads", func(t *testing.T) {
+		// Only handles beyond the allowance for the 2 new threads are leaks.
+		defer stubHandleCounts(handleCount{os: 104 + 2*_handlesPerRuntimeThread, goRuntimeThreads: 7})()
+		leaked, err := findHandleLeaks(before, buildOpts(WithClock(newFakeClock())))
+		require.NoError(t, err)
+		assert.Equal(t, 4, leaked)
+	})
+
+	t.Run("threads before the tests have no allowance", func(t *testing.T) {
+		// Threads started before the tests don't explain handles opened later.
+		defer stubHandleCounts(handleCount{os: 102, goRuntimeThreads: 5})()
+		leaked, err := findHandleLeaks(before, buildOpts(WithClock(newFakeClock())))
+		require.NoError(t, err)
+		assert.Equal(t, 2, leaked)
+	})
+
+	t.Run("retries until handles are closed", func(t *testing.T) {
+		defer stubHandleCounts(
+			handleCount{os: 102, goRuntimeThreads: 5},
+			handleCount{os: 101, goRuntimeThreads: 5},
+			handleCount{os: 100, goRuntimeThreads: 5},
+		)()
+		clock := newFakeClock()
+		leaked, err := findHandleLeaks(before, buildOpts(WithClock(clock)))
+		require.NoError(t, err)
+		assert.Equal(t, 0, leaked)
+		assert.Len(t, clock.sleeps, 2)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		orig := _handleCounts
+		defer func() { _handleCounts = orig }()
+		_handleCounts = func() (handleCount, error) {
+			return handleCount{}, errors.New("great sadness")
+		}
+		_, err := findHandleLeaks(before, buildOpts())
+		assert.EqualError(t, err, "great sadness")
+	})
+}
+
+func TestHandleLeakError(t *testing.T) {
+	assert.EqualError(t, handleLeakError(1), "found 1 unexpected open handle, e.g., for files, events or registry keys that were not closed")
+	assert.EqualError(t, handleLeakError(2), "found 2 unexpected open handles, e.g., for files, events or registry keys that were not closed")
+}
@@ -0,0 +1,51 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build windows
+// +build windows
+
+package goleak
+
+import (
+	"fmt"
+	"runtime/pprof"
+	"syscall"
+	"unsafe"
+)
+
+var _procGetProcessHandleCount = syscall.NewLazyDLL("kernel32.dll").NewProc("GetProcessHandleCount")
+
+// handleCounts counts the open handles of the process using
+// GetProcessHandleCount.
+func handleCounts() (handleCount, error) {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return handleCount{}, fmt.Errorf("failed to count handles: %v", err)
+	}
+	// Threads started by the runtime while the handles are counted are
+	// counted here, so their handles can't be mistaken for leaks.
+	goRuntimeThreads := pprof.Lookup("threadcreate").Count()
+
+	var n uint32
+	if r, _, err := _procGetProcessHandleCount.Call(uintptr(process), uintptr(unsafe.Pointer(&n))); r == 0 {
+		return handleCount{}, fmt.Errorf("failed to count handles: %v", err)
+	}
+	return handleCount{os: int(n), goRuntimeThreads: goRuntimeThreads}, nil
+}
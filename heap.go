@@ -0,0 +1,259 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// Variables for stubbing in unit tests.
+var _heapSnapshot = takeHeapSnapshot
+
+const (
+	// _heapSettleGCs is the number of garbage collections to run before
+	// measuring the heap. Objects in a sync.Pool survive one collection,
+	// and objects with finalizers are only freed by the next collection.
+	_heapSettleGCs = 3
+
+	// _heapTopGrowth is the number of allocation sites with the most
+	// growth to report.
+	_heapTopGrowth = 5
+
+	// _heapMaxFrames is the number of frames of each allocation site
+	// to report.
+	_heapMaxFrames = 5
+)
+
+// heapSnapshot is the live heap of the process after garbage collection.
+type heapSnapshot struct {
+	// inUse is the number of bytes of live heap objects.
+	inUse int64
+
+	// sites is the estimated number of bytes of live heap objects by the
+	// key of the allocation site, from the sampled heap profile.
+	sites map[string]heapSite
+}
+
+// heapSite is the live heap allocated from a stack.
+type heapSite struct {
+	frames []stack.Frame
+	bytes  int64
+}
+
+// takeHeapSnapshot collects garbage, and returns the live heap.
+func takeHeapSnapshot() (heapSnapshot, error) {
+	for i := 0; i < _heapSettleGCs; i++ {
+		runtime.GC()
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	// The profile is as of the last garbage collection.
+	var buf bytes.Buffer
+	if err := pprof.Lookup("heap").WriteTo(&buf, 1); err != nil {
+		return heapSnapshot{}, err
+	}
+	return heapSnapshot{inUse: int64(ms.HeapAlloc), sites: parseHeapProfile(&buf)}, nil
+}
+
+// parseHeapProfile parses the live heap by allocation site from a heap
+// profile with debug=1, which has records such as:
+//
+//	heap profile: 2: 528384 [3: 532480] @ heap/1048576
+//	1: 524288 [1: 524288] @ 0x40ff2a 0x4b15bd 0x46e0c1
+//	#	0x4b15bc	main.main+0x3c	/path/to/main.go:12
+//
+// The sizes are of the sampled allocations, so they're scaled like pprof
+// to estimate the size of all allocations.
+func parseHeapProfile(r io.Reader) map[string]heapSite {
+	var (
+		sites         = make(map[string]heapSite)
+		rate          int64
+		count, nbytes int64
+		frames        []stack.Frame
+	)
+	flush := func() {
+		if frames != nil {
+			frames = trimRuntimeFrames(frames)
+			key := heapSiteKey(frames)
+			site := sites[key]
+			site.frames = frames
+			site.bytes += scaleHeapSample(count, nbytes, rate)
+			sites[key] = site
+		}
+		count, nbytes, frames = 0, 0, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "heap profile: "):
+			if idx := strings.LastIndex(line, "@ heap/"); idx >= 0 {
+				// The header has twice the sampling rate, for historical reasons.
+				fmt.Sscanf(line[idx:], "@ heap/%d", &rate)
+				rate /= 2
+			}
+		case strings.HasPrefix(line, "# runtime.MemStats"):
+			flush()
+			return sites
+		case strings.HasPrefix(line, "#\t"):
+			if f, ok := parseProfileFrame(line); ok {
+				frames = append(frames, f)
+			}
+		case line == "":
+			flush()
+		default:
+			flush()
+			fmt.Sscanf(line, "%d: %d", &count, &nbytes)
+		}
+	}
+	flush()
+	return sites
+}
+
+// trimRuntimeFrames removes the functions in the runtime from the given
+// frames, such as the runtime's allocation functions, unless all functions
+// are in the runtime.
+func trimRuntimeFrames(frames []stack.Frame) []stack.Frame {
+	var trimmed []stack.Frame
+	for _, f := range frames {
+		if !isRuntimePackage(f.Package()) {
+			trimmed = append(trimmed, f)
+		}
+	}
+	if len(trimmed) == 0 {
+		return frames
+	}
+	return trimmed
+}
+
+// heapSiteKey returns the key of the allocation site with the given frames.
+func heapSiteKey(frames []stack.Frame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%v %v:%v\n", f.Function, f.File, f.Line)
+	}
+	return b.String()
+}
+
+// scaleHeapSample estimates the size of all allocations from the given
+// sampled allocations, like pprof, since larger allocations are more likely
+// to be sampled.
+func scaleHeapSample(count, size, rate int64) int64 {
+	if count == 0 || size == 0 {
+		return 0
+	}
+	if rate <= 1 {
+		return size
+	}
+	avgSize := float64(size) / float64(count)
+	scale := 1 / (1 - math.Exp(-avgSize/float64(rate)))
+	return int64(float64(size) * scale)
+}
+
+// heapGrowth is how much the live heap grew between two snapshots.
+type heapGrowth struct {
+	bytes int64
+
+	// top are the allocation sites that grew the most.
+	top []heapSite
+}
+
+// diffHeap returns how much the live heap grew from before to after.
+func diffHeap(before, after heapSnapshot) heapGrowth {
+	growth := heapGrowth{bytes: after.inUse - before.inUse}
+	for key, site := range after.sites {
+		site.bytes -= before.sites[key].bytes
+		if site.bytes > 0 {
+			growth.top = append(growth.top, site)
+		}
+	}
+	sort.Slice(growth.top, func(i, j int) bool {
+		if growth.top[i].bytes != growth.top[j].bytes {
+			return growth.top[i].bytes > growth.top[j].bytes
+		}
+		return heapSiteKey(growth.top[i].frames) < heapSiteKey(growth.top[j].frames)
+	})
+	if len(growth.top) > _heapTopGrowth {
+		growth.top = growth.top[:_heapTopGrowth]
+	}
+	return growth
+}
+
+// findHeapGrowth returns how much the live heap grew since before.
+func findHeapGrowth(before heapSnapshot) (heapGrowth, error) {
+	after, err := _heapSnapshot()
+	if err != nil {
+		return heapGrowth{}, err
+	}
+	return diffHeap(before, after), nil
+}
+
+// heapGrowthError returns the error reported by VerifyTestMain for heap
+// growth beyond the given budget.
+func heapGrowthError(growth heapGrowth, budget int64) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "found %v of heap growth, more than the budget of %v",
+		formatBytes(growth.bytes), formatBytes(budget))
+	if len(growth.top) == 0 {
+		return fmt.Errorf("%s", b.String())
+	}
+	b.WriteString(", with the most growth allocated at:")
+	for _, site := range growth.top {
+		fmt.Fprintf(&b, "\n%v:", formatBytes(site.bytes))
+		for i, f := range site.frames {
+			if i == _heapMaxFrames {
+				fmt.Fprintf(&b, "\n\t...additional frames elided...")
+				break
+			}
+			fmt.Fprintf(&b, "\n\t%v\n\t\t%v:%v", f.Function, f.File, f.Line)
+		}
+	}
+	return fmt.Errorf("%s", b.String())
+}
+
+// formatBytes formats the given number of bytes using binary units,
+// e.g., "1.5 MiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	v := float64(n)
+	for _, prefix := range []string{"Ki", "Mi", "Gi"} {
+		v /= unit
+		if math.Abs(v) < unit || prefix == "Gi" {
+			return fmt.Sprintf("%.1f %vB", v, prefix)
+		}
+	}
+	return ""
+}
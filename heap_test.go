@@ -0,0 +1,181 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+// _retained is memory retained by a test for TestVerifyTestMainCheckHeap.
+var _retained []byte
+
+func TestVerifyTestMainCheckHeap(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	VerifyTestMain(funcTestMain(func() int {
+		_retained = make([]byte, 32<<20)
+		return 0
+	}), CheckHeap(1<<20), testOptions())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to memory retained by the tests")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: Errors on successful test run: found ")
+	assert.Contains(t, out, "of heap growth, more than the budget of 1.0 MiB, with the most growth allocated at:\n")
+	assert.Contains(t, out, "go.uber.org/goleak.TestVerifyTestMainCheckHeap.func1\n", "Expected allocation site in %v", out)
+
+	VerifyTestMain(funcTestMain(func() int {
+		_retained = nil
+		return 0
+	}), CheckHeap(1<<20), testOptions())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors once memory is released")
+	assert.Empty(t, <-stderr)
+
+	defer func() { _heapSnapshot = takeHeapSnapshot }()
+	_heapSnapshot = func() (heapSnapshot, error) {
+		return heapSnapshot{}, errors.New("great sadness")
+	}
+	VerifyTestMain(dummyTestMain(0), CheckHeap(0))
+	assert.Equal(t, 0, <-exitCode, "Expect no errors when the heap can't be measured")
+	assert.Contains(t, <-stderr, "goleak: Skipping heap check: great sadness")
+}
+
+func TestParseHeapProfile(t *testing.T) {
+	const profile = "heap profile: 3: 8389632 [4: 8390656] @ heap/1048576\n" +
+		"1: 8388608 [1: 8388608] @ 0x47c0ba 0x47ee49 0x4de745 0x4de7a9 0x44aa27 0x483561\n" +
+		"#\t0x47ee48\truntime.makeslice+0x48\t/usr/local/go/src/runtime/slice.go:116\n" +
+		"#\t0x4de744\tmain.grow+0x24\t\t/path/to/main.go:11\n" +
+		"#\t0x4de7a8\tmain.main+0x88\t\t/path/to/main.go:14\n" +
+		"\n" +
+		"2: 1024 [3: 2048] @ 0x47c0ba 0x4de7a9 0x44aa27\n" +
+		"#\t0x4de7a8\tmain.main+0x88\t\t/path/to/main.go:15\n" +
+		"\n" +
+		"0: 0 [1: 1024] @ 0x47c0ba 0x4de7a9\n" +
+		"#\t0x4de7a8\tmain.main+0x88\t\t/path/to/main.go:16\n" +
+		"\n" +
+		"\n" +
+		"# runtime.MemStats\n" +
+		"# Alloc = 8438080\n"
+
+	sites := parseHeapProfile(strings.NewReader(profile))
+	require.Len(t, sites, 3)
+
+	grow := sites["main.grow /path/to/main.go:11\nmain.main /path/to/main.go:14\n"]
+	assert.Equal(t, []stack.Frame{
+		{Function: "main.grow", File: "/path/to/main.go", Line: 11},
+		{Function: "main.main", File: "/path/to/main.go", Line: 14},
+	}, grow.frames, "Runtime functions should be removed")
+	assert.InDelta(t, 8388608, grow.bytes, 1, "Large allocations are always sampled")
+
+	small := sites["main.main /path/to/main.go:15\n"]
+	// Allocations of 512 bytes are sampled about once in 1024.
+	assert.InDelta(t, 1024/(1-math.Exp(-512.0/524288)), small.bytes, 1, "Small allocations should be scaled")
+
+	assert.Zero(t, sites["main.main /path/to/main.go:16\n"].bytes, "Freed allocations should have no live bytes")
+}
+
+func TestDiffHeap(t *testing.T) {
+	site := func(fn string, bytes int64) heapSite {
+		return heapSite{frames: []stack.Frame{{Function: fn, File: "/path/to/main.go", Line: 1}}, bytes: bytes}
+	}
+	snapshot := func(inUse int64, sites ...heapSite) heapSnapshot {
+		s := heapSnapshot{inUse: inUse, sites: make(map[string]heapSite)}
+		for _, site := range sites {
+			s.sites[heapSiteKey(site.frames)] = site
+		}
+		return s
+	}
+
+	before := snapshot(1000, site("main.a", 100), site("main.b", 500), site("main.c", 100))
+	after := snapshot(5000,
+		site("main.a", 1100), site("main.b", 400), site("main.c", 2100),
+		site("main.d", 10), site("main.e", 20), site("main.f", 30), site("main.g", 40))
+
+	growth := diffHeap(before, after)
+	assert.Equal(t, int64(4000), growth.bytes)
+	assert.Equal(t, []heapSite{
+		site("main.c", 2000),
+		site("main.a", 1000),
+		site("main.g", 40),
+		site("main.f", 30),
+		site("main.e", 20),
+	}, growth.top, "Expected sites with the most growth, without shrinking sites")
+}
+
+func TestHeapGrowthError(t *testing.T) {
+	frames := make([]stack.Frame, 6)
+	for i := range frames {
+		frames[i] = stack.Frame{Function: "main.f" + string(rune('0'+i)), File: "/path/to/main.go", Line: 10 + i}
+	}
+
+	err := heapGrowthError(heapGrowth{bytes: 3 << 20}, 1<<20)
+	assert.EqualError(t, err, "found 3.0 MiB of heap growth, more than the budget of 1.0 MiB")
+
+	err = heapGrowthError(heapGrowth{
+		bytes: 3 << 20,
+		top: []heapSite{
+			{frames: frames[:1], bytes: 2 << 20},
+			{frames: frames, bytes: 1536},
+		},
+	}, 1<<20)
+	assert.EqualError(t, err, `found 3.0 MiB of heap growth, more than the budget of 1.0 MiB, with the most growth allocated at:
+2.0 MiB:
+	main.f0
+		/path/to/main.go:10
+1.5 KiB:
+	main.f0
+		/path/to/main.go:10
+	main.f1
+		/path/to/main.go:11
+	main.f2
+		/path/to/main.go:12
+	main.f3
+		/path/to/main.go:13
+	main.f4
+		/path/to/main.go:14
+	...additional frames elided...`)
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{-512, "-512 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{5 << 20, "5.0 MiB"},
+		{-(5 << 20), "-5.0 MiB"},
+		{3 << 30, "3.0 GiB"},
+		{2048 << 30, "2048.0 GiB"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, formatBytes(tt.n), "formatBytes(%v)", tt.n)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// htmlReport is the data used to render the HTML report for ReportHTML.
+type htmlReport struct {
+	Summary string
+	States  []string
+	Groups  []htmlGroup
+}
+
+type htmlGroup struct {
+	Title      string
+	State      string
+	Search     string
+	Goroutines []htmlGoroutine
+}
+
+type htmlGoroutine struct {
+	ID    int
+	State string
+	Notes string
+	Stack string
+}
+
+// writeHTMLReport writes a self-contained HTML page describing the given
+// leaks to w, grouped as specified by opts.
+func writeHTMLReport(w io.Writer, res findResult, opts *opts) error {
+	report := htmlReport{Summary: pluralize(len(res.stacks), "unexpected goroutine")}
+	states := make(map[string]bool)
+	for _, g := range groupStacks(res.stacks, opts.groupBy) {
+		first := g.stacks[0]
+		hg := htmlGroup{
+			Title: htmlGroupTitle(g, opts.groupBy),
+			State: first.BaseState(),
+		}
+		var search []string
+		for _, s := range g.stacks {
+			hg.Goroutines = append(hg.Goroutines, htmlGoroutine{
+				ID:    s.ID(),
+				State: s.State(),
+				Notes: strings.Join(annotations(s, res, opts), ", "),
+				Stack: s.Truncate(opts.maxFrames).Full(),
+			})
+			search = append(search, s.Full())
+		}
+		hg.Search = strings.ToLower(strings.Join(search, "\n"))
+		report.Groups = append(report.Groups, hg)
+		states[hg.State] = true
+	}
+	for state := range states {
+		report.States = append(report.States, state)
+	}
+	sort.Strings(report.States)
+
+	return _htmlReportTmpl.Execute(w, report)
+}
+
+// htmlGroupTitle returns the summary shown for a group of leaks.
+func htmlGroupTitle(g stackGroup, groupBy Grouping) string {
+	s := g.stacks[0]
+	fn := s.FirstFunction()
+	if fn == "" {
+		fn = "no frames on the stack"
+	}
+	if len(g.stacks) == 1 {
+		return "Goroutine " + strconv.Itoa(s.ID()) + " in state " + s.State() + ", with " + fn
+	}
+	if groupBy == GroupByCreatedBy {
+		if g.key == "" {
+			return strconv.Itoa(len(g.stacks)) + " goroutines not created by another goroutine"
+		}
+		return strconv.Itoa(len(g.stacks)) + " goroutines created by " + g.key
+	}
+	return strconv.Itoa(len(g.stacks)) + " goroutines in state " + s.State() + ", with " + fn
+}
+
+var _htmlReportTmpl = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>goleak: {{.Summary}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+details { margin: 0.25em 0; }
+summary { cursor: pointer; }
+.group > summary { font-weight: bold; }
+.goroutine { margin-left: 1.5em; }
+.state { color: #8a6d00; }
+.notes { color: #555; font-style: italic; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; }
+#controls { margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1>{{.Summary}}</h1>
+<div id="controls">
+<input id="filter" type="search" placeholder="Filter by function, file or package" size="50">
+<select id="state">
+<option value="">All states</option>
+{{- range .States}}
+<option>{{.}}</option>
+{{- end}}
+</select>
+<button id="expand" type="button">Expand all</button>
+<button id="collapse" type="button">Collapse all</button>
+</div>
+{{- range .Groups}}
+<details class="group" data-state="{{.State}}" data-search="{{.Search}}">
+<summary>{{.Title}}</summary>
+{{- range .Goroutines}}
+<details class="goroutine">
+<summary>Goroutine {{.ID}} <span class="state">[{{.State}}]</span>{{if .Notes}} <span class="notes">({{.Notes}})</span>{{end}}</summary>
+<pre>{{.Stack}}</pre>
+</details>
+{{- end}}
+</details>
+{{- end}}
+<script>
+(function() {
+	var filter = document.getElementById("filter");
+	var state = document.getElementById("state");
+	var groups = document.querySelectorAll(".group");
+	function update() {
+		var text = filter.value.toLowerCase();
+		groups.forEach(function(g) {
+			var match = g.dataset.search.indexOf(text) >= 0 &&
+				(state.value === "" || g.dataset.state === state.value);
+			g.style.display = match ? "" : "none";
+		});
+	}
+	function setOpen(open) {
+		document.querySelectorAll("details").forEach(function(d) { d.open = open; });
+	}
+	filter.addEventListener("input", update);
+	state.addEventListener("change", update);
+	document.getElementById("expand").addEventListener("click", function() { setOpen(true); });
+	document.getElementById("collapse").addEventListener("click", function() { setOpen(false); });
+})();
+</script>
+</body>
+</html>
+`))
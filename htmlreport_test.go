@@ -0,0 +1,83 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestReportHTML(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Find(ReportHTML(&buf)), "Expected no leaks")
+	assert.Empty(t, buf.String(), "Expected no report without leaks")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	require.Error(t, Find(testOptions(), ReportHTML(&buf)), "Expected a leak")
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "<!DOCTYPE html>"), "Expected an HTML page, got %v", out)
+	assert.Contains(t, out, "<title>goleak: 1 unexpected goroutine</title>")
+	assert.Contains(t, out, "go.uber.org/goleak.(*blockedG).run")
+	assert.Contains(t, out, `<option>chan receive</option>`)
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	parse := func(s string) stack.Stack {
+		st, err := stack.ParseStack(s)
+		require.NoError(t, err)
+		return st
+	}
+	worker := `goroutine %v [chan receive, 3 minutes]:
+main.worker[...](0xc000012345)
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+`
+	stacks := []stack.Stack{
+		parse(strings.Replace(worker, "%v", "6", 1)),
+		parse(strings.Replace(worker, "%v", "7", 1)),
+		parse("goroutine 8 [select]:\nmain.<ticker>()\n\t/path/to/main.go:30 +0x2\n"),
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeHTMLReport(&buf, findResult{stacks: stacks}, buildOpts(GroupBy(GroupBySignature))))
+	out := buf.String()
+
+	assert.Contains(t, out, "<h1>3 unexpected goroutines</h1>")
+	assert.Contains(t, out, `<details class="group" data-state="chan receive" data-search="goroutine 6 [chan receive, 3 minutes]:`)
+	assert.Contains(t, out, "<summary>2 goroutines in state chan receive, 3 minutes, with main.worker[...]</summary>")
+	assert.Contains(t, out, `<summary>Goroutine 7 <span class="state">[chan receive, 3 minutes]</span> <span class="notes">(blocked for 3m0s)</span></summary>`)
+	assert.Contains(t, out, "<summary>Goroutine 8 in state select, with main.&lt;ticker&gt;</summary>", "Expected stacks to be escaped")
+	assert.NotContains(t, out, "main.<ticker>")
+	assert.Contains(t, out, "<option>chan receive</option>\n<option>select</option>")
+
+	buf.Reset()
+	require.NoError(t, writeHTMLReport(&buf, findResult{stacks: stacks}, buildOpts(GroupBy(GroupByCreatedBy))))
+	assert.Contains(t, buf.String(), "<summary>2 goroutines created by main.main</summary>")
+	assert.Contains(t, buf.String(), "<summary>Goroutine 8 in state select, with main.&lt;ticker&gt;</summary>")
+}
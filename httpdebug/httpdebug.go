@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package httpdebug serves the goroutines that goleak reports as suspected
+// leaks in a running process over HTTP, similar to net/http/pprof, so
+// operators can look at a filtered report instead of a raw goroutine dump.
+//
+// The handler is typically registered next to other debug endpoints,
+// ignoring the goroutines that were running once the process started up:
+//
+//	http.Handle("/debug/goleak", httpdebug.Handler(goleak.IgnoreCurrent()))
+package httpdebug
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"go.uber.org/goleak"
+)
+
+// Handler returns an http.Handler that looks for leaks using goleak.Find
+// with the given options on each request, and responds with the error that
+// describes the suspected leaks, or a short message if there are none.
+//
+// Requests with the query parameter format=json get the report written by
+// goleak.ReportJSON instead.
+//
+// Since a long-lived goroutine in a running process is not expected to exit,
+// Find doesn't retry by default, which can be changed using goleak.MaxRetries.
+// If the goroutine stacks can't be parsed, the handler responds with an
+// internal server error.
+func Handler(options ...goleak.Option) http.Handler {
+	opts := append([]goleak.Option{goleak.MaxRetries(0)}, options...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch format := r.URL.Query().Get("format"); format {
+		case "", "text":
+			serveText(w, opts)
+		case "json":
+			serveJSON(w, opts)
+		default:
+			http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+		}
+	})
+}
+
+// serveText responds with the message of the error returned by goleak.Find.
+func serveText(w http.ResponseWriter, opts []goleak.Option) {
+	err := goleak.Find(opts...)
+	var leakErr *goleak.LeakError
+	if err != nil && !errors.As(err, &leakErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err == nil {
+		fmt.Fprintln(w, "goleak: no suspected leaks")
+		return
+	}
+	fmt.Fprintf(w, "goleak: %v\n", err)
+}
+
+// serveJSON responds with the JSON report of the suspected leaks.
+func serveJSON(w http.ResponseWriter, opts []goleak.Option) {
+	var buf bytes.Buffer
+	opts = append(opts[:len(opts):len(opts)], goleak.ReportJSON(&buf))
+	err := goleak.Find(opts...)
+	var leakErr *goleak.LeakError
+	if err != nil && !errors.As(err, &leakErr) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if buf.Len() == 0 {
+		// The report is only written if there are leaks.
+		fmt.Fprintln(w, `{"goroutines":[]}`)
+		return
+	}
+	buf.WriteTo(w)
+}
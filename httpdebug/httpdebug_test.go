@@ -0,0 +1,100 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package httpdebug
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func worker(wg *sync.WaitGroup, started chan<- struct{}, done <-chan struct{}) {
+	defer wg.Done()
+	started <- struct{}{}
+	<-done
+}
+
+func get(t *testing.T, h http.Handler, url string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler()
+
+	rec := get(t, h, "/debug/goleak")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "goleak: no suspected leaks\n", rec.Body.String())
+
+	rec = get(t, h, "/debug/goleak?format=json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"goroutines":[]}`, rec.Body.String())
+
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	wg.Add(1)
+	go worker(&wg, started, done)
+	<-started
+
+	rec = get(t, h, "/debug/goleak")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "goleak: found unexpected goroutines")
+	assert.Contains(t, rec.Body.String(), "go.uber.org/goleak/httpdebug.worker")
+
+	rec = get(t, h, "/debug/goleak?format=json")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var report struct {
+		Goroutines []struct {
+			FirstFunction string `json:"firstFunction"`
+		} `json:"goroutines"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+	require.Len(t, report.Goroutines, 1)
+	assert.Equal(t, "go.uber.org/goleak/httpdebug.worker", report.Goroutines[0].FirstFunction)
+
+	h = Handler(goleak.IgnoreTopFunction("go.uber.org/goleak/httpdebug.worker"))
+	rec = get(t, h, "/debug/goleak")
+	assert.Equal(t, "goleak: no suspected leaks\n", rec.Body.String(), "Expected options to be used")
+}
+
+func TestHandlerUnknownFormat(t *testing.T) {
+	rec := get(t, Handler(), "/debug/goleak?format=xml")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `unknown format "xml"`)
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+)
+
+// ignoreRules is the format of the files read by IgnoreFromFile.
+type ignoreRules struct {
+	TopFunctions    []string `json:"topFunctions"`
+	AnyFunctions    []string `json:"anyFunctions"`
+	CreatedBy       []string `json:"createdBy"`
+	StackRegexes    []string `json:"stackRegexes"`
+	PackagePrefixes []string `json:"packagePrefixes"`
+}
+
+// IgnoreFromFile ignores the goroutines described by the rules in the
+// specified JSON file, so that a list of known background goroutines can be
+// shared by many packages or repositories rather than repeated in each:
+//
+//	{
+//		"topFunctions": ["go.opencensus.io/stats/view.(*worker).start"],
+//		"anyFunctions": ["example.com/pool.(*Pool).run"],
+//		"createdBy": ["example.com/driver.(*Conn).start"],
+//		"stackRegexes": ["(?s)/pkg/cache/.*created by main\\.main"],
+//		"packagePrefixes": ["github.com/Shopify/sarama"]
+//	}
+//
+// Each rule is matched like the option with the same name, e.g.,
+// IgnoreTopFunction for "topFunctions", and all fields are optional.
+// The file is read when the option is created, and it panics if the file
+// can't be read or has unknown fields or invalid regular expressions.
+func IgnoreFromFile(path string) Option {
+	f, err := os.Open(path)
+	if err != nil {
+		panic(fmt.Sprintf("goleak: failed to read ignore rules: %v", err))
+	}
+	defer f.Close()
+
+	options, err := parseIgnoreRules(f)
+	if err != nil {
+		panic(fmt.Sprintf("goleak: failed to read ignore rules from %v: %v", path, err))
+	}
+	return optionFunc(func(opts *opts) {
+		for _, option := range options {
+			option.apply(opts)
+		}
+	})
+}
+
+// parseIgnoreRules parses the ignore rules read by IgnoreFromFile, and
+// returns the options for them.
+func parseIgnoreRules(r io.Reader) ([]Option, error) {
+	dec := json.NewDecoder(r)
+	// Catch typos in field names, which would otherwise silently ignore rules.
+	dec.DisallowUnknownFields()
+	var rules ignoreRules
+	if err := dec.Decode(&rules); err != nil {
+		return nil, err
+	}
+
+	var options []Option
+	for _, f := range rules.TopFunctions {
+		options = append(options, IgnoreTopFunction(f))
+	}
+	for _, f := range rules.AnyFunctions {
+		options = append(options, IgnoreAnyFunction(f))
+	}
+	for _, f := range rules.CreatedBy {
+		options = append(options, IgnoreCreatedBy(f))
+	}
+	for _, pattern := range rules.StackRegexes {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return nil, err
+		}
+		options = append(options, IgnoreStackRegex(pattern))
+	}
+	if len(rules.PackagePrefixes) > 0 {
+		options = append(options, IgnorePackagePrefix(rules.PackagePrefixes...))
+	}
+	return options, nil
+}
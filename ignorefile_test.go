@@ -0,0 +1,139 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestIgnoreFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "goleak.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"topFunctions": ["go.uber.org/goleak.(*blockedG).run"]}`), 0o644))
+
+	defer startBlockedG().unblock()
+	require.Error(t, Find(testOptions()), "Expected blockedG to be reported")
+	require.NoError(t, Find(testOptions(), IgnoreFromFile(path)), "Expected blockedG to be ignored")
+
+	assert.Panics(t, func() { IgnoreFromFile(filepath.Join(dir, "missing.json")) },
+		"Expected missing file to panic")
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"topFunction": ["main.top"]}`), 0o644))
+	assert.PanicsWithValue(t,
+		`goleak: failed to read ignore rules from `+invalid+`: json: unknown field "topFunction"`,
+		func() { IgnoreFromFile(invalid) })
+}
+
+func TestParseIgnoreRules(t *testing.T) {
+	const rules = `{
+		"topFunctions": ["main.top"],
+		"anyFunctions": ["main.any"],
+		"createdBy": ["main.creator"],
+		"stackRegexes": ["/path/to/regex\\.go"],
+		"packagePrefixes": ["example.com/lib"]
+	}`
+	options, err := parseIgnoreRules(strings.NewReader(rules))
+	require.NoError(t, err)
+	opts := buildOpts(options...)
+
+	tests := []struct {
+		msg   string
+		stack string
+		want  bool
+	}{
+		{
+			msg:   "top function",
+			stack: "main.top()\n\t/path/to/main.go:10 +0x1f\n",
+			want:  true,
+		},
+		{
+			msg:   "any function",
+			stack: "main.blocked()\n\t/path/to/main.go:10 +0x1f\nmain.any()\n\t/path/to/main.go:20 +0x1f\n",
+			want:  true,
+		},
+		{
+			msg:   "created by",
+			stack: "main.blocked()\n\t/path/to/main.go:10 +0x1f\ncreated by main.creator in goroutine 1\n\t/path/to/main.go:30 +0x1f\n",
+			want:  true,
+		},
+		{
+			msg:   "stack regex",
+			stack: "main.blocked()\n\t/path/to/regex.go:10 +0x1f\n",
+			want:  true,
+		},
+		{
+			msg:   "package prefix",
+			stack: "example.com/lib/pool.run()\n\t/path/to/pool.go:10 +0x1f\n",
+			want:  true,
+		},
+		{
+			msg:   "no rules match",
+			stack: "main.blocked()\n\t/path/to/main.go:10 +0x1f\n",
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack("goroutine 7 [chan receive]:\n" + tt.stack)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, opts.filter(s))
+		})
+	}
+}
+
+func TestParseIgnoreRulesErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		rules   string
+		wantErr string
+	}{
+		{
+			msg:     "invalid JSON",
+			rules:   `{"topFunctions": `,
+			wantErr: "unexpected EOF",
+		},
+		{
+			msg:     "unknown field",
+			rules:   `{"topFunction": ["main.top"]}`,
+			wantErr: `unknown field "topFunction"`,
+		},
+		{
+			msg:     "invalid regex",
+			rules:   `{"stackRegexes": ["(main"]}`,
+			wantErr: "missing closing )",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := parseIgnoreRules(strings.NewReader(tt.rules))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"go.uber.org/goleak/stack"
+)
+
+// jsonReport is the JSON report written for the ReportJSON option.
+type jsonReport struct {
+	Goroutines []jsonGoroutine `json:"goroutines"`
+}
+
+type jsonGoroutine struct {
+	ID            int         `json:"id"`
+	State         string      `json:"state"`
+	FirstFunction string      `json:"firstFunction"`
+	Frames        []jsonFrame `json:"frames"`
+	CreatedBy     *jsonFrame  `json:"createdBy,omitempty"`
+
+	// WaitSeconds is how long the goroutine has been blocked, which the
+	// runtime only reports in minutes, once it's at least a minute.
+	WaitSeconds int64 `json:"waitSeconds,omitempty"`
+
+	// Ancestors are only reported with GODEBUG=tracebackancestors=N.
+	Ancestors []jsonAncestor `json:"ancestors,omitempty"`
+}
+
+type jsonAncestor struct {
+	ID        int         `json:"id"`
+	Frames    []jsonFrame `json:"frames"`
+	CreatedBy *jsonFrame  `json:"createdBy,omitempty"`
+}
+
+type jsonFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+}
+
+func newJSONFrame(f stack.Frame) jsonFrame {
+	return jsonFrame{Function: f.Function, File: f.File, Line: f.Line}
+}
+
+// newJSONFrames converts the given frames, and the "created by" frame,
+// which is nil for the zero Frame.
+func newJSONFrames(frames []stack.Frame, createdBy stack.Frame) ([]jsonFrame, *jsonFrame) {
+	converted := make([]jsonFrame, 0, len(frames))
+	for _, f := range frames {
+		converted = append(converted, newJSONFrame(f))
+	}
+	if createdBy.Function == "" {
+		return converted, nil
+	}
+	f := newJSONFrame(createdBy)
+	return converted, &f
+}
+
+// writeJSONReport writes a JSON report of the given leaked goroutines to w,
+// followed by a newline.
+func writeJSONReport(w io.Writer, stacks []stack.Stack) {
+	report := jsonReport{Goroutines: make([]jsonGoroutine, 0, len(stacks))}
+	for _, s := range stacks {
+		g := jsonGoroutine{
+			ID:            s.ID(),
+			State:         s.State(),
+			FirstFunction: s.FirstFunction(),
+			WaitSeconds:   int64(s.WaitDuration() / time.Second),
+		}
+		g.Frames, g.CreatedBy = newJSONFrames(s.Frames(), s.CreatedBy())
+		for _, a := range s.Ancestors() {
+			ja := jsonAncestor{ID: a.ID}
+			ja.Frames, ja.CreatedBy = newJSONFrames(a.Frames, a.CreatedBy)
+			g.Ancestors = append(g.Ancestors, ja)
+		}
+		report.Goroutines = append(report.Goroutines, g)
+	}
+
+	// Errors writing the report are ignored, as documented by ReportJSON.
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, Find(ReportJSON(&buf)), "Expected no leaks")
+	assert.Empty(t, buf.String(), "Expected no report without leaks")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	require.Error(t, Find(testOptions(), ReportJSON(&buf)), "Expected a leak")
+
+	var report jsonReport
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &report), "Report should be valid JSON")
+	require.Len(t, report.Goroutines, 1)
+
+	g := report.Goroutines[0]
+	assert.NotZero(t, g.ID)
+	assert.Equal(t, "chan receive", g.State)
+	assert.Equal(t, "go.uber.org/goleak.(*blockedG).run", g.FirstFunction)
+	require.NotEmpty(t, g.Frames)
+	assert.Equal(t, g.FirstFunction, g.Frames[0].Function)
+	assert.Contains(t, g.Frames[0].File, "utils_test.go")
+	require.NotNil(t, g.CreatedBy)
+	assert.Equal(t, "go.uber.org/goleak.startBlockedG", g.CreatedBy.Function)
+}
+
+func TestWriteJSONReport(t *testing.T) {
+	worker, err := stack.ParseStack(`goroutine 6 [chan receive, 3 minutes]:
+main.worker(0xc000012345)
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+[originating from goroutine 1]:
+main.main(...)
+	/path/to/main.go:9 +0x6
+`)
+	require.NoError(t, err)
+	main, err := stack.ParseStack(`goroutine 1 [select]:
+main.main()
+	/path/to/main.go:10 +0x1f
+`)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	writeJSONReport(&buf, []stack.Stack{worker, main})
+	assert.JSONEq(t, `{"goroutines": [
+		{
+			"id": 6,
+			"state": "chan receive, 3 minutes",
+			"firstFunction": "main.worker",
+			"frames": [{"function": "main.worker", "file": "/path/to/main.go", "line": 20}],
+			"createdBy": {"function": "main.main", "file": "/path/to/main.go", "line": 9},
+			"waitSeconds": 180,
+			"ancestors": [
+				{"id": 1, "frames": [{"function": "main.main", "file": "/path/to/main.go", "line": 9}]}
+			]
+		},
+		{
+			"id": 1,
+			"state": "select",
+			"firstFunction": "main.main",
+			"frames": [{"function": "main.main", "file": "/path/to/main.go", "line": 10}]
+		}
+	]}`, buf.String())
+	assert.Equal(t, 1, bytes.Count(buf.Bytes(), []byte("\n")), "Report should be a single line")
+}
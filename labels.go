@@ -0,0 +1,265 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// labelSet is a set of pprof labels.
+type labelSet map[string]string
+
+// contains reports whether all the labels in other are in the set.
+func (l labelSet) contains(other labelSet) bool {
+	for k, v := range other {
+		if got, ok := l[k]; !ok || got != v {
+			return false
+		}
+	}
+	return true
+}
+
+// goroutineLabels holds the pprof labels of goroutines.
+type goroutineLabels struct {
+	// fromStacks is set if the runtime includes labels in the stacks of
+	// goroutines, which is the case with GODEBUG=tracebacklabels=1 in
+	// Go 1.27 and later. Otherwise, labels are matched from the goroutine
+	// profile by the key of their stacks.
+	fromStacks bool
+	byStack    map[string][]labelSet
+}
+
+// lookupLabels returns the pprof labels of the given goroutines.
+func lookupLabels(stacks []stack.Stack) *goroutineLabels {
+	for _, s := range stacks {
+		if s.Labels() != nil {
+			return &goroutineLabels{fromStacks: true}
+		}
+	}
+	return &goroutineLabels{byStack: profileLabels()}
+}
+
+// of returns the possible sets of labels of the given goroutine.
+// Goroutines with the same stack are indistinguishable in the profile,
+// so the labels of all of them are returned.
+func (gl *goroutineLabels) of(s stack.Stack) []labelSet {
+	if gl.fromStacks {
+		return []labelSet{s.Labels()}
+	}
+	return gl.byStack[labelsKey(s.Frames())]
+}
+
+// profileLabels returns the pprof labels of all running goroutines
+// from the goroutine profile, by the key of their stacks.
+// Goroutines with the same stack but different labels have separate entries.
+func profileLabels() map[string][]labelSet {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		return nil
+	}
+	return parseGoroutineLabels(&buf)
+}
+
+// parseGoroutineLabels parses the labels of goroutines from a goroutine
+// profile with debug=1, which groups goroutines with the same stack and
+// labels into records such as:
+//
+//	1 @ 0x47d82a 0x41512e 0x414c72 0x4e1519 0x4835c1
+//	# labels: {"worker":"bg"}
+//	#	0x4e1518	main.main.func1.1+0x18	/path/to/main.go:13
+func parseGoroutineLabels(r io.Reader) map[string][]labelSet {
+	var (
+		byStack = make(map[string][]labelSet)
+		labels  labelSet
+		frames  []stack.Frame
+	)
+	flush := func() {
+		if frames != nil {
+			key := labelsKey(frames)
+			byStack[key] = append(byStack[key], labels)
+		}
+		labels, frames = nil, nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "# labels: "):
+			// Labels are formatted as quoted strings, which are
+			// valid JSON for the printable labels used in practice.
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels); err != nil {
+				labels = labelSet{}
+			}
+		case strings.HasPrefix(line, "#\t"):
+			if f, ok := parseProfileFrame(line); ok {
+				frames = append(frames, f)
+			}
+		}
+	}
+	flush()
+	return byStack
+}
+
+// parseProfileFrame parses a frame of a goroutine profile record, e.g.,
+// "#\t0x4e1518\tmain.main.func1.1+0x18\t/path/to/main.go:13".
+// The columns are padded with additional tabs.
+func parseProfileFrame(line string) (stack.Frame, bool) {
+	var fields []string
+	for _, field := range strings.Split(line, "\t") {
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+	if len(fields) != 4 {
+		return stack.Frame{}, false
+	}
+
+	fn, fileLine := fields[2], fields[3]
+	if idx := strings.LastIndex(fn, "+0x"); idx > 0 {
+		fn = fn[:idx]
+	}
+	idx := strings.LastIndex(fileLine, ":")
+	if idx < 0 {
+		return stack.Frame{}, false
+	}
+	lineNum, err := strconv.Atoi(fileLine[idx+1:])
+	if err != nil {
+		return stack.Frame{}, false
+	}
+	return stack.Frame{Function: fn, File: fileLine[:idx], Line: lineNum}, true
+}
+
+// labelsKey returns the key used to match the stack of a goroutine with
+// the goroutine profile. Functions in the runtime are skipped, since they're
+// hidden differently in the profile and the stacks of goroutines.
+func labelsKey(frames []stack.Frame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		if isRuntimePackage(f.Package()) {
+			continue
+		}
+		b.WriteString(f.Function)
+		b.WriteString(" ")
+		b.WriteString(f.File)
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(f.Line))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// hasIgnoredLabels reports whether the given goroutine has any of the sets of
+// labels to ignore. Goroutines with the same stack as the given goroutine may
+// be indistinguishable in the profile, so they must all have matching labels.
+func (vo *opts) hasIgnoredLabels(s stack.Stack, labels *goroutineLabels) bool {
+	sets := labels.of(s)
+	if len(sets) == 0 {
+		return false
+	}
+	for _, labels := range sets {
+		var matched bool
+		for _, ignore := range vo.ignoreLabels {
+			if labels.contains(ignore) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// hasOnlyLabels reports whether the given goroutine should be considered
+// for OnlyPprofLabels. Goroutines with the same stack as the given goroutine
+// may be indistinguishable in the profile, so it's considered if any of them
+// have all the labels to consider.
+func (vo *opts) hasOnlyLabels(s stack.Stack, labels *goroutineLabels) bool {
+	if len(vo.onlyLabels) == 0 {
+		return true
+	}
+	for _, set := range labels.of(s) {
+		matched := true
+		for _, only := range vo.onlyLabels {
+			if !set.contains(only) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// _trackLabel is the pprof label used by Track to label a test's goroutines.
+const _trackLabel = "goleak.test"
+
+// TestingTrackT is the minimal subset of testing.TB used by Track.
+type TestingTrackT interface {
+	TestingCleanupT
+	Name() string
+}
+
+// Track labels the goroutine running the given test with a pprof label
+// specific to the test, and marks the test as failed if any goroutines with
+// the label are found by Find when the test and its subtests complete.
+// Goroutines inherit the labels of the goroutine that starts them, so only
+// goroutines started by the test, directly or indirectly, are considered,
+// which makes it safe to use in tests that run in parallel with other tests:
+//
+//	func TestServer(t *testing.T) {
+//		t.Parallel()
+//		goleak.Track(t)
+//		// test logic here.
+//	}
+//
+// Track must be called from the goroutine running the test, and replaces any
+// pprof labels of that goroutine. The returned context has the label, for
+// use with pprof.SetGoroutineLabels or pprof.Do in goroutines that start
+// work on behalf of the test, such as a shared worker pool.
+func Track(t TestingTrackT, options ...Option) context.Context {
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels(_trackLabel, t.Name()))
+	pprof.SetGoroutineLabels(ctx)
+	t.Cleanup(func() {
+		if h, ok := t.(helperT); ok {
+			h.Helper()
+		}
+		pprof.SetGoroutineLabels(context.Background())
+		// Copy the options so we don't modify the caller's slice.
+		VerifyNone(t, append(options[:len(options):len(options)], OnlyPprofLabels(_trackLabel, t.Name()))...)
+	})
+	return ctx
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestIgnorePprofLabels(t *testing.T) {
+	var labeled *blockedG
+	pprof.Do(context.Background(), pprof.Labels("worker", "bg", "pool", "default"), func(context.Context) {
+		// Goroutines inherit the labels of the goroutine that starts them.
+		labeled = startBlockedG()
+	})
+	defer labeled.unblock()
+
+	require.NoError(t, Find(testOptions(), IgnorePprofLabels("worker", "bg")),
+		"Goroutine with matching labels should be ignored")
+	require.NoError(t, Find(testOptions(), IgnorePprofLabels("worker", "other"), IgnorePprofLabels("pool", "default")),
+		"Goroutine matching any set of labels should be ignored")
+	require.Error(t, Find(testOptions(), IgnorePprofLabels("worker", "bg", "pool", "other")),
+		"Goroutine must have all labels in the set to be ignored")
+	require.Error(t, Find(testOptions(), IgnorePprofLabels()),
+		"No labels should not ignore any goroutines")
+
+	unlabeled := startBlockedG()
+	defer unlabeled.unblock()
+
+	err := Find(testOptions(), IgnorePprofLabels("worker", "bg"))
+	require.Error(t, err, "Goroutines with the same stack but different labels should be reported")
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr))
+	assert.Len(t, leakErr.Stacks(), 2, "Goroutines with the same stack can't be told apart")
+
+	assert.Panics(t, func() { IgnorePprofLabels("worker") }, "Expected uneven arguments to panic")
+}
+
+func TestOnlyPprofLabels(t *testing.T) {
+	var labeled *blockedG
+	pprof.Do(context.Background(), pprof.Labels("test", "a", "pool", "default"), func(context.Context) {
+		labeled = startBlockedG()
+	})
+	defer labeled.unblock()
+
+	require.Error(t, Find(testOptions(), OnlyPprofLabels("test", "a")),
+		"Goroutine with matching labels should be considered")
+	require.NoError(t, Find(testOptions(), OnlyPprofLabels("test", "b")),
+		"Goroutine without matching labels should be ignored")
+	require.NoError(t, Find(testOptions(), OnlyPprofLabels("test", "a"), OnlyPprofLabels("pool", "other")),
+		"Goroutine must match every set of labels to be considered")
+	require.Error(t, Find(testOptions(), OnlyPprofLabels()),
+		"No labels should consider all goroutines")
+
+	assert.Panics(t, func() { OnlyPprofLabels("test") }, "Expected uneven arguments to panic")
+}
+
+// fakeTrackT is a fakeCleanupT with a name.
+type fakeTrackT struct {
+	fakeCleanupT
+
+	name string
+}
+
+func (ft *fakeTrackT) Name() string {
+	return ft.name
+}
+
+func TestTrack(t *testing.T) {
+	// Goroutines started by other tests are not labeled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() { <-done }()
+
+	ft := &fakeTrackT{name: "TestTrack/leak"}
+	ctx := Track(ft, testOptions())
+	assert.Equal(t, "TestTrack/leak", labelOf(ctx, _trackLabel))
+	tracked := startBlockedG()
+	defer tracked.unblock()
+
+	require.Len(t, ft.cleanups, 1, "Expected check to be registered as a cleanup")
+	ft.runCleanups()
+	require.Len(t, ft.errors, 1, "Expected goroutine started by the test to be reported")
+	assert.Contains(t, ft.errors[0], "go.uber.org/goleak.(*blockedG).run")
+	assert.NotContains(t, ft.errors[0], "go.uber.org/goleak.TestTrack.func1", "Goroutines of other tests should be ignored")
+
+	ft = &fakeTrackT{name: "TestTrack/clean"}
+	Track(ft, testOptions())
+	ft.runCleanups()
+	assert.Empty(t, ft.errors, "Goroutines of other tests should be ignored")
+
+	unlabeled := startBlockedG()
+	defer unlabeled.unblock()
+	require.NoError(t, Find(testOptions(), OnlyPprofLabels(_trackLabel, "TestTrack/clean")),
+		"Labels should be reset once the test completes")
+}
+
+func TestTrackTracebackLabels(t *testing.T) {
+	// With labels in stacks, goroutines with the same stack can be told apart.
+	t.Setenv("GODEBUG", "tracebacklabels=1")
+
+	sibling := startBlockedG()
+	defer sibling.unblock()
+
+	ft := &fakeTrackT{name: "TestTrackTracebackLabels"}
+	Track(ft, testOptions())
+	tracked := startBlockedG()
+	defer tracked.unblock()
+
+	stacks, err := stack.All()
+	require.NoError(t, err)
+	if !lookupLabels(stacks).fromStacks {
+		ft.runCleanups()
+		t.Skip("runtime doesn't include labels in stacks")
+	}
+
+	err = Find(testOptions(), OnlyPprofLabels(_trackLabel, "TestTrackTracebackLabels"))
+	ft.runCleanups()
+	require.Error(t, err, "Expected goroutine started by the test to be reported")
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr))
+	assert.Len(t, leakErr.Stacks(), 1, "Goroutines of other tests with the same stack should be ignored")
+	assert.Len(t, ft.errors, 1, "Expected goroutine started by the test to be reported")
+}
+
+// labelOf returns the value of the pprof label with the given key.
+func labelOf(ctx context.Context, key string) string {
+	v, _ := pprof.Label(ctx, key)
+	return v
+}
+
+func TestParseGoroutineLabels(t *testing.T) {
+	const profile = "goroutine profile: total 4\n" +
+		"2 @ 0x47d82a 0x41512e 0x414c72 0x4e1459 0x4835c1\n" +
+		"#\t0x4e1458\tmain.main.func2+0x18\t/path/to/main.go:15\n" +
+		"\n" +
+		"1 @ 0x47d82a 0x41512e 0x414c72 0x4e1519 0x4835c1\n" +
+		"# labels: {\"pool\":\"default\", \"worker\":\"bg\"}\n" +
+		"#\t0x4e1518\tmain.worker+0x18\t\t/path/to/main.go:13\n" +
+		"#\t0x4e1519\tmain.main.func1+0x1f\t/path/to/main.go:20\n" +
+		"\n" +
+		"1 @ 0x47d82a 0x41512e 0x414c72 0x4e1519 0x4835c1\n" +
+		"# labels: {\"worker\":\"fg\"}\n" +
+		"#\t0x4e1518\tmain.worker+0x18\t\t/path/to/main.go:13\n" +
+		"#\t0x4e1519\tmain.main.func1+0x1f\t/path/to/main.go:20\n"
+
+	byStack := parseGoroutineLabels(bytes.NewBufferString(profile))
+	assert.Equal(t, map[string][]labelSet{
+		"main.main.func2 /path/to/main.go:15\n": {nil},
+		"main.worker /path/to/main.go:13\nmain.main.func1 /path/to/main.go:20\n": {
+			{"pool": "default", "worker": "bg"},
+			{"worker": "fg"},
+		},
+	}, byStack)
+
+	worker, err := stack.ParseStack(`goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+main.worker()
+	/path/to/main.go:13 +0x19
+main.main.func1()
+	/path/to/main.go:20 +0x20
+created by main.main in goroutine 1
+	/path/to/main.go:19 +0x5f
+`)
+	require.NoError(t, err)
+	assert.Contains(t, byStack, labelsKey(worker.Frames()), "Runtime functions should not affect the key")
+
+	tests := []struct {
+		msg    string
+		ignore []labelSet
+		want   bool
+	}{
+		{"all goroutines match", []labelSet{{"worker": "bg"}, {"worker": "fg"}}, true},
+		{"one goroutine matches", []labelSet{{"worker": "bg"}}, false},
+		{"no goroutines match", []labelSet{{"worker": "other"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := &opts{ignoreLabels: tt.ignore}
+			assert.Equal(t, tt.want, opts.hasIgnoredLabels(worker, &goroutineLabels{byStack: byStack}))
+		})
+	}
+}
+
+func TestParseProfileFrame(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   stack.Frame
+		wantOK bool
+	}{
+		{
+			line:   "#\t0x4e1518\tmain.main.func1.1+0x18\t/path/to/main.go:13",
+			want:   stack.Frame{Function: "main.main.func1.1", File: "/path/to/main.go", Line: 13},
+			wantOK: true,
+		},
+		{
+			line:   "#\t0x4e13bc\tmain.main+0x11c\t\t\t\t/path/to/main.go:17",
+			want:   stack.Frame{Function: "main.main", File: "/path/to/main.go", Line: 17},
+			wantOK: true,
+		},
+		{line: "#\t0x4e1518\tmain.main+0x18"},
+		{line: "#\t0x4e1518\tmain.main+0x18\t/path/to/main.go"},
+		{line: "#\t0x4e1518\tmain.main+0x18\t/path/to/main.go:x"},
+	}
+	for _, tt := range tests {
+		got, ok := parseProfileFrame(tt.line)
+		assert.Equal(t, tt.wantOK, ok, "parseProfileFrame(%q)", tt.line)
+		assert.Equal(t, tt.want, got, "parseProfileFrame(%q)", tt.line)
+	}
+}
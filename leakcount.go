@@ -0,0 +1,140 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// _updateLeakCountEnv is the environment variable that makes LeakCountFile
+// record the current leak count, even if it's higher than the recorded count.
+const _updateLeakCountEnv = "GOLEAK_UPDATE"
+
+// Environment variables used by Bazel and other test runners to split the
+// tests of a package across processes, which LeakCountFile records separate
+// counts for.
+const (
+	_totalShardsEnv = "TEST_TOTAL_SHARDS"
+	_shardIndexEnv  = "TEST_SHARD_INDEX"
+)
+
+// findLeakCount looks for extra goroutines like Find, and compares the number
+// found against the count recorded in opts.leakCountFile.
+func findLeakCount(opts *opts) error {
+	path, err := leakCountPath(opts)
+	if err != nil {
+		return err
+	}
+	recorded, err := readLeakCount(path)
+	update := errors.Is(err, os.ErrNotExist) || os.Getenv(_updateLeakCountEnv) != ""
+	if err != nil && !update {
+		return err
+	}
+
+	// Keep retrying till there are no leaks like Find, rather than stopping
+	// within the recorded count, so that exiting goroutines aren't counted.
+	res, err := findLeaks(opts)
+	if err != nil {
+		return err
+	}
+
+	n := len(res.stacks)
+	if !update && n > recorded {
+		return &LeakError{
+			stacks: res.stacks,
+			msg: fmt.Sprintf("found %v unexpected goroutines, more than the %v recorded in %v, after %v over %v:\n%s%s%s",
+				n, recorded, path, pluralize(res.attempts, "attempt"), res.duration.Round(time.Millisecond),
+				formatStacks(res, opts), formatSuggestions(res.stacks, opts), formatAllStacks(res, opts)),
+		}
+	}
+	if update || n < recorded {
+		return writeLeakCount(path, n)
+	}
+	return nil
+}
+
+// leakCountPath returns the path of the file to record the leak count in,
+// which is specific to the shard if the tests are sharded.
+func leakCountPath(opts *opts) (string, error) {
+	index, total := opts.shardIndex, opts.totalShards
+	if total == 0 {
+		var err error
+		if index, total, err = envShard(); err != nil {
+			return "", err
+		}
+	}
+	if total <= 1 {
+		return opts.leakCountFile, nil
+	}
+
+	path := opts.leakCountFile
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%v.shard-%v-of-%v%v", strings.TrimSuffix(path, ext), index, total, ext), nil
+}
+
+// envShard returns the shard of the tests being run by this process,
+// as set by the test runner, or a total of 0 if the tests aren't sharded.
+func envShard() (index, total int, _ error) {
+	totalEnv := os.Getenv(_totalShardsEnv)
+	if totalEnv == "" {
+		return 0, 0, nil
+	}
+	total, err := strconv.Atoi(totalEnv)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse %v: %v", _totalShardsEnv, err)
+	}
+	if total <= 1 {
+		return 0, total, nil
+	}
+	index, err = strconv.Atoi(os.Getenv(_shardIndexEnv))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to parse %v: %v", _shardIndexEnv, err)
+	}
+	if index < 0 || index >= total {
+		return 0, 0, fmt.Errorf("%v %v is out of range for %v shards", _shardIndexEnv, index, total)
+	}
+	return index, total, nil
+}
+
+func readLeakCount(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read leak count: %w", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse leak count in %v: %v", path, err)
+	}
+	return n, nil
+}
+
+func writeLeakCount(path string, n int) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(n)+"\n"), 0o644); err != nil {
+		return fmt.Errorf("failed to write leak count: %v", err)
+	}
+	return nil
+}
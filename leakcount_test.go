@@ -0,0 +1,153 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeakCountFile(t *testing.T) {
+	t.Setenv(_updateLeakCountEnv, "")
+
+	path := filepath.Join(t.TempDir(), "leaks.count")
+	readCount := func() string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err, "failed to read leak count")
+		return string(b)
+	}
+
+	bg1 := startBlockedG()
+	bg2 := startBlockedG()
+
+	require.NoError(t, Find(testOptions(), LeakCountFile(path)), "Missing file should be created")
+	assert.Equal(t, "2\n", readCount(), "Current count should be recorded")
+
+	require.NoError(t, Find(testOptions(), LeakCountFile(path)), "Same count should not fail")
+	assert.Equal(t, "2\n", readCount(), "Count should not change")
+
+	bg3 := startBlockedG()
+	err := Find(testOptions(), LeakCountFile(path))
+	require.Error(t, err, "More leaks than recorded should fail")
+	assert.Contains(t, err.Error(), "found 3 unexpected goroutines, more than the 2 recorded in "+path)
+	assert.Contains(t, err.Error(), "blockedG")
+	assert.Equal(t, "2\n", readCount(), "Count should not be raised")
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr), "Expected a *LeakError, got %T", err)
+	assert.Len(t, leakErr.Stacks(), 3)
+
+	t.Run("update", func(t *testing.T) {
+		t.Setenv(_updateLeakCountEnv, "1")
+		require.NoError(t, Find(testOptions(), LeakCountFile(path)), "Update should not fail")
+		assert.Equal(t, "3\n", readCount(), "Count should be raised when updating")
+	})
+
+	bg3.unblock()
+	bg2.unblock()
+	require.NoError(t, Find(testOptions(), LeakCountFile(path)), "Fewer leaks than recorded should not fail")
+	assert.Equal(t, "1\n", readCount(), "Count should be lowered")
+
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions(), LeakCountFile(path), ErrorPerLeak())
+	assert.Empty(t, ft.errors, "VerifyNone should use the recorded count")
+
+	bg1.unblock()
+	require.NoError(t, Find(LeakCountFile(path)))
+	assert.Equal(t, "0\n", readCount(), "Count should be lowered to 0")
+}
+
+func TestLeakCountFileErrors(t *testing.T) {
+	t.Setenv(_updateLeakCountEnv, "")
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "invalid.count")
+	require.NoError(t, os.WriteFile(path, []byte("many\n"), 0o644))
+	err := Find(LeakCountFile(path))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to parse leak count")
+
+	err = Find(LeakCountFile(filepath.Join(dir, "missing", "leaks.count")))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to write leak count")
+
+	err = Find(LeakCountFile(dir))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to read leak count")
+}
+
+func TestLeakCountFileSharded(t *testing.T) {
+	t.Setenv(_updateLeakCountEnv, "")
+	t.Setenv(_totalShardsEnv, "4")
+	t.Setenv(_shardIndexEnv, "1")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "leaks.count")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	require.NoError(t, Find(testOptions(), LeakCountFile(path)))
+	b, err := os.ReadFile(filepath.Join(dir, "leaks.shard-1-of-4.count"))
+	require.NoError(t, err, "Count should be recorded for the shard")
+	assert.Equal(t, "1\n", string(b))
+	assert.NoFileExists(t, path, "Count should not be recorded for all shards")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "leaks.shard-2-of-3.count"), []byte("0\n"), 0o644))
+	err = Find(testOptions(), LeakCountFile(path), Shard(2, 3))
+	require.Error(t, err, "Shard should override the environment")
+	assert.Contains(t, err.Error(), "more than the 0 recorded in "+filepath.Join(dir, "leaks.shard-2-of-3.count"))
+
+	require.NoError(t, Find(testOptions(), LeakCountFile(filepath.Join(dir, "leaks")), Shard(0, 2)))
+	assert.FileExists(t, filepath.Join(dir, "leaks.shard-0-of-2"), "Paths without an extension should be suffixed")
+
+	t.Run("not sharded", func(t *testing.T) {
+		t.Setenv(_totalShardsEnv, "1")
+		require.NoError(t, Find(testOptions(), LeakCountFile(path)))
+		assert.FileExists(t, path)
+	})
+}
+
+func TestLeakCountFileShardErrors(t *testing.T) {
+	tests := []struct {
+		total, index string
+		wantErr      string
+	}{
+		{"four", "1", "failed to parse TEST_TOTAL_SHARDS"},
+		{"4", "", "failed to parse TEST_SHARD_INDEX"},
+		{"4", "4", "TEST_SHARD_INDEX 4 is out of range for 4 shards"},
+	}
+
+	path := filepath.Join(t.TempDir(), "leaks.count")
+	for _, tt := range tests {
+		t.Setenv(_totalShardsEnv, tt.total)
+		t.Setenv(_shardIndexEnv, tt.index)
+		err := Find(LeakCountFile(path))
+		require.Error(t, err, "TEST_TOTAL_SHARDS=%q TEST_SHARD_INDEX=%q", tt.total, tt.index)
+		assert.Contains(t, err.Error(), tt.wantErr)
+	}
+
+	assert.Panics(t, func() { Shard(2, 2) })
+	assert.Panics(t, func() { Shard(-1, 2) })
+}
@@ -21,19 +21,81 @@
 package goleak
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
-	"go.uber.org/goleak/internal/stack"
+	"go.uber.org/goleak/stack"
 )
 
+// Stack is the parsed stack of a single goroutine,
+// which is passed to user-specified predicates such as OnlyConsider.
+type Stack = stack.Stack
+
+// SortStacks sorts the given stacks deterministically, by the function on top
+// of the stack, then the state, and then the goroutine ID.
+func SortStacks(stacks []Stack) {
+	sort.Slice(stacks, func(i, j int) bool {
+		si, sj := stacks[i], stacks[j]
+		if si.FirstFunction() != sj.FirstFunction() {
+			return si.FirstFunction() < sj.FirstFunction()
+		}
+		if si.State() != sj.State() {
+			return si.State() < sj.State()
+		}
+		return si.ID() < sj.ID()
+	})
+}
+
 // TestingT is the minimal subset of testing.TB that we use.
+// If a TestingT also has a Helper method, like testing.TB, it's called so
+// that leaks are reported at the line that verified them.
 type TestingT interface {
 	Error(...interface{})
 }
 
+// helperT is implemented by a TestingT that can mark helper functions.
+type helperT interface {
+	Helper()
+}
+
+// failNowT is implemented by a TestingT that can stop the test.
+type failNowT interface {
+	FailNow()
+}
+
+// stackParseError is returned if the stacks of running goroutines could not
+// be parsed, in which case we cannot reliably tell whether there are leaks.
+type stackParseError struct {
+	err error
+}
+
+func (e *stackParseError) Error() string {
+	return fmt.Sprintf("failed to parse goroutine stacks: %v", e.err)
+}
+
+func (e *stackParseError) Unwrap() error {
+	return e.err
+}
+
 // filterStacks will filter any stacks excluded by the given opts.
 // filterStacks modifies the passed in stacks slice.
 func filterStacks(stacks []stack.Stack, skipID int, opts *opts) []stack.Stack {
+	var byID map[int]stack.Stack
+	if opts.ignoreTestingDescendants {
+		// Index the stacks before they're modified, to find ancestors.
+		byID = stacksByID(stacks)
+	}
+	var labels *goroutineLabels
+	if len(opts.ignoreLabels) > 0 || len(opts.onlyLabels) > 0 {
+		labels = lookupLabels(stacks)
+	}
+
 	filtered := stacks[:0]
 	for _, stack := range stacks {
 		// Always skip the running goroutine.
@@ -44,29 +106,728 @@ func filterStacks(stacks []stack.Stack, skipID int, opts *opts) []stack.Stack {
 		if opts.filter(stack) {
 			continue
 		}
+		if byID != nil && isTestingDescendant(stack, byID) {
+			continue
+		}
+		if labels != nil && opts.hasIgnoredLabels(stack, labels) {
+			continue
+		}
+		if labels != nil && !opts.hasOnlyLabels(stack, labels) {
+			continue
+		}
 		filtered = append(filtered, stack)
 	}
+	for _, a := range opts.allowances {
+		filtered = allowLeaks(filtered, a)
+	}
 	return filtered
 }
 
-// Find looks for extra goroutines, and returns a descriptive error if
+// allowLeaks removes the stacks matching the given allowance, unless there
+// are more of them than it tolerates.
+// allowLeaks modifies the passed in stacks slice.
+func allowLeaks(stacks []stack.Stack, a leakAllowance) []stack.Stack {
+	var matched int
+	for _, s := range stacks {
+		if a.match(s) {
+			matched++
+		}
+	}
+	if matched == 0 || matched > a.n {
+		return stacks
+	}
+
+	remaining := stacks[:0]
+	for _, s := range stacks {
+		if !a.match(s) {
+			remaining = append(remaining, s)
+		}
+	}
+	return remaining
+}
+
+// stacksByID indexes the given stacks by their goroutine ID.
+func stacksByID(stacks []stack.Stack) map[int]stack.Stack {
+	byID := make(map[int]stack.Stack, len(stacks))
+	for _, s := range stacks {
+		byID[s.ID()] = s
+	}
+	return byID
+}
+
+// Find looks for extra goroutines, and returns a descriptive *LeakError if
 // any are found.
+//
+// Leak checks can be changed without changing the tests using environment
+// variables: GOLEAK_DISABLE=1 disables them, and GOLEAK_IGNORE ignores any
+// goroutines with one of the comma-separated functions anywhere in the
+// stack, like IgnoreAnyFunction, e.g., for a flaky dependency in CI.
+// GOLEAK_DISABLE only affects Find and the functions that verify there are
+// no leaks, like VerifyNone and VerifyTestMain, and not functions that only
+// report goroutines, like Summary, FindReport and Monitor.
 func Find(options ...Option) error {
+	return NewDetector(options...).Check()
+}
+
+// FindContext looks for extra goroutines like Find, but stops retrying once
+// the given context is done, and reports any extra goroutines found by the
+// last attempt. This lets long-running callers cancel a check that's waiting
+// for goroutines to exit. At least one attempt is always made.
+func FindContext(ctx context.Context, options ...Option) error {
+	return Find(withContextOption(ctx, options)...)
+}
+
+// withContextOption returns the given options with an option to use ctx,
+// without modifying the caller's slice.
+func withContextOption(ctx context.Context, options []Option) []Option {
+	return append(options[:len(options):len(options)], withContext(ctx))
+}
+
+// findError looks for extra goroutines as specified by opts,
+// and returns the error reported by Find.
+func findError(opts *opts) error {
+	_, err := findErrorWarning(opts)
+	return err
+}
+
+// findErrorWarning looks for extra goroutines like findError, but if there
+// are no leaks, also returns the warning about goroutines that are still
+// running for RunningWarn, which is otherwise included in the error.
+func findErrorWarning(opts *opts) (warning string, err error) {
+	if disabledByEnv() {
+		return "", nil
+	}
+	if opts.leakCountFile != "" {
+		return "", findLeakCount(opts)
+	}
+
+	res, err := findLeaks(opts)
+	if err != nil {
+		return "", err
+	}
+	if len(res.stacks) == 0 {
+		return runningWarning(res, opts), nil
+	}
+	return "", leakError(res, opts)
+}
+
+// findLeaks looks for extra goroutines like find, and resamples the stacks
+// of all goroutines if any are found and opts asks for it.
+func findLeaks(opts *opts) (findResult, error) {
+	res, err := find(opts)
+	if err != nil || len(res.stacks) == 0 {
+		return res, err
+	}
+	applyRunningPolicy(&res, opts)
+	if len(res.stacks) == 0 {
+		return res, nil
+	}
+	if opts.sortByWaitDuration {
+		sortByWaitDuration(res.stacks)
+	}
+	if opts.jsonReport != nil {
+		writeJSONReport(opts.jsonReport, res.stacks)
+	}
+	if opts.htmlReport != nil {
+		// Errors writing the report are ignored, as documented by ReportHTML.
+		writeHTMLReport(opts.htmlReport, res, opts)
+	}
+	if opts.resampleDelay <= 0 {
+		return res, nil
+	}
+
+	if err := opts.clock.Sleep(opts.ctx, opts.resampleDelay); err != nil {
+		// Report the leaks without resampling once the context is done.
+		return res, nil
+	}
+	all, err := opts.sample()
+	if err != nil {
+		return findResult{}, &stackParseError{err}
+	}
+	res.resampled = make(map[int]stack.Stack, len(all))
+	for _, s := range all {
+		res.resampled[s.ID()] = s
+	}
+	return res, nil
+}
+
+// isRunning reports whether a goroutine was runnable or running, rather than
+// parked, when its stack was taken.
+var isRunning = inStates([]string{"runnable", "running"})
+
+// applyRunningPolicy removes the goroutines that were runnable or running
+// from the leaks found, unless they should be reported as leaks according to
+// opts, keeping them to warn about if requested.
+func applyRunningPolicy(res *findResult, opts *opts) {
+	if opts.runningPolicy == RunningFail {
+		return
+	}
+	var parked, running []stack.Stack
+	for _, s := range res.stacks {
+		if isRunning(s) {
+			running = append(running, s)
+		} else {
+			parked = append(parked, s)
+		}
+	}
+	if opts.runningPolicy == RunningWarn {
+		res.running = running
+	}
+	res.stacks = parked
+}
+
+// runningWarning describes the goroutines that are still running for
+// RunningWarn, or returns an empty string if there are none.
+func runningWarning(res findResult, opts *opts) string {
+	if len(res.running) == 0 {
+		return ""
+	}
+	stacks, ids := displayOrder(res.running, opts)
+	return fmt.Sprintf("found goroutines that are still running after %v, which are not reported as leaks:\n%s",
+		pluralize(res.attempts, "attempt"), formatGroups(stacks, res, opts, ids))
+}
+
+// formatRunningWarning formats the warning about goroutines that are still
+// running for RunningWarn as a section of Find's error.
+func formatRunningWarning(res findResult, opts *opts) string {
+	if warning := runningWarning(res, opts); warning != "" {
+		return "\n\nwarning: " + warning
+	}
+	return ""
+}
+
+// reportWarning reports the given warning, if any, to the TestingT, using
+// Log if it's supported, and to the writer set using ReportTo.
+func reportWarning(t TestingT, opts *opts, warning string) {
+	if warning == "" {
+		return
+	}
+	if h, ok := t.(helperT); ok {
+		h.Helper()
+	}
+	if opts.reportWriter != nil {
+		fmt.Fprintln(opts.reportWriter, "goleak: Warning:", warning)
+	}
+	warnT{t}.Error(warning)
+}
+
+// sortByWaitDuration sorts the given stacks so the goroutines that have been
+// blocked the longest come first, keeping the order of stacks otherwise.
+func sortByWaitDuration(stacks []stack.Stack) {
+	sort.SliceStable(stacks, func(i, j int) bool {
+		return stacks[i].WaitDuration() > stacks[j].WaitDuration()
+	})
+}
+
+// LeakError is the error returned by Find when extra goroutines are found.
+// Use errors.As to inspect the leaked goroutines:
+//
+//	var leakErr *goleak.LeakError
+//	if errors.As(err, &leakErr) {
+//		for _, s := range leakErr.Stacks() {
+//			...
+//		}
+//	}
+type LeakError struct {
+	stacks []Stack
+	msg    string
+}
+
+// leakError returns the error reported by Find for the given leaks.
+func leakError(res findResult, opts *opts) *LeakError {
+	return &LeakError{
+		stacks: res.stacks,
+		msg: fmt.Sprintf("found unexpected goroutines after %v over %v:\n%s%s%s%s",
+			pluralize(res.attempts, "attempt"), res.duration.Round(time.Millisecond), formatStacks(res, opts),
+			formatSuggestions(res.stacks, opts), formatRunningWarning(res, opts), formatAllStacks(res, opts)),
+	}
+}
+
+// Error describes the leaked goroutines, along with their stacks.
+func (e *LeakError) Error() string {
+	return e.msg
+}
+
+// Stacks returns the stacks of the leaked goroutines.
+func (e *LeakError) Stacks() []Stack {
+	return append([]Stack(nil), e.stacks...)
+}
+
+// formatAllStacks formats the stacks of all goroutines for IncludeAllStacks,
+// to follow the leaked stacks in Find's error. With DumpStacksOnFailure, it
+// writes the stacks to a file, and notes the path of the file instead.
+func formatAllStacks(res findResult, opts *opts) string {
+	if res.all == nil {
+		return ""
+	}
+	var b strings.Builder
+	if opts.includeAllStacks {
+		b.WriteString("\n\nstacks of all goroutines:\n")
+		for _, s := range res.all {
+			b.WriteString(s.Full())
+		}
+	}
+	if opts.dumpStacks {
+		if path, err := writeStackDump(opts.dumpPath, res.all); err != nil {
+			fmt.Fprintf(&b, "\n\nfailed to write stacks of all goroutines: %v", err)
+		} else {
+			fmt.Fprintf(&b, "\n\nstacks of all goroutines written to %v", path)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// findResult is the result of looking for extra goroutines.
+type findResult struct {
+	// stacks of the extra goroutines, if any.
+	stacks []stack.Stack
+
+	// attempts is the number of times we looked for extra goroutines,
+	// and duration is how long it took in total.
+	attempts int
+	duration time.Duration
+
+	// all has the stacks of all goroutines from the last attempt,
+	// including those that were ignored, if requested.
+	all []stack.Stack
+
+	// resampled has the stacks of all goroutines by ID, from a second sample
+	// taken after the extra goroutines were found, if requested.
+	resampled map[int]stack.Stack
+
+	// byID has the stacks of all goroutines by ID from the last attempt,
+	// to find the creators of the extra goroutines, if requested.
+	byID map[int]stack.Stack
+
+	// running has the stacks of the extra goroutines that were still
+	// running, which are reported as a warning rather than as leaks for
+	// RunningWarn.
+	running []stack.Stack
+}
+
+// find looks for extra goroutines, retrying as specified by opts.
+func find(opts *opts) (findResult, error) {
 	cur := stack.Current().ID()
+	start := opts.clock.Now()
+	var deadline time.Time
+	if opts.totalBudget > 0 {
+		deadline = start.Add(opts.totalBudget)
+	}
 
-	opts := buildOpts(options...)
-	var stacks []stack.Stack
-	retry := true
-	for i := 0; retry; i++ {
-		stacks = filterStacks(stack.All(), cur, opts)
+	var (
+		res        findResult
+		persistent map[string]bool
+		clean      int
+		retries    int
+	)
+	for retry := true; retry; {
+		all, err := opts.sample()
+		if err != nil {
+			return findResult{}, &stackParseError{err}
+		}
+		res.attempts++
+		if opts.includeAllStacks || opts.dumpStacks {
+			// Copy the stacks, since filterStacks modifies them.
+			res.all = append([]stack.Stack(nil), all...)
+		}
+		if opts.attributeTests {
+			res.byID = stacksByID(all)
+		}
+		res.stacks = filterStacks(all, cur, opts)
+		if opts.persistentOnly {
+			res.stacks, persistent = intersectStacks(res.stacks, persistent, persistent == nil)
+		}
 
-		if len(stacks) == 0 {
-			return nil
+		if len(res.stacks) == 0 {
+			clean++
+			if clean >= opts.cleanChecks || !opts.recheck(deadline) {
+				break
+			}
+			// Goroutines found by the next check are new, so they must
+			// persist from that check on.
+			persistent = nil
+			continue
+		}
+		clean = 0
+		retry = opts.shouldRetry(res.stacks) && opts.retry(retries, deadline)
+		retries++
+	}
+	res.duration = opts.clock.Now().Sub(start)
+	return res, nil
+}
+
+// intersectStacks limits the given stacks to those with a signature in the
+// given set, unless it's the first attempt, and returns them along with the
+// set of their signatures for the next attempt.
+func intersectStacks(stacks []stack.Stack, signatures map[string]bool, first bool) ([]stack.Stack, map[string]bool) {
+	filtered := stacks[:0]
+	next := make(map[string]bool, len(stacks))
+	for _, s := range stacks {
+		sig := s.Signature()
+		if !first && !signatures[sig] {
+			continue
 		}
-		retry = opts.retry(i)
+		filtered = append(filtered, s)
+		next[sig] = true
+	}
+	return filtered, next
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%v %v", n, noun)
+	}
+	return fmt.Sprintf("%v %vs", n, noun)
+}
+
+// Summary looks for extra goroutines like Find, and returns a summary of any
+// that are found, which is empty if there are none. The summary has a line for
+// each distinct stack with the number of goroutines blocked at it, along with
+// the top function, the function that created the goroutines, and the stack's
+// signature, which ignores goroutine IDs, arguments and PC offsets:
+//
+//	go.uber.org/goleak.(*blockedG).run x2, created by go.uber.org/goleak.startBlockedG, signature 5e4d3c2b1a098f7e
+//
+// Lines are sorted, so the summary of the same leaks on the same build
+// is deterministic, and can be compared against a golden file to check that
+// code leaks exactly the expected goroutines.
+func Summary(options ...Option) (string, error) {
+	res, err := find(buildOpts(options...))
+	if err != nil {
+		return "", err
+	}
+
+	groups := groupStacks(res.stacks, GroupBySignature)
+	lines := make([]string, len(groups))
+	for i, g := range groups {
+		s := g.stacks[0]
+		lines[i] = fmt.Sprintf("%v x%v, created by %v, signature %v\n",
+			s.FirstFunction(), len(g.stacks), s.CreatedBy().Function, g.key)
 	}
+	sort.Strings(lines)
+	return strings.Join(lines, ""), nil
+}
+
+// Histogram returns the number of running goroutines keyed by the function
+// on top of their stack. Unlike Find, it counts every goroutine, including
+// the calling goroutine and those ignored by default. This is useful for
+// quickly spotting where goroutines pile up while debugging a leak.
+func Histogram() (map[string]int, error) {
+	return histogram(func(s stack.Stack) string {
+		return s.FirstFunction()
+	})
+}
+
+// HistogramByCreatedBy returns the number of running goroutines keyed by the
+// function that created them, like Histogram. Goroutines that were not created
+// by another goroutine, such as the main goroutine, are keyed by "".
+func HistogramByCreatedBy() (map[string]int, error) {
+	return histogram(func(s stack.Stack) string {
+		return s.CreatedBy().Function
+	})
+}
 
-	return fmt.Errorf("found unexpected goroutines:\n%s", stacks)
+func histogram(key func(stack.Stack) string) (map[string]int, error) {
+	all, err := stack.All()
+	if err != nil {
+		return nil, &stackParseError{err}
+	}
+	counts := make(map[string]int)
+	for _, s := range all {
+		counts[key(s)]++
+	}
+	return counts, nil
+}
+
+// formatStacks formats the leaked stacks for the error returned by Find.
+func formatStacks(res findResult, opts *opts) string {
+	stacks, ids := displayOrder(res.stacks, opts)
+
+	// Goroutines that are still running are reported separately, since
+	// they may be busy rather than blocked forever.
+	var parked, running []stack.Stack
+	for _, s := range stacks {
+		if isRunning(s) {
+			running = append(running, s)
+		} else {
+			parked = append(parked, s)
+		}
+	}
+	if len(running) == 0 {
+		return formatGroups(parked, res, opts, ids)
+	}
+
+	var b strings.Builder
+	if len(parked) > 0 {
+		b.WriteString(formatGroups(parked, res, opts, ids))
+		b.WriteString("\n\n")
+	}
+	b.WriteString("goroutines that are runnable or running, which may be busy rather than leaked:\n")
+	b.WriteString(formatGroups(running, res, opts, ids))
+	return b.String()
+}
+
+// formatGroups formats the given stacks for formatStacks,
+// collapsing them as specified by opts.
+func formatGroups(stacks []stack.Stack, res findResult, opts *opts, ids sequenceIDs) string {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, g := range groupStacks(stacks, opts.groupBy) {
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		if len(g.stacks) > 1 {
+			desc := describeGroup(g, opts.groupBy, ids)
+			if opts.color {
+				desc = colorizeGroup(desc)
+			}
+			b.WriteString(desc)
+		}
+
+		// Only the first stack of the group is reported in full.
+		s := g.stacks[0]
+		if notes := annotations(s, res, opts); len(notes) > 0 {
+			b.WriteString("(" + strings.Join(notes, ", ") + ") ")
+		}
+		text := ids.renumber(s.Truncate(opts.maxFrames).String(), s.ID())
+		if opts.color {
+			text = colorizeStack(text, s)
+		}
+		b.WriteString(text)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// displayOrder returns the given stacks in the order they should be reported,
+// along with the IDs they should be reported with.
+func displayOrder(stacks []stack.Stack, opts *opts) ([]stack.Stack, sequenceIDs) {
+	if !opts.stableIDs {
+		return stacks, nil
+	}
+
+	sorted := append([]stack.Stack(nil), stacks...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if si, sj := sorted[i].Signature(), sorted[j].Signature(); si != sj {
+			return si < sj
+		}
+		return sorted[i].ID() < sorted[j].ID()
+	})
+	ids := make(sequenceIDs, len(sorted))
+	for i, s := range sorted {
+		ids[s.ID()] = i + 1
+	}
+	return sorted, ids
+}
+
+// sequenceIDs maps the IDs of leaked goroutines to the sequence numbers
+// they're reported with for StableIDs. A nil map reports the real IDs.
+type sequenceIDs map[int]int
+
+// short returns the ID to report for the goroutine with the given ID.
+func (ids sequenceIDs) short(id int) string {
+	if ids == nil {
+		return strconv.Itoa(id)
+	}
+	return strconv.Itoa(ids[id])
+}
+
+// renumber replaces the ID of the goroutine in the given description
+// of its stack with its sequence number, noting the real ID once.
+func (ids sequenceIDs) renumber(text string, id int) string {
+	if ids == nil {
+		return text
+	}
+	seq := ids[id]
+	text = strings.Replace(text, fmt.Sprintf("Goroutine %v ", id), fmt.Sprintf("Goroutine %v (ID %v) ", seq, id), 1)
+	return strings.Replace(text, fmt.Sprintf("goroutine %v ", id), fmt.Sprintf("goroutine %v ", seq), 1)
+}
+
+// annotations returns any notes about the given leaked stack
+// to include before the stack in Find's error.
+func annotations(s stack.Stack, res findResult, opts *opts) []string {
+	var notes []string
+	if d := s.WaitDuration(); d > 0 {
+		notes = append(notes, "blocked for "+d.String())
+	}
+	if opts.baseline != nil {
+		if opts.baseline[s.ID()] {
+			notes = append(notes, "pre-existing")
+		} else {
+			notes = append(notes, "new since start")
+		}
+	}
+	if res.resampled != nil {
+		// Goroutines that are still winding down will likely have changed
+		// by the second sample, while leaked goroutines stay put.
+		switch resampled, ok := res.resampled[s.ID()]; {
+		case !ok:
+			notes = append(notes, "exited after "+opts.resampleDelay.String())
+		case resampled.Signature() != s.Signature():
+			notes = append(notes, "changed after "+opts.resampleDelay.String())
+		default:
+			notes = append(notes, "unchanged after "+opts.resampleDelay.String())
+		}
+	}
+	if ancestors := s.Ancestors(); len(ancestors) > 0 {
+		// Only reported with GODEBUG=tracebackancestors=N.
+		chain := make([]string, len(ancestors))
+		for i, a := range ancestors {
+			chain[i] = strconv.Itoa(a.ID)
+			if len(a.Frames) > 0 {
+				chain[i] += " (" + a.Frames[0].Function + ")"
+			}
+		}
+		notes = append(notes, "ancestors: "+strings.Join(chain, " <- "))
+	}
+	if opts.annotatePackages {
+		if pkgs := s.Packages(); len(pkgs) > 0 {
+			notes = append(notes, "packages: "+strings.Join(pkgs, " "))
+		}
+	}
+	if opts.attributeTests {
+		if test := startedByTest(s, res.byID); test != "" {
+			notes = append(notes, "started by "+test)
+		}
+	}
+	if opts.annotateTimers {
+		if note := timerNote(s); note != "" {
+			notes = append(notes, note)
+		}
+	}
+	return notes
+}
+
+// startedByTest returns the name of the test that started the given
+// goroutine, using the other running goroutines by ID to walk up the chain
+// of creators, or an empty string if it can't be determined. Creators that
+// have exited are only found if their stacks are reported as ancestors.
+func startedByTest(s stack.Stack, byID map[int]stack.Stack) string {
+	// Limit the walk in case the runtime reuses goroutine IDs.
+	for i := 0; i < len(byID); i++ {
+		if test := testName(s.CreatedBy().Function); test != "" {
+			return test
+		}
+
+		creator, ok := byID[s.CreatorID()]
+		if !ok {
+			return ancestorsTest(s.Ancestors())
+		}
+		for _, f := range creator.Frames() {
+			if test := testName(f.Function); test != "" {
+				return test
+			}
+		}
+		s = creator
+	}
+	return ""
+}
+
+// ancestorsTest returns the name of the first test found in the given
+// ancestors of a goroutine, or an empty string if there is none.
+func ancestorsTest(ancestors []stack.Ancestor) string {
+	for _, a := range ancestors {
+		for _, f := range a.Frames {
+			if test := testName(f.Function); test != "" {
+				return test
+			}
+		}
+		if test := testName(a.CreatedBy.Function); test != "" {
+			return test
+		}
+	}
+	return ""
+}
+
+// testName returns the name of the test, benchmark, fuzz test or example
+// that the given function belongs to, or an empty string if it's not part
+// of one. For example, "example.com/pkg.TestServer.func1" is part of
+// TestServer.
+func testName(fn string) string {
+	pkg := stack.Frame{Function: fn}.Package()
+	if pkg == "" || pkg == "testing" {
+		return ""
+	}
+
+	name := strings.TrimPrefix(fn, pkg+".")
+	if idx := strings.Index(name, ")."); strings.HasPrefix(name, "(") && idx >= 0 {
+		// Tests defined as methods, e.g., "(*Suite).TestServer".
+		name = name[idx+2:]
+	}
+	if idx := strings.Index(name, "."); idx >= 0 {
+		// Closures within the test, e.g., "TestServer.func1".
+		name = name[:idx]
+	}
+
+	for _, prefix := range []string{"Test", "Benchmark", "Fuzz", "Example"} {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// As with the go tool, the prefix must not be followed
+		// by a lower case letter, e.g., "Testify" is not a test.
+		if rest := name[len(prefix):]; rest == "" || !unicode.IsLower(rune(rest[0])) {
+			return name
+		}
+	}
+	return ""
+}
+
+// stackGroup is a set of leaked stacks with the same grouping key.
+type stackGroup struct {
+	key    string
+	stacks []stack.Stack
+}
+
+// groupStacks collapses the given stacks using the given grouping.
+// Groups are ordered by the first stack in each group.
+func groupStacks(stacks []stack.Stack, groupBy Grouping) []stackGroup {
+	var (
+		groups  []stackGroup
+		indexes = make(map[string]int)
+	)
+	for _, s := range stacks {
+		var key string
+		switch groupBy {
+		case GroupBySignature:
+			key = s.Signature()
+		case GroupByCreatedBy:
+			key = s.CreatedBy().Function
+		default:
+			// Every stack is in a separate group.
+			groups = append(groups, stackGroup{stacks: []stack.Stack{s}})
+			continue
+		}
+
+		idx, ok := indexes[key]
+		if !ok {
+			idx = len(groups)
+			indexes[key] = idx
+			groups = append(groups, stackGroup{key: key})
+		}
+		groups[idx].stacks = append(groups[idx].stacks, s)
+	}
+	return groups
+}
+
+// describeGroup returns a summary of the goroutines in a group
+// which precedes the first stack of the group.
+func describeGroup(g stackGroup, groupBy Grouping, seqs sequenceIDs) string {
+	ids := make([]string, len(g.stacks))
+	for i, s := range g.stacks {
+		ids[i] = seqs.short(s.ID())
+	}
+
+	var desc string
+	switch {
+	case groupBy == GroupByCreatedBy && g.key != "":
+		desc = "created by " + g.key
+	case groupBy == GroupByCreatedBy:
+		desc = "not created by another goroutine"
+	default:
+		desc = "with the same stack"
+	}
+	return fmt.Sprintf("%v goroutines %v (IDs: %v), such as:\n",
+		len(g.stacks), desc, strings.Join(ids, ", "))
 }
 
 // VerifyNone marks the given TestingT as failed if any extra goroutines are
@@ -74,7 +835,243 @@ func Find(options ...Option) error {
 // tests by doing:
 // 	defer VerifyNone(t)
 func VerifyNone(t TestingT, options ...Option) {
-	if err := Find(options...); err != nil {
+	if h, ok := t.(helperT); ok {
+		h.Helper()
+	}
+	opts := buildOpts(options...)
+	// Warnings are reported to the given TestingT, since they don't fail it.
+	warnTo := t
+	if f, ok := t.(failNowT); ok && opts.failNow && !opts.warnOnly {
+		st := &stopT{t: t}
+		t = st
+		defer func() {
+			if st.failed {
+				f.FailNow()
+			}
+		}()
+	}
+	if opts.warnOnly {
+		t = warnT{t}
+	}
+	if opts.reportWriter != nil {
+		t = reportT{t, opts.reportWriter}
+	}
+	if !opts.errorPerLeak || opts.leakCountFile != "" {
+		warning, err := findErrorWarning(opts)
+		if err != nil {
+			t.Error(err)
+		}
+		reportWarning(warnTo, opts, warning)
+		return
+	}
+
+	res, err := findLeaks(opts)
+	if err == nil {
+		reportWarning(warnTo, opts, runningWarning(res, opts))
+	}
+	switch {
+	case err != nil:
 		t.Error(err)
+	case len(res.stacks) == 0:
+		// No leaks.
+	default:
+		stacks, ids := displayOrder(res.stacks, opts)
+		for _, s := range stacks {
+			t.Error(describeLeak(s, res, opts, ids))
+		}
+		if all := formatAllStacks(res, opts); all != "" {
+			t.Error(strings.TrimPrefix(all, "\n\n"))
+		}
+	}
+}
+
+// describeLeak formats a single leaked stack for ErrorPerLeak, with a
+// one-line headline followed by the indented stack.
+func describeLeak(s stack.Stack, res findResult, opts *opts, ids sequenceIDs) string {
+	var b strings.Builder
+	id := strconv.Itoa(s.ID())
+	if ids != nil {
+		id = fmt.Sprintf("%v (ID %v)", ids[s.ID()], s.ID())
+	}
+	if s.FirstFunction() == "" {
+		fmt.Fprintf(&b, "found unexpected goroutine %v with no frames on the stack", id)
+	} else {
+		fmt.Fprintf(&b, "found unexpected goroutine %v with %v on top of the stack", id, s.FirstFunction())
+	}
+	if notes := annotations(s, res, opts); len(notes) > 0 {
+		b.WriteString(" (" + strings.Join(notes, ", ") + ")")
+	}
+	b.WriteString(":\n")
+
+	full := strings.TrimRight(ids.renumber(s.Truncate(opts.maxFrames).Full(), s.ID()), "\n")
+	for _, line := range strings.Split(full, "\n") {
+		b.WriteString("\t" + line + "\n")
+	}
+	if suggestions := formatSuggestions([]stack.Stack{s}, opts); suggestions != "" {
+		b.WriteString(strings.TrimPrefix(suggestions, "\n") + "\n")
+	}
+	return b.String()
+}
+
+// VerifyNoneContext marks the given TestingT as failed if any extra goroutines
+// are found by FindContext, which stops retrying once the context is done.
+func VerifyNoneContext(ctx context.Context, t TestingT, options ...Option) {
+	if h, ok := t.(helperT); ok {
+		h.Helper()
+	}
+	VerifyNone(t, withContextOption(ctx, options)...)
+}
+
+// TestingCleanupT is the minimal subset of testing.TB used by Check.
+type TestingCleanupT interface {
+	TestingT
+	Cleanup(func())
+}
+
+// Check records all current goroutines, and marks the given test as failed
+// if any extra goroutines are found when the test and its subtests complete.
+// Unlike VerifyNone, goroutines that were running before Check was called,
+// e.g., leaked by an earlier test, are not reported. This makes it easy to
+// check each subtest of a table-driven test independently:
+//
+//	t.Run(tt.name, func(t *testing.T) {
+//		goleak.Check(t)
+//		// test logic here.
+//	})
+//
+// Goroutines started by other tests running in parallel are reported.
+func Check(t TestingCleanupT, options ...Option) {
+	snap := NewSnapshot()
+	t.Cleanup(func() {
+		if h, ok := t.(helperT); ok {
+			h.Helper()
+		}
+		// Copy the options so we don't modify the caller's slice.
+		VerifyNone(t, append(options[:len(options):len(options)], snap.ignore())...)
+	})
+}
+
+// TestingB is the minimal subset of testing.B used by VerifyNoneB.
+type TestingB interface {
+	TestingCleanupT
+	StopTimer()
+}
+
+// VerifyNoneB marks the given benchmark as failed if any extra goroutines are
+// found by Find once the benchmark function returns, without including the
+// time spent looking for them, including any retries, in the results:
+//
+//	func BenchmarkServer(b *testing.B) {
+//		goleak.VerifyNoneB(b)
+//		for i := 0; i < b.N; i++ {
+//			// benchmark logic here.
+//		}
+//	}
+//
+// The testing package calls the benchmark function several times with an
+// increasing b.N, and each call is checked after the timer is stopped.
+func VerifyNoneB(b TestingB, options ...Option) {
+	b.Cleanup(func() {
+		if h, ok := b.(helperT); ok {
+			h.Helper()
+		}
+		b.StopTimer()
+		VerifyNone(b, options...)
+	})
+}
+
+// WaitForStopped waits for all goroutines with the specified function at the
+// top of the stack to exit. If any such goroutines are still running once the
+// timeout elapses, it returns a *LeakError listing them, whose Stacks are
+// those of the surviving goroutines.
+//
+// This is useful for testing that a background worker shuts down:
+//
+//	require.NoError(t, WaitForStopped("pkg.(*Worker).run", time.Second))
+func WaitForStopped(topFunction string, timeout time.Duration) error {
+	return waitForStopped(realClock{}, topFunction, timeout)
+}
+
+func waitForStopped(clock Clock, topFunction string, timeout time.Duration) error {
+	cur := stack.Current().ID()
+	deadline := clock.Now().Add(timeout)
+	for i := 0; ; i++ {
+		all, err := stack.All()
+		if err != nil {
+			return &stackParseError{err}
+		}
+
+		var running []stack.Stack
+		for _, s := range all {
+			if s.ID() != cur && s.FirstFunction() == topFunction {
+				running = append(running, s)
+			}
+		}
+		if len(running) == 0 {
+			return nil
+		}
+
+		remaining := deadline.Sub(clock.Now())
+		if remaining <= 0 {
+			res := findResult{stacks: running}
+			return &LeakError{
+				stacks: running,
+				msg: fmt.Sprintf("goroutines with %v on top of the stack did not stop within %v:\n%s",
+					topFunction, timeout, formatStacks(res, buildOpts())),
+			}
+		}
+		d := backoff(i, _defaultMaxSleep)
+		if d > remaining {
+			d = remaining
+		}
+		if err := clock.Sleep(context.Background(), d); err != nil {
+			return err
+		}
+	}
+}
+
+// warnT reports errors for a TestingT as warnings, without failing the test.
+type warnT struct {
+	t TestingT
+}
+
+func (w warnT) Error(args ...interface{}) {
+	if h, ok := w.t.(helperT); ok {
+		h.Helper()
+	}
+	if l, ok := w.t.(interface{ Log(...interface{}) }); ok {
+		l.Log("goleak: Warning: " + fmt.Sprint(args...))
+		return
+	}
+	fmt.Fprintln(_osStderr, "goleak: Warning:", fmt.Sprint(args...))
+}
+
+// reportT writes errors for a TestingT to a writer for ReportTo,
+// in addition to reporting them to the TestingT.
+type reportT struct {
+	t TestingT
+	w io.Writer
+}
+
+func (r reportT) Error(args ...interface{}) {
+	if h, ok := r.t.(helperT); ok {
+		h.Helper()
+	}
+	fmt.Fprintln(r.w, args...)
+	r.t.Error(args...)
+}
+
+// stopT records whether any errors were reported to a TestingT,
+// so VerifyNone can stop the test for FailNow.
+type stopT struct {
+	t      TestingT
+	failed bool
+}
+
+func (s *stopT) Error(args ...interface{}) {
+	if h, ok := s.t.(helperT); ok {
+		h.Helper()
 	}
+	s.failed = true
+	s.t.Error(args...)
 }
@@ -21,22 +21,34 @@
 package goleak
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
 )
 
 // Ensure that testingT is a subset of testing.TB.
 var _ = TestingT(testing.TB(nil))
 
+// Ensure that TestingCleanupT is a subset of testing.TB.
+var _ = TestingCleanupT(testing.TB(nil))
+
 // testOptions passes a shorter max sleep time, used so tests don't wait
 // ~1 second in cases where we expect Find to error out.
 func testOptions() Option {
-	return maxSleep(time.Millisecond)
+	return MaxSleep(time.Millisecond)
 }
 
 func TestFind(t *testing.T) {
@@ -53,6 +65,26 @@ func TestFind(t *testing.T) {
 	require.NoError(t, Find(), "Should find no leaks by default")
 }
 
+func TestFindContext(t *testing.T) {
+	require.NoError(t, FindContext(context.Background()), "Should find no leaks by default")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := FindContext(ctx, MaxRetries(1000), MaxSleep(time.Millisecond))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "blockedG")
+	assert.Less(t, time.Since(start), 10*time.Second, "Should stop retrying once the context is done")
+
+	ft := &fakeT{}
+	VerifyNoneContext(ctx, ft)
+	require.Len(t, ft.errors, 1, "Expected an error for the leak")
+	assert.Contains(t, ft.errors[0], "after 1 attempt over", "Should not retry once the context is done")
+}
+
 func TestFindRetry(t *testing.T) {
 	// for i := 0; i < 10; i++ {
 	bg := startBlockedG()
@@ -65,6 +97,30 @@ func TestFindRetry(t *testing.T) {
 	require.NoError(t, Find(), "Find should retry while background goroutine ends")
 }
 
+func TestFindLeakError(t *testing.T) {
+	bg1 := startBlockedG()
+	defer bg1.unblock()
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+
+	err := Find(testOptions())
+	require.Error(t, err, "Should find leaks with leaked goroutines")
+
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr), "Expected a *LeakError, got %T", err)
+	assert.Equal(t, err.Error(), leakErr.Error())
+
+	stacks := leakErr.Stacks()
+	require.Len(t, stacks, 2)
+	for _, s := range stacks {
+		assert.Equal(t, "go.uber.org/goleak.(*blockedG).run", s.FirstFunction())
+		assert.Contains(t, err.Error(), s.Full())
+	}
+
+	stacks[0] = Stack{}
+	assert.NotZero(t, leakErr.Stacks()[0].ID(), "Stacks should return a copy")
+}
+
 type fakeT struct {
 	errors []string
 }
@@ -73,6 +129,60 @@ func (ft *fakeT) Error(args ...interface{}) {
 	ft.errors = append(ft.errors, fmt.Sprint(args...))
 }
 
+// fakeLogT is a fakeT that also records logs.
+type fakeLogT struct {
+	fakeT
+
+	logs []string
+}
+
+func (ft *fakeLogT) Log(args ...interface{}) {
+	ft.logs = append(ft.logs, fmt.Sprint(args...))
+}
+
+// fakeTB is a fakeT that also records calls to Helper and FailNow.
+type fakeTB struct {
+	fakeLogT
+
+	helpers  int
+	failNows int
+}
+
+func (ft *fakeTB) Helper() {
+	ft.helpers++
+}
+
+func (ft *fakeTB) FailNow() {
+	ft.failNows++
+}
+
+// goexitT is a fakeT that stops the calling goroutine on FailNow, like
+// testing.T.
+type goexitT struct {
+	fakeT
+}
+
+func (ft *goexitT) FailNow() {
+	runtime.Goexit()
+}
+
+type fakeCleanupT struct {
+	fakeT
+
+	cleanups []func()
+}
+
+func (ft *fakeCleanupT) Cleanup(f func()) {
+	ft.cleanups = append(ft.cleanups, f)
+}
+
+func (ft *fakeCleanupT) runCleanups() {
+	for i := len(ft.cleanups) - 1; i >= 0; i-- {
+		ft.cleanups[i]()
+	}
+	ft.cleanups = nil
+}
+
 func TestVerifyNone(t *testing.T) {
 	ft := &fakeT{}
 	VerifyNone(ft)
@@ -84,6 +194,147 @@ func TestVerifyNone(t *testing.T) {
 	bg.unblock()
 }
 
+func TestVerifyNoneErrorPerLeak(t *testing.T) {
+	ft := &fakeT{}
+	VerifyNone(ft, ErrorPerLeak())
+	require.Empty(t, ft.errors, "Expect no errors from VerifyNone")
+
+	bg1 := startBlockedG()
+	bg2 := startBlockedG()
+	VerifyNone(ft, testOptions(), ErrorPerLeak())
+	bg1.unblock()
+	bg2.unblock()
+
+	require.Len(t, ft.errors, 2, "Expect an error per leaked goroutine")
+	for _, err := range ft.errors {
+		lines := strings.Split(strings.TrimSuffix(err, "\n"), "\n")
+		assert.Regexp(t, `^found unexpected goroutine \d+ with go.uber.org/goleak.\(\*blockedG\).run on top of the stack:$`, lines[0],
+			"Unexpected headline")
+		for _, line := range lines[1:] {
+			assert.True(t, strings.HasPrefix(line, "\t"), "Stack line %q should be indented", line)
+		}
+		assert.Contains(t, err, "created by go.uber.org/goleak.startBlockedG")
+	}
+}
+
+func TestVerifyNoneWarnOnly(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	t.Run("log", func(t *testing.T) {
+		ft := &fakeLogT{}
+		VerifyNone(ft, testOptions(), WarnOnly())
+		assert.Empty(t, ft.errors, "Expect no errors in warn-only mode")
+		require.Len(t, ft.logs, 1, "Expect leaks to be logged")
+		assert.Contains(t, ft.logs[0], "goleak: Warning: found unexpected goroutines")
+		assert.Contains(t, ft.logs[0], "blockedG")
+	})
+
+	t.Run("stderr", func(t *testing.T) {
+		defer clearOSStubs()
+		var buf bytes.Buffer
+		_osStderr = &buf
+
+		ft := &fakeT{}
+		VerifyNone(ft, testOptions(), WarnOnly(), ErrorPerLeak())
+		assert.Empty(t, ft.errors, "Expect no errors in warn-only mode")
+		assert.Contains(t, buf.String(), "goleak: Warning: found unexpected goroutine")
+		assert.Contains(t, buf.String(), "blockedG")
+	})
+}
+
+func TestVerifyNoneReportTo(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	var report bytes.Buffer
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions(), ReportTo(&report))
+	require.Len(t, ft.errors, 1, "Expect leaks to be reported")
+	assert.Equal(t, ft.errors[0]+"\n", report.String(), "Expect the error to be written")
+
+	report.Reset()
+	lt := &fakeLogT{}
+	VerifyNone(lt, testOptions(), ReportTo(&report), WarnOnly())
+	assert.Empty(t, lt.errors, "Expect no errors in warn-only mode")
+	require.Len(t, lt.logs, 1, "Expect leaks to be logged")
+	assert.Contains(t, report.String(), "found unexpected goroutines", "Expect warnings to be written")
+}
+
+func TestVerifyNoneRunningWarn(t *testing.T) {
+	defer clearOSStubs()
+	var stderr bytes.Buffer
+	_osStderr = &stderr
+
+	bg := startBusyG()
+	defer bg.stop()
+
+	var report bytes.Buffer
+	ft := &fakeLogT{}
+	VerifyNone(ft, testOptions(), HandleRunning(RunningWarn), ReportTo(&report))
+	assert.Empty(t, ft.errors, "Expect goroutines that are still running not to be leaks")
+	require.Len(t, ft.logs, 1, "Expect goroutines that are still running to be logged")
+	assert.Contains(t, ft.logs[0], "goleak: Warning: found goroutines that are still running after")
+	assert.Contains(t, ft.logs[0], "busyG")
+	assert.Contains(t, report.String(), "goleak: Warning: found goroutines that are still running after")
+	assert.Empty(t, stderr.String(), "Expect no warnings to be written to stderr")
+
+	blocked := startBlockedG()
+	defer blocked.unblock()
+	ft = &fakeLogT{}
+	VerifyNone(ft, testOptions(), HandleRunning(RunningWarn))
+	assert.Empty(t, ft.logs, "Expect goroutines that are still running to be reported with the leaks")
+	require.Len(t, ft.errors, 1, "Expect leaks to be reported")
+	assert.Contains(t, ft.errors[0], "blockedG")
+	assert.Contains(t, ft.errors[0], "\n\nwarning: found goroutines that are still running after")
+	assert.Empty(t, stderr.String(), "Expect no warnings to be written to stderr")
+}
+
+func TestVerifyNoneTB(t *testing.T) {
+	ft := &fakeTB{}
+	VerifyNone(ft, FailNow())
+	assert.Empty(t, ft.errors)
+	assert.NotZero(t, ft.helpers, "Expect VerifyNone to be marked as a helper")
+	assert.Zero(t, ft.failNows, "Expect no FailNow without leaks")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	ft = &fakeTB{}
+	VerifyNone(ft, testOptions())
+	assert.Len(t, ft.errors, 1)
+	assert.Zero(t, ft.failNows, "Expect no FailNow by default")
+
+	ft = &fakeTB{}
+	VerifyNoneContext(context.Background(), ft, testOptions(), FailNow(), ErrorPerLeak())
+	assert.Len(t, ft.errors, 1)
+	assert.Equal(t, 1, ft.failNows, "Expect FailNow after reporting leaks")
+	assert.GreaterOrEqual(t, ft.helpers, 2, "Expect VerifyNoneContext to be marked as a helper")
+
+	ft = &fakeTB{}
+	VerifyNone(ft, testOptions(), FailNow(), WarnOnly())
+	assert.Empty(t, ft.errors)
+	assert.Len(t, ft.logs, 1)
+	assert.Zero(t, ft.failNows, "Expect no FailNow in warn-only mode")
+}
+
+func TestVerifyNoneFailNow(t *testing.T) {
+	// Run a test that's expected to be stopped by FailNow in a separate
+	// goroutine, like testing does, so it can call runtime.Goexit.
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	ft := &goexitT{}
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		VerifyNone(ft, testOptions(), FailNow())
+		done <- true
+	}()
+	assert.False(t, <-done, "Expect VerifyNone to stop the goroutine")
+	assert.Len(t, ft.errors, 1)
+}
+
 func TestIgnoreCurrent(t *testing.T) {
 	t.Run("Should ignore current", func(t *testing.T) {
 		defer VerifyNone(t)
@@ -180,3 +431,794 @@ func TestVerifyParallel(t *testing.T) {
 		VerifyNone(t)
 	})
 }
+
+func TestWaitForStopped(t *testing.T) {
+	const topFunc = "go.uber.org/goleak.(*blockedG).run"
+	require.NoError(t, WaitForStopped(topFunc, time.Millisecond), "No blockedG running")
+
+	bg := startBlockedG()
+	err := WaitForStopped(topFunc, time.Millisecond)
+	require.Error(t, err, "blockedG should still be running")
+	assert.Contains(t, err.Error(), "did not stop within 1ms")
+
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr), "Expected a LeakError, got %T", err)
+	require.Len(t, leakErr.Stacks(), 1, "Expected the surviving goroutine")
+	survivor := leakErr.Stacks()[0]
+	assert.Equal(t, topFunc, survivor.FirstFunction())
+	assert.Contains(t, err.Error(), fmt.Sprintf("[Goroutine %v in state chan receive, with %v on top of the stack:\n", survivor.ID(), topFunc))
+	assert.Contains(t, err.Error(), survivor.Full(), "Expected the stack of the surviving goroutine")
+
+	go func() {
+		time.Sleep(time.Millisecond)
+		bg.unblock()
+	}()
+	require.NoError(t, WaitForStopped(topFunc, time.Second), "WaitForStopped should wait for blockedG to exit")
+}
+
+func TestFindRetryOnlyFor(t *testing.T) {
+	// Ignore the goroutine that unblocks blockedG, so that blockedG is the only
+	// goroutine remaining.
+	var bg *blockedG
+	start := make(chan struct{})
+	go func() {
+		<-start
+		time.Sleep(time.Millisecond)
+		bg.unblock()
+	}()
+	ignoreUnblocker := IgnoreCurrent()
+
+	bg = startBlockedG()
+	close(start)
+	require.NoError(t, Find(ignoreUnblocker, RetryOnlyFor("go.uber.org/goleak.(*blockedG).run")),
+		"Find should retry while blockedG ends")
+
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+	err := Find(RetryOnlyFor("foo.bar"))
+	require.Error(t, err, "Find should not retry for unlisted functions")
+	assert.Contains(t, err.Error(), "blockedG")
+}
+
+func TestFindPersistentOnly(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	// This goroutine moves to a different stack after the first attempt.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-done
+	}()
+
+	err := Find(testOptions(), MaxRetries(100), PersistentOnly())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "blockedG", "Goroutines in every attempt should be reported")
+	assert.NotContains(t, err.Error(), "TestFindPersistentOnly.func1", "Goroutines that changed should not be reported")
+
+	err = Find(testOptions())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "TestFindPersistentOnly.func1", "Goroutines in the last attempt should be reported by default")
+}
+
+func TestFindAnnotateBaseline(t *testing.T) {
+	bg1 := startBlockedG()
+	defer bg1.unblock()
+	opt := AnnotateBaseline()
+
+	err := Find(opt, testOptions())
+	require.Error(t, err, "Expected pre-existing goroutine to be reported")
+	assert.Equal(t, 1, strings.Count(err.Error(), "(pre-existing) Goroutine"))
+	assert.NotContains(t, err.Error(), "(new since start)")
+
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+
+	err = Find(opt, testOptions())
+	require.Error(t, err, "Expected leaked goroutines to be reported")
+	assert.Equal(t, 1, strings.Count(err.Error(), "(pre-existing) Goroutine"))
+	assert.Equal(t, 1, strings.Count(err.Error(), "(new since start) Goroutine"))
+
+	err = Find(testOptions())
+	require.Error(t, err, "Expected leaked goroutines to be reported")
+	assert.NotContains(t, err.Error(), "(pre-existing)", "No annotations without AnnotateBaseline")
+	assert.NotContains(t, err.Error(), "(new since start)", "No annotations without AnnotateBaseline")
+}
+
+func TestFindGroupBy(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		defer startBlockedG().unblock()
+	}
+
+	tests := []struct {
+		msg        string
+		groupBy    Grouping
+		wantGroup  string
+		wantStacks int
+	}{
+		{
+			msg:        "none",
+			groupBy:    GroupByNone,
+			wantStacks: 3,
+		},
+		{
+			msg:        "signature",
+			groupBy:    GroupBySignature,
+			wantGroup:  "3 goroutines with the same stack (IDs: ",
+			wantStacks: 1,
+		},
+		{
+			msg:        "created by",
+			groupBy:    GroupByCreatedBy,
+			wantGroup:  "3 goroutines created by go.uber.org/goleak.startBlockedG (IDs: ",
+			wantStacks: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			err := Find(testOptions(), GroupBy(tt.groupBy))
+			require.Error(t, err, "Should find leaks with leaked goroutines")
+			assert.Equal(t, tt.wantStacks, strings.Count(err.Error(), "on top of the stack"),
+				"Unexpected number of stacks in error: %v", err)
+			if tt.wantGroup != "" {
+				assert.Contains(t, err.Error(), tt.wantGroup)
+			} else {
+				assert.NotContains(t, err.Error(), "(IDs: ")
+			}
+		})
+	}
+}
+
+func TestFindMinBlockedDuration(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	require.Error(t, Find(testOptions(), MinBlockedDuration(0)), "All leaks reported with no minimum")
+	require.NoError(t, Find(testOptions(), MinBlockedDuration(time.Minute)),
+		"Recently blocked goroutines should be ignored")
+}
+
+func TestFindMaxRetries(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	start := time.Now()
+	require.Error(t, Find(MaxRetries(0)), "Should find leaks with leaked goroutine")
+	assert.Less(t, time.Since(start), _defaultMaxSleep, "Find should not sleep without retries")
+}
+
+func TestFindTotalBudget(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	start := time.Now()
+	err := Find(MaxRetries(1000), MaxSleep(10*time.Millisecond), TotalBudget(50*time.Millisecond))
+	elapsed := time.Since(start)
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "blockedG", "Should report the leaks from the last attempt")
+	assert.GreaterOrEqual(t, int64(elapsed), int64(50*time.Millisecond), "Find should use up the budget")
+	assert.Less(t, int64(elapsed), int64(time.Second), "Find should not exceed the budget by much")
+}
+
+func TestHistogram(t *testing.T) {
+	bg1 := startBlockedG()
+	defer bg1.unblock()
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+
+	byTop, err := Histogram()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, byTop["go.uber.org/goleak.(*blockedG).run"], 2, "Expected a count for each blockedG")
+
+	byCreatedBy, err := HistogramByCreatedBy()
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, byCreatedBy["go.uber.org/goleak.startBlockedG"], 2, "Expected a count for each blockedG")
+}
+
+// fakeB is a fakeCleanupT that also records whether the timer was
+// running when errors were reported.
+type fakeB struct {
+	fakeCleanupT
+
+	timerStopped bool
+	errorsTimed  int
+}
+
+func (fb *fakeB) StopTimer() {
+	fb.timerStopped = true
+}
+
+func (fb *fakeB) Error(args ...interface{}) {
+	if !fb.timerStopped {
+		fb.errorsTimed++
+	}
+	fb.fakeCleanupT.Error(args...)
+}
+
+func TestVerifyNoneB(t *testing.T) {
+	t.Run("benchmark", func(t *testing.T) {
+		result := testing.Benchmark(func(b *testing.B) {
+			VerifyNoneB(b)
+			for i := 0; i < b.N; i++ {
+				done := make(chan struct{})
+				go close(done)
+				<-done
+			}
+		})
+		assert.NotZero(t, result.N, "Expected the benchmark to pass")
+	})
+
+	t.Run("leak", func(t *testing.T) {
+		fb := &fakeB{}
+		VerifyNoneB(fb, testOptions())
+		bg := startBlockedG()
+		defer bg.unblock()
+		assert.Empty(t, fb.errors, "Expected no check till the benchmark function returns")
+
+		require.Len(t, fb.cleanups, 1, "Expected check to be registered as a cleanup")
+		fb.runCleanups()
+		require.Len(t, fb.errors, 1, "Expected leaks to be reported")
+		assert.Contains(t, fb.errors[0], "blockedG")
+		assert.Zero(t, fb.errorsTimed, "Expected the timer to be stopped before checking")
+	})
+}
+
+func TestCheck(t *testing.T) {
+	t.Run("ignores existing goroutines", func(t *testing.T) {
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft := &fakeCleanupT{}
+		Check(ft)
+		require.Len(t, ft.cleanups, 1, "Expected check to be registered as a cleanup")
+		ft.runCleanups()
+		assert.Empty(t, ft.errors, "Goroutines running before Check should be ignored")
+	})
+
+	t.Run("reports new goroutines", func(t *testing.T) {
+		ft := &fakeCleanupT{}
+		Check(ft, testOptions())
+
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft.runCleanups()
+		require.Len(t, ft.errors, 1, "Expected goroutine started after Check to be reported")
+		assert.Contains(t, ft.errors[0], "blockedG")
+	})
+
+	t.Run("does not modify options", func(t *testing.T) {
+		opts := make([]Option, 1, 2)
+		opts[0] = testOptions()
+
+		ft := &fakeCleanupT{}
+		Check(ft, opts...)
+		bg := startBlockedG()
+		defer bg.unblock()
+
+		ft.runCleanups()
+		require.Len(t, ft.errors, 1, "Expected goroutine started after Check to be reported")
+		assert.Len(t, opts, 1)
+		assert.Nil(t, opts[:2][1], "Check should not append to the caller's options")
+	})
+
+	t.Run("subtests", func(t *testing.T) {
+		leaky := startBlockedG()
+		defer leaky.unblock()
+
+		for i := 0; i < 3; i++ {
+			t.Run(fmt.Sprint(i), func(t *testing.T) {
+				Check(t)
+
+				bg := startBlockedG()
+				bg.unblock()
+			})
+		}
+	})
+}
+
+func TestFindMaxFrames(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	err := Find(testOptions(), MaxFrames(0))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.NotContains(t, err.Error(), "go.uber.org/goleak.(*blockedG).run(", "Frames should be omitted")
+	assert.Contains(t, err.Error(), "...1 frames omitted...")
+	assert.Contains(t, err.Error(), "created by go.uber.org/goleak.startBlockedG")
+
+	err = Find(testOptions(), MaxFrames(1))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "go.uber.org/goleak.(*blockedG).run(")
+	assert.NotContains(t, err.Error(), "frames omitted")
+}
+
+func TestSummary(t *testing.T) {
+	summary, err := Summary()
+	require.NoError(t, err)
+	assert.Empty(t, summary, "Expected empty summary without leaks")
+
+	for i := 0; i < 2; i++ {
+		defer startBlockedG().unblock()
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		<-done
+	}()
+
+	summary, err = Summary(testOptions())
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(summary, "\n"), "\n")
+	require.Len(t, lines, 2, "Expected a line per distinct stack: %v", summary)
+	assert.True(t, strings.HasPrefix(lines[0],
+		"go.uber.org/goleak.(*blockedG).run x2, created by go.uber.org/goleak.startBlockedG, signature "),
+		"Unexpected summary line: %v", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1],
+		"go.uber.org/goleak.TestSummary.func1 x1, created by go.uber.org/goleak.TestSummary, signature "),
+		"Unexpected summary line: %v", lines[1])
+
+	again, err := Summary(testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, summary, again, "Summary should be deterministic")
+}
+
+func TestFindIncludeAllStacksOnFailure(t *testing.T) {
+	require.NoError(t, Find(IncludeAllStacksOnFailure()), "Should not fail without leaks")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	err := Find(testOptions(), IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run"), IncludeAllStacksOnFailure())
+	require.NoError(t, err, "Should not fail if all goroutines are ignored")
+
+	ignoreBG := IgnoreCurrent()
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+	err = Find(testOptions(), ignoreBG, IncludeAllStacksOnFailure())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	idx := strings.Index(err.Error(), "\n\nstacks of all goroutines:\n")
+	require.True(t, idx >= 0, "Expected stacks of all goroutines in %v", err)
+	leaked, all := err.Error()[:idx], err.Error()[idx:]
+	assert.Equal(t, 1, strings.Count(leaked, "blockedG).run("), "Expected one leaked goroutine")
+	assert.Equal(t, 2, strings.Count(all, "blockedG).run("), "Expected ignored goroutines in all stacks")
+	assert.Contains(t, all, "TestFindIncludeAllStacksOnFailure", "Expected the current goroutine in all stacks")
+	assert.False(t, strings.HasSuffix(all, "\n"), "Unexpected trailing newline")
+
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions(), ignoreBG, IncludeAllStacksOnFailure(), ErrorPerLeak())
+	require.Len(t, ft.errors, 2, "Expected an error for the leak, and one for all stacks")
+	assert.True(t, strings.HasPrefix(ft.errors[1], "stacks of all goroutines:\n"), "Unexpected error: %v", ft.errors[1])
+}
+
+func TestFindDumpStacksOnFailure(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stacks.txt")
+	require.NoError(t, Find(DumpStacksOnFailure(path)), "Should not fail without leaks")
+	assert.NoFileExists(t, path, "Should not write stacks without leaks")
+
+	ignoreBG := IgnoreCurrent()
+	defer startBlockedG().unblock()
+	ignoreTop := IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run")
+
+	err := Find(testOptions(), ignoreTop, DumpStacksOnFailure(path))
+	require.NoError(t, err, "Should not fail if all goroutines are ignored")
+	assert.NoFileExists(t, path, "Should not write stacks if all goroutines are ignored")
+
+	defer startBlockedG().unblock()
+	err = Find(testOptions(), ignoreBG, DumpStacksOnFailure(path))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.True(t, strings.HasSuffix(err.Error(), "\n\nstacks of all goroutines written to "+path),
+		"Expected path of stacks in %v", err)
+	assert.NotContains(t, err.Error(), "stacks of all goroutines:", "Expected stacks to be written to the file")
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(contents), "blockedG).run("), "Expected ignored goroutines in all stacks")
+	assert.Contains(t, string(contents), "TestFindDumpStacksOnFailure", "Expected the current goroutine in all stacks")
+
+	t.Run("default path", func(t *testing.T) {
+		outputDir := flag.Lookup("test.outputdir")
+		require.NotNil(t, outputDir, "Expected test.outputdir flag")
+		prev := outputDir.Value.String()
+		defer outputDir.Value.Set(prev)
+		require.NoError(t, outputDir.Value.Set(dir))
+
+		err := Find(testOptions(), ignoreBG, DumpStacksOnFailure(""))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		const prefix = "stacks of all goroutines written to "
+		idx := strings.LastIndex(err.Error(), prefix)
+		require.True(t, idx >= 0, "Expected path of stacks in %v", err)
+		written := err.Error()[idx+len(prefix):]
+		assert.Equal(t, dir, filepath.Dir(written), "Expected stacks in the test output directory")
+		assert.FileExists(t, written)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		err := Find(testOptions(), ignoreBG, DumpStacksOnFailure(filepath.Join(dir, "missing", "stacks.txt")))
+		require.Error(t, err, "Should find leaks with leaked goroutine")
+		assert.Contains(t, err.Error(), "\n\nfailed to write stacks of all goroutines: ")
+		assert.Contains(t, err.Error(), "blockedG).run(", "Expected leaks to be reported")
+	})
+}
+
+func TestFindAnnotatePackages(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	err := Find(testOptions(), AnnotatePackages())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "(packages: go.uber.org/goleak) Goroutine")
+
+	err = Find(testOptions())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.NotContains(t, err.Error(), "packages:", "Packages should not be noted by default")
+}
+
+func TestFindAttributeTests(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() { <-done }()
+
+	err := Find(testOptions(), AttributeTests())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Contains(t, err.Error(), "(started by TestFindAttributeTests) Goroutine")
+
+	err = Find(testOptions())
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.NotContains(t, err.Error(), "started by", "Tests should not be noted by default")
+}
+
+func TestAnnotateTimers(t *testing.T) {
+	const dump = `goroutine 6 [sleep]:
+time.Sleep(0x34630b8a000)
+	/usr/local/go/src/runtime/time.go:368 +0x165
+created by main.main in goroutine 1
+	/path/to/main.go:10 +0x1e
+
+goroutine 7 [chan receive]:
+main.main.func1()
+	/path/to/main.go:11 +0x54
+created by main.main in goroutine 1
+	/path/to/main.go:11 +0x2a
+`
+	const note = "(sleeping in time.Sleep, stop a time.Timer or cancel a context instead) "
+
+	report, err := Analyze(strings.NewReader(dump), AnnotateTimers())
+	require.NoError(t, err)
+	assert.Contains(t, report.String(), note+"Goroutine 6 in state sleep")
+	assert.Equal(t, 1, strings.Count(report.String(), note), "Only sleeping goroutines should be noted")
+
+	report, err = Analyze(strings.NewReader(dump))
+	require.NoError(t, err)
+	assert.NotContains(t, report.String(), "time.Timer", "Timers should not be noted by default")
+}
+
+func TestStartedByTest(t *testing.T) {
+	const dump = `goroutine 20 [running]:
+example.com/pkg.TestServer(0xc000012345)
+	/path/to/pkg/server_test.go:10 +0x1f
+testing.tRunner(0xc000012345, 0x1)
+	/usr/local/go/src/testing/testing.go:1595 +0xff
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1648 +0x3ad
+
+goroutine 21 [chan receive]:
+example.com/pkg.worker()
+	/path/to/pkg/worker.go:20 +0x2
+created by example.com/pkg.TestWorker.func1 in goroutine 7
+	/path/to/pkg/worker_test.go:9 +0x6
+
+goroutine 22 [IO wait]:
+example.com/pkg.(*Server).serve()
+	/path/to/pkg/server.go:30 +0x2
+created by example.com/pkg.(*Server).Start in goroutine 20
+	/path/to/pkg/server.go:12 +0x6
+
+goroutine 23 [chan receive]:
+example.com/pkg.(*conn).read()
+	/path/to/pkg/conn.go:40 +0x2
+created by example.com/pkg.(*Server).serve in goroutine 22
+	/path/to/pkg/server.go:35 +0x6
+
+goroutine 24 [chan receive]:
+example.com/pkg.(*conn).read()
+	/path/to/pkg/conn.go:40 +0x2
+created by example.com/pkg.(*Server).serve in goroutine 8
+	/path/to/pkg/server.go:35 +0x6
+
+goroutine 25 [chan receive]:
+example.com/pkg.(*conn).read()
+	/path/to/pkg/conn.go:40 +0x2
+created by example.com/pkg.(*Server).serve in goroutine 9
+	/path/to/pkg/server.go:35 +0x6
+[originating from goroutine 9]:
+example.com/pkg.(*Server).serve(...)
+	/path/to/pkg/server.go:35 +0x6
+created by example.com/pkg.TestClient.func2
+	/path/to/pkg/client_test.go:15 +0x6
+`
+	stacks, err := stack.Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	byID := stacksByID(stacks)
+
+	tests := []struct {
+		id   int
+		want string
+	}{
+		{id: 21, want: "TestWorker"},
+		{id: 22, want: "TestServer"},
+		{id: 23, want: "TestServer"},
+		{id: 24, want: ""},
+		{id: 25, want: "TestClient"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, startedByTest(byID[tt.id], byID), "goroutine %v", tt.id)
+	}
+}
+
+func TestTestName(t *testing.T) {
+	tests := []struct {
+		fn   string
+		want string
+	}{
+		{fn: "example.com/pkg.TestServer", want: "TestServer"},
+		{fn: "example.com/pkg.TestServer.func1.2", want: "TestServer"},
+		{fn: "example.com/pkg.TestServer.gowrap1", want: "TestServer"},
+		{fn: "example.com/pkg.Test", want: "Test"},
+		{fn: "example.com/pkg.Test_server", want: "Test_server"},
+		{fn: "example.com/pkg.BenchmarkServer", want: "BenchmarkServer"},
+		{fn: "example.com/pkg.FuzzParse.func1", want: "FuzzParse"},
+		{fn: "example.com/pkg.ExampleServer", want: "ExampleServer"},
+		{fn: "example.com/pkg.(*Suite).TestServer", want: "TestServer"},
+		{fn: "main.TestServer", want: "TestServer"},
+		{fn: "example.com/pkg.Testify", want: ""},
+		{fn: "example.com/pkg.(*Server).serve", want: ""},
+		{fn: "example.com/pkg.startTest", want: ""},
+		{fn: "testing.tRunner", want: ""},
+		{fn: "TestServer", want: ""},
+		{fn: "", want: ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, testName(tt.fn), "testName(%q)", tt.fn)
+	}
+}
+
+func TestFindFilter(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	var ids []int
+	err := Find(testOptions(), Filter(func(s Stack) bool {
+		ids = append(ids, s.ID())
+		return false
+	}))
+	require.Error(t, err, "Goroutines not matching the predicate should be reported")
+	assert.NotEmpty(t, ids, "Expected predicate to be called with the parsed stacks")
+
+	require.NoError(t, Find(testOptions(), Filter(func(s Stack) bool {
+		return s.State() == "chan receive" && s.CreatedBy().Function == "go.uber.org/goleak.startBlockedG"
+	})), "Goroutines matching the predicate should be ignored")
+}
+
+func TestFindOnlyConsider(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	createdByBlockedG := func(s Stack) bool {
+		return s.CreatedBy().Function == "go.uber.org/goleak.startBlockedG"
+	}
+	createdByOther := func(s Stack) bool {
+		return s.CreatedBy().Function == "example.com/other.start"
+	}
+
+	err := Find(testOptions(), OnlyConsider(createdByBlockedG))
+	require.Error(t, err, "Goroutines matching the predicate should be considered")
+	assert.Contains(t, err.Error(), "blockedG")
+
+	require.NoError(t, Find(testOptions(), OnlyConsider(createdByOther)),
+		"Goroutines not matching the predicate should be ignored")
+	require.NoError(t, Find(testOptions(), OnlyConsider(createdByBlockedG), OnlyConsider(createdByOther)),
+		"Goroutines must match all predicates to be considered")
+	require.NoError(t, Find(
+		testOptions(),
+		OnlyConsider(createdByBlockedG),
+		IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run"),
+	), "Considered goroutines should still be ignored by other options")
+}
+
+func TestFindErrorAttempts(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	err := Find(MaxRetries(0))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Regexp(t, `^found unexpected goroutines after 1 attempt over \S+:\n`, err.Error())
+
+	err = Find(MaxRetries(3), MaxSleep(time.Millisecond))
+	require.Error(t, err, "Should find leaks with leaked goroutine")
+	assert.Regexp(t, `^found unexpected goroutines after 4 attempts over \S+:\n`, err.Error())
+}
+
+func TestFindResample(t *testing.T) {
+	// Ignore the goroutine that unblocks the exiting blockedG, so that it's
+	// not reported.
+	var exiting *blockedG
+	start := make(chan struct{})
+	go func() {
+		<-start
+		time.Sleep(10 * time.Millisecond)
+		exiting.unblock()
+	}()
+	ignoreUnblocker := IgnoreCurrent()
+
+	leaked := startBlockedG()
+	defer leaked.unblock()
+	exiting = startBlockedG()
+	close(start)
+
+	err := Find(MaxRetries(0), ignoreUnblocker, Resample(100*time.Millisecond))
+	require.Error(t, err, "Should find leaks with leaked goroutines")
+	assert.Equal(t, 1, strings.Count(err.Error(), "(unchanged after 100ms) Goroutine"),
+		"Expected leaked goroutine to be unchanged: %v", err)
+	assert.Equal(t, 1, strings.Count(err.Error(), "(exited after 100ms) Goroutine"),
+		"Expected exiting goroutine to have exited: %v", err)
+
+	err = Find(MaxRetries(0), AnnotateBaseline(), Resample(time.Millisecond))
+	require.Error(t, err, "Should find leaks with leaked goroutines")
+	assert.Contains(t, err.Error(), "(pre-existing, unchanged after 1ms) Goroutine")
+}
+
+func TestSortByWaitDuration(t *testing.T) {
+	parse := func(header string) stack.Stack {
+		s, err := stack.ParseStack(header + "\nmain.main()\n\t/path/to/main.go:10 +0x1f\n")
+		require.NoError(t, err)
+		return s
+	}
+	stacks := []stack.Stack{
+		parse("goroutine 1 [chan receive]:"),
+		parse("goroutine 2 [chan receive, 3 minutes]:"),
+		parse("goroutine 3 [select, 17 minutes]:"),
+		parse("goroutine 4 [IO wait, 3 minutes]:"),
+	}
+
+	sortByWaitDuration(stacks)
+	var ids []int
+	for _, s := range stacks {
+		ids = append(ids, s.ID())
+	}
+	assert.Equal(t, []int{3, 2, 4, 1}, ids, "Expected longest blocked first, keeping the order otherwise")
+
+	out := formatStacks(findResult{stacks: stacks}, buildOpts())
+	assert.Contains(t, out, "[(blocked for 17m0s) Goroutine 3 in state select, 17 minutes")
+	assert.Contains(t, out, " Goroutine 1 in state chan receive, with main.main", "Expected no note without a wait duration")
+}
+
+func TestFormatStacksStableIDs(t *testing.T) {
+	parse := func(id int, fn string) stack.Stack {
+		s, err := stack.ParseStack(fmt.Sprintf("goroutine %v [chan receive]:\n%v()\n\t/path/to/main.go:10 +0x1f\n", id, fn))
+		require.NoError(t, err)
+		return s
+	}
+	stacks := []stack.Stack{parse(40, "main.b"), parse(7, "main.a"), parse(12, "main.a")}
+
+	first, second := stacks[1].Signature(), stacks[0].Signature()
+	wantFirst, wantSecond := "1 (ID 7)", "3 (ID 40)"
+	if first > second {
+		wantFirst, wantSecond = "2 (ID 7)", "1 (ID 40)"
+	}
+
+	out := formatStacks(findResult{stacks: stacks}, buildOpts(StableIDs()))
+	assert.Contains(t, out, "Goroutine "+wantFirst+" in state chan receive, with main.a")
+	assert.Contains(t, out, "Goroutine "+wantSecond+" in state chan receive, with main.b")
+	assert.NotContains(t, out, "goroutine 40 [")
+	assert.NotContains(t, out, "goroutine 7 [")
+	assert.Equal(t, 40, stacks[0].ID(), "Stacks should not be modified")
+
+	out = formatStacks(findResult{stacks: stacks}, buildOpts(StableIDs(), GroupBy(GroupBySignature)))
+	assert.Contains(t, out, "2 goroutines with the same stack (IDs: ")
+	assert.NotContains(t, out, "IDs: 7, 12", "Groups should use sequence numbers")
+
+	ft := &fakeT{}
+	bg := startBlockedG()
+	VerifyNone(ft, testOptions(), StableIDs(), ErrorPerLeak())
+	bg.unblock()
+	require.Len(t, ft.errors, 1)
+	assert.Regexp(t, `^found unexpected goroutine 1 \(ID \d+\) with go.uber.org/goleak.\(\*blockedG\).run on top of the stack:\n\tgoroutine 1 \[`,
+		ft.errors[0])
+}
+
+func TestSortStacks(t *testing.T) {
+	parse := func(id int, state, fn string) Stack {
+		s, err := stack.ParseStack(fmt.Sprintf("goroutine %v [%v]:\n%v()\n\t/path/to/main.go:10 +0x1f\n", id, state, fn))
+		require.NoError(t, err)
+		return s
+	}
+	stacks := []Stack{
+		parse(5, "select", "main.b"),
+		parse(9, "chan receive", "main.a"),
+		parse(2, "select", "main.a"),
+		parse(1, "chan receive", "main.a"),
+	}
+
+	SortStacks(stacks)
+	var ids []int
+	for _, s := range stacks {
+		ids = append(ids, s.ID())
+	}
+	assert.Equal(t, []int{1, 9, 2, 5}, ids)
+}
+
+func TestHandleRunning(t *testing.T) {
+	const dump = `goroutine 5 [chan receive]:
+main.worker()
+	/path/to/main.go:20 +0x2
+
+goroutine 6 [runnable]:
+main.spin()
+	/path/to/main.go:30 +0x2
+
+goroutine 7 [running, locked to thread]:
+main.spin()
+	/path/to/main.go:30 +0x2
+`
+	defer clearOSStubs()
+
+	tests := []struct {
+		msg     string
+		policy  RunningPolicy
+		wantIDs []int
+		wantOut []string
+	}{
+		{
+			msg:     "fail",
+			policy:  RunningFail,
+			wantIDs: []int{5, 6, 7},
+			wantOut: []string{
+				"[Goroutine 5 in state chan receive, with main.worker on top of the stack:\n",
+				"\n\ngoroutines that are runnable or running, which may be busy rather than leaked:\n" +
+					"[Goroutine 6 in state runnable, with main.spin on top of the stack:\n",
+				"Goroutine 7 in state running, locked to thread, with main.spin",
+			},
+		},
+		{
+			msg:     "warn",
+			policy:  RunningWarn,
+			wantIDs: []int{5},
+			wantOut: []string{
+				"[Goroutine 5 in state chan receive, with main.worker on top of the stack:\n",
+				"\n\nwarning: found goroutines that are still running after 1 attempt, which are not reported as leaks:\n" +
+					"[Goroutine 6 in state runnable, with main.spin on top of the stack:\n",
+				"Goroutine 7 in state running, locked to thread, with main.spin",
+			},
+		},
+		{
+			msg:     "ignore",
+			policy:  RunningIgnore,
+			wantIDs: []int{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			var stderr bytes.Buffer
+			_osStderr = &stderr
+
+			r, err := Analyze(strings.NewReader(dump), HandleRunning(tt.policy))
+			require.NoError(t, err)
+			var ids []int
+			for _, s := range r.Stacks() {
+				ids = append(ids, s.ID())
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+			for _, want := range tt.wantOut {
+				assert.Contains(t, r.String(), want)
+			}
+			switch tt.policy {
+			case RunningIgnore:
+				assert.NotContains(t, r.String(), "main.spin")
+			case RunningWarn:
+				assert.NotContains(t, r.String(), "which may be busy", "running goroutines reported as leaks")
+			}
+			assert.Empty(t, stderr.String(), "warnings should be reported by the caller")
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package metrics exports the goroutines that goleak reports as suspected
+// leaks in a running process as metrics in the Prometheus text format,
+// so the same rules used in tests can feed production dashboards.
+//
+// The handler is typically registered next to other debug endpoints,
+// ignoring the goroutines that were running once the process started up:
+//
+//	http.Handle("/debug/goleak/metrics", metrics.Handler(goleak.IgnoreCurrent()))
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.uber.org/goleak"
+)
+
+// Handler returns an http.Handler that looks for leaks using goleak.Find
+// with the given options on each request, and serves the following gauges:
+//
+//	goleak_suspected_leaks
+//	goleak_suspected_leaks_by_function{function="..."}
+//
+// where function is the function at the top of the stack of the suspected
+// leaks. Since a long-lived goroutine in a running process is not expected
+// to exit, Find doesn't retry by default, which can be changed using
+// goleak.MaxRetries.
+// If the goroutine stacks can't be parsed, the handler responds with an
+// internal server error.
+func Handler(options ...goleak.Option) http.Handler {
+	opts := append([]goleak.Option{goleak.MaxRetries(0)}, options...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stacks, err := find(opts)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		write(w, stacks)
+	})
+}
+
+// find returns the suspected leaks found by goleak.Find.
+func find(opts []goleak.Option) ([]goleak.Stack, error) {
+	err := goleak.Find(opts...)
+	var leakErr *goleak.LeakError
+	switch {
+	case err == nil:
+		return nil, nil
+	case errors.As(err, &leakErr):
+		return leakErr.Stacks(), nil
+	default:
+		return nil, err
+	}
+}
+
+// write writes the metrics for the given suspected leaks to w.
+func write(w io.Writer, stacks []goleak.Stack) {
+	byFunction := make(map[string]int)
+	for _, s := range stacks {
+		byFunction[s.FirstFunction()]++
+	}
+	functions := make([]string, 0, len(byFunction))
+	for fn := range byFunction {
+		functions = append(functions, fn)
+	}
+	sort.Strings(functions)
+
+	fmt.Fprintln(w, "# HELP goleak_suspected_leaks Number of goroutines reported by goleak as suspected leaks.")
+	fmt.Fprintln(w, "# TYPE goleak_suspected_leaks gauge")
+	fmt.Fprintf(w, "goleak_suspected_leaks %v\n", len(stacks))
+	fmt.Fprintln(w, "# HELP goleak_suspected_leaks_by_function Number of suspected leaks by the function at the top of the stack.")
+	fmt.Fprintln(w, "# TYPE goleak_suspected_leaks_by_function gauge")
+	for _, fn := range functions {
+		fmt.Fprintf(w, "goleak_suspected_leaks_by_function{function=\"%v\"} %v\n", escapeLabel(fn), byFunction[fn])
+	}
+}
+
+var _labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value for the Prometheus text format.
+func escapeLabel(v string) string {
+	return _labelEscaper.Replace(v)
+}
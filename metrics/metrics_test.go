@@ -0,0 +1,85 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func worker(wg *sync.WaitGroup, started chan<- struct{}, done <-chan struct{}) {
+	defer wg.Done()
+	started <- struct{}{}
+	<-done
+}
+
+func scrape(t *testing.T, h http.Handler) string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Header().Get("Content-Type"), "text/plain")
+	return rec.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler()
+	assert.Equal(t, `# HELP goleak_suspected_leaks Number of goroutines reported by goleak as suspected leaks.
+# TYPE goleak_suspected_leaks gauge
+goleak_suspected_leaks 0
+# HELP goleak_suspected_leaks_by_function Number of suspected leaks by the function at the top of the stack.
+# TYPE goleak_suspected_leaks_by_function gauge
+`, scrape(t, h), "Expected no leaks")
+
+	var wg sync.WaitGroup
+	started := make(chan struct{})
+	done := make(chan struct{})
+	defer func() {
+		close(done)
+		wg.Wait()
+	}()
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go worker(&wg, started, done)
+		<-started
+	}
+
+	out := scrape(t, h)
+	assert.Contains(t, out, "goleak_suspected_leaks 3\n")
+	assert.Contains(t, out, `goleak_suspected_leaks_by_function{function="go.uber.org/goleak/metrics.worker"} 3`+"\n")
+
+	out = scrape(t, Handler(goleak.IgnoreTopFunction("go.uber.org/goleak/metrics.worker")))
+	assert.Contains(t, out, "goleak_suspected_leaks 0\n", "Expected options to be used")
+}
+
+func TestEscapeLabel(t *testing.T) {
+	assert.Equal(t, `main.(*T).run`, escapeLabel("main.(*T).run"))
+	assert.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/goleak/stack"
+)
+
+// Monitor looks for leaks in a long-running process, such as a service,
+// by periodically checking for extra goroutines like Find does.
+// Goroutines that are found in two consecutive checks, blocked at the same
+// place, are suspected leaks, and are reported to the function passed to
+// NewMonitor once each:
+//
+//	m := goleak.NewMonitor(time.Minute, func(leaks []goleak.Stack) {
+//		log.Printf("suspected goroutine leaks: %v", leaks)
+//	}, goleak.IgnoreCurrent())
+//	defer m.Stop()
+//
+// Unlike in tests, a process usually has goroutines that are expected
+// to run until it exits, so these should be ignored, e.g., by creating the
+// monitor with IgnoreCurrent once the process has started up.
+type Monitor struct {
+	opts       *opts
+	sampler    stack.Sampler
+	onNewLeaks func([]stack.Stack)
+	stop       chan struct{}
+	done       chan struct{}
+
+	// suspects are the goroutines found by the last check, by ID,
+	// and reported are the IDs of suspects that have been reported.
+	suspects map[int]stack.Stack
+	reported map[int]bool
+
+	stopOnce sync.Once
+}
+
+// NewMonitor starts a Monitor that checks for leaks at the given interval,
+// using the given options, and calls onNewLeaks with the goroutines that it
+// newly suspects are leaked. Each goroutine is only reported once, and
+// onNewLeaks is called from the monitor's goroutine, which waits for it to
+// return before it checks for leaks again.
+//
+// Since a check is repeated after the interval, options to retry or
+// resample, such as MaxRetries and Resample, have no effect.
+func NewMonitor(interval time.Duration, onNewLeaks func(leaks []Stack), options ...Option) *Monitor {
+	m := newMonitor(onNewLeaks, options...)
+	go m.run(interval)
+	return m
+}
+
+func newMonitor(onNewLeaks func([]stack.Stack), options ...Option) *Monitor {
+	m := &Monitor{
+		opts:       buildOpts(options...),
+		onNewLeaks: onNewLeaks,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		suspects:   make(map[int]stack.Stack),
+		reported:   make(map[int]bool),
+	}
+	// Only the monitor's goroutine takes samples, so it can reuse the buffer.
+	m.opts.sample = m.sampler.All
+	return m
+}
+
+func (m *Monitor) run(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.check()
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check looks for extra goroutines, and reports any that were also found
+// by the previous check and haven't been reported before.
+func (m *Monitor) check() {
+	// Goroutines that could not be parsed are skipped.
+	all, _ := m.opts.sample()
+	stacks := filterStacks(all, stack.Current().ID(), m.opts)
+
+	var leaks []stack.Stack
+	suspects := make(map[int]stack.Stack, len(stacks))
+	reported := make(map[int]bool, len(m.reported))
+	for _, s := range stacks {
+		suspects[s.ID()] = s
+		prev, ok := m.suspects[s.ID()]
+		switch {
+		case m.reported[s.ID()]:
+			reported[s.ID()] = true
+		case !ok || prev.Signature() != s.Signature():
+			// New, or still changing.
+		default:
+			leaks = append(leaks, s)
+			reported[s.ID()] = true
+		}
+	}
+	// Forget about goroutines that have exited.
+	m.suspects, m.reported = suspects, reported
+
+	if len(leaks) > 0 {
+		m.onNewLeaks(leaks)
+	}
+}
+
+// Stop stops the monitor, and waits for any check in progress to complete.
+// It's safe to call Stop more than once.
+func (m *Monitor) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+	<-m.done
+}
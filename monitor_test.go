@@ -0,0 +1,98 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestMonitor(t *testing.T) {
+	leaks := make(chan []Stack, 1)
+	// Only consider blockedG, as goroutines left by other tests may still be
+	// exiting, and would be reported if they're seen by consecutive checks.
+	onlyBlockedG := OnlyConsider(func(s Stack) bool {
+		return s.FirstFunction() == "go.uber.org/goleak.(*blockedG).run"
+	})
+	m := NewMonitor(time.Millisecond, func(s []Stack) {
+		leaks <- s
+	}, onlyBlockedG)
+
+	bg := startBlockedG()
+	var got []Stack
+	select {
+	case got = <-leaks:
+	case <-time.After(10 * time.Second):
+		require.FailNow(t, "Timed out waiting for the leak to be reported")
+	}
+	bg.unblock()
+	m.Stop()
+	m.Stop()
+
+	require.Len(t, got, 1)
+	assert.Equal(t, "go.uber.org/goleak.(*blockedG).run", got[0].FirstFunction())
+	select {
+	case got = <-leaks:
+		assert.Fail(t, "Leak should only be reported once", "got %v", got)
+	default:
+	}
+}
+
+func TestMonitorCheck(t *testing.T) {
+	parse := func(id int, fn string) stack.Stack {
+		s, err := stack.ParseStack(fmt.Sprintf("goroutine %v [chan receive]:\n%v()\n\t/path/to/main.go:10 +0x1f\n", id, fn))
+		require.NoError(t, err)
+		return s
+	}
+
+	var reported [][]int
+	m := newMonitor(func(leaks []Stack) {
+		var ids []int
+		for _, s := range leaks {
+			ids = append(ids, s.ID())
+		}
+		reported = append(reported, ids)
+	})
+
+	samples := [][]stack.Stack{
+		{parse(1010, "main.worker"), parse(1011, "main.worker")},
+		// 1010 and 1011 are unchanged, 1012 is new.
+		{parse(1010, "main.worker"), parse(1011, "main.worker"), parse(1012, "main.worker")},
+		// 1010 and 1011 were reported, 1012 moved.
+		{parse(1010, "main.worker"), parse(1011, "main.worker"), parse(1012, "main.other")},
+		// 1011 exited, 1012 is unchanged.
+		{parse(1010, "main.worker"), parse(1012, "main.other")},
+		// 1011 is a new goroutine that reuses the ID.
+		{parse(1011, "main.worker")},
+		{parse(1011, "main.worker")},
+	}
+	for _, sample := range samples {
+		sample := sample
+		m.opts.sample = func() ([]stack.Stack, error) { return sample, nil }
+		m.check()
+	}
+	assert.Equal(t, [][]int{{1010, 1011}, {1012}, {1011}}, reported)
+}
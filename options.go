@@ -21,10 +21,16 @@
 package goleak
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"regexp"
 	"strings"
+	"sync"
 	"time"
 
-	"go.uber.org/goleak/internal/stack"
+	"go.uber.org/goleak/stack"
 )
 
 // Option lets users specify custom verifications.
@@ -37,10 +43,171 @@ type Option interface {
 // a short while to let any running goroutines complete.
 const _defaultRetries = 20
 
+// The maximum time to sleep between attempts.
+const _defaultMaxSleep = 100 * time.Millisecond
+
+// We randomly adjust the time to sleep between attempts by up to 10%, so that
+// processes running Find at the same time don't synchronize their attempts.
+const _defaultRetryJitter = 0.1
+
+// _jitterRand is used to randomize the time to sleep between attempts,
+// and is seeded so that it differs between processes.
+var _jitterRand = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
 type opts struct {
-	filters    []func(stack.Stack) bool
-	maxRetries int
-	maxSleep   time.Duration
+	filters     []func(stack.Stack) bool
+	maxRetries  int
+	maxSleep    time.Duration
+	retryJitter float64
+	clock       Clock
+
+	// withoutDefaultIgnores skips the filters in _defaultIgnores.
+	withoutDefaultIgnores bool
+
+	// ctx stops Find from retrying once it's done.
+	ctx context.Context
+
+	// sample gets the stacks of all goroutines.
+	sample func() ([]stack.Stack, error)
+
+	// retryOnlyFor limits retries to when all remaining goroutines have one
+	// of these functions at the top of the stack. If empty, always retry.
+	retryOnlyFor map[string]bool
+
+	// baseline is the set of goroutine IDs recorded by AnnotateBaseline.
+	baseline map[int]bool
+
+	// maxFrames limits the frames of each stack in Find's error,
+	// unless it's negative.
+	maxFrames int
+
+	// resampleDelay is how long to wait before taking a second sample of
+	// stacks to compare leaked goroutines against, if positive.
+	resampleDelay time.Duration
+
+	// groupBy controls how leaked goroutines are collapsed in Find's error.
+	groupBy Grouping
+
+	// totalBudget caps the total time spent looking for leaks, if positive.
+	totalBudget time.Duration
+
+	// ignoreBeforeTestMain makes VerifyTestMain ignore goroutines with the
+	// same signature as any goroutine running before the tests.
+	ignoreBeforeTestMain bool
+
+	// persistentOnly limits leaks to goroutines with a signature
+	// that was found in every attempt.
+	persistentOnly bool
+
+	// cleanChecks is the number of consecutive attempts that must find no
+	// leaks, and cleanCheckGap is the time to sleep between them.
+	cleanChecks   int
+	cleanCheckGap time.Duration
+
+	// annotatePackages notes the packages on the stack of each leak.
+	annotatePackages bool
+
+	// suggestIgnores suggests options to ignore each leak.
+	suggestIgnores bool
+
+	// attributeTests notes the test that started each leak.
+	attributeTests bool
+
+	// annotateTimers notes leaks that are waiting on a timer.
+	annotateTimers bool
+
+	// leakCountFile is the path of the file used by LeakCountFile.
+	leakCountFile string
+
+	// shardIndex and totalShards identify the shard of the tests run by
+	// this process for LeakCountFile. If totalShards is 0, they're read
+	// from the environment.
+	shardIndex  int
+	totalShards int
+
+	// sortByWaitDuration reports the longest blocked leaks first.
+	sortByWaitDuration bool
+
+	// ignoreTestingDescendants ignores goroutines started on behalf of
+	// the testing package.
+	ignoreTestingDescendants bool
+
+	// ignoreLabels ignores goroutines with any of these sets of pprof labels.
+	ignoreLabels []labelSet
+
+	// onlyLabels limits leaks to goroutines with all of these sets of
+	// pprof labels.
+	onlyLabels []labelSet
+
+	// allowances are the numbers of leaked goroutines to tolerate.
+	allowances []leakAllowance
+
+	// includeAllStacks includes the stacks of all goroutines in the error.
+	includeAllStacks bool
+
+	// dumpStacks writes the stacks of all goroutines to dumpPath, or a new
+	// file in the test output directory if it's empty, on failure.
+	dumpStacks bool
+	dumpPath   string
+
+	// stableIDs reports leaks with sequence numbers rather than IDs.
+	stableIDs bool
+
+	// errorPerLeak makes VerifyNone report each leaked goroutine
+	// in a separate error.
+	errorPerLeak bool
+
+	// jsonReport, if set, is written a JSON report of any leaks found.
+	jsonReport io.Writer
+
+	// htmlReport, if set, is written an HTML report of any leaks found.
+	htmlReport io.Writer
+
+	// checkFDs makes VerifyTestMain look for leaked file descriptors.
+	checkFDs bool
+
+	// checkThreads makes VerifyTestMain look for leaked OS threads.
+	checkThreads bool
+
+	// checkHandles makes VerifyTestMain look for leaked Windows handles.
+	checkHandles bool
+
+	// ignoreThreadNames are the names of threads that CheckThreads ignores.
+	ignoreThreadNames []string
+
+	// checkHeap makes VerifyTestMain fail if the live heap grew by more
+	// than heapBudget bytes.
+	checkHeap  bool
+	heapBudget int64
+
+	// leakExitCode is the exit code used by VerifyTestMain if leaks are found.
+	leakExitCode int
+
+	// verifyOnFailure makes VerifyTestMain look for leaks after failed tests.
+	verifyOnFailure bool
+
+	// onExit is called by VerifyTestMain before it exits.
+	onExit func(exitCode int, err error)
+
+	// failNow makes VerifyNone stop the test after reporting leaks.
+	failNow bool
+
+	// warnOnly makes VerifyNone and VerifyTestMain report leaks
+	// without failing the tests.
+	warnOnly bool
+
+	// reportWriter, if set, is written the leaks reported by VerifyNone
+	// and VerifyTestMain.
+	reportWriter io.Writer
+
+	// color highlights parts of each leaked stack in Find's error.
+	color bool
+
+	// runningPolicy controls how leaks that are still running are reported.
+	runningPolicy RunningPolicy
 }
 
 // optionFunc lets us easily write options without a custom type.
@@ -57,47 +224,1051 @@ func IgnoreTopFunction(f string) Option {
 	})
 }
 
+// IgnoreAnyFunction ignores any goroutines where the specified function
+// is anywhere in the stack, not just at the top. This is useful when a library
+// blocks in different places depending on timing, but always below the same
+// function. The function name should be fully qualified,
+// e.g., go.uber.org/goleak.IgnoreAnyFunction
+func IgnoreAnyFunction(f string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return s.HasFunction(f)
+	})
+}
+
+// IgnoreTopFunctionInState ignores any goroutines where the specified function
+// is at the top of the stack, like IgnoreTopFunction, but only while they're in
+// the specified state, ignoring how long they've been blocked for. This is
+// useful when a goroutine is expected to be blocked in one state, but would be
+// leaked in another, e.g., IgnoreTopFunctionInState("pkg.(*Pool).run", "select").
+func IgnoreTopFunctionInState(f, state string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return s.FirstFunction() == f && s.BaseState() == state
+	})
+}
+
+// IgnoreTopPackage ignores any goroutines where the function at the top of
+// the stack is in the specified package. This is useful to ignore all
+// background goroutines of a third-party package without listing each
+// function. The import path should be fully qualified, e.g.,
+// go.uber.org/goleak, and also matches vendored copies of the package.
+func IgnoreTopPackage(importPath string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		frames := s.Frames()
+		return len(frames) > 0 && frames[0].Package() == importPath
+	})
+}
+
+// IgnorePackagePrefix ignores any goroutines that were created by a function
+// in a package with one of the specified import path prefixes, or where every
+// function on the stack outside of the standard library is in such a package.
+// A prefix matches the package with that import path and any packages below
+// it, so IgnorePackagePrefix("github.com/Shopify/sarama") ignores goroutines
+// of all sarama packages without listing their functions, even when they're
+// blocked in the standard library, e.g., reading from a net.Conn.
+func IgnorePackagePrefix(prefixes ...string) Option {
+	hasPrefix := func(pkg string) bool {
+		for _, prefix := range prefixes {
+			prefix = strings.TrimSuffix(prefix, "/")
+			if prefix != "" && (pkg == prefix || strings.HasPrefix(pkg, prefix+"/")) {
+				return true
+			}
+		}
+		return false
+	}
+	return addFilter(func(s stack.Stack) bool {
+		if hasPrefix(s.CreatedBy().Package()) {
+			return true
+		}
+
+		var matched bool
+		for _, f := range s.Frames() {
+			pkg := f.Package()
+			if isStdLibPackage(pkg) {
+				continue
+			}
+			if !hasPrefix(pkg) {
+				return false
+			}
+			matched = true
+		}
+		return matched
+	})
+}
+
+// IgnoreFirstNonRuntimeFunction ignores any goroutines where the specified
+// function is the first function on the stack outside of the runtime package.
+// Unlike IgnoreTopFunction, this matches the user code blocked in the runtime,
+// e.g., on a channel receive, even when runtime functions like runtime.gopark
+// are on top of the stack. The function name should be fully qualified,
+// e.g., go.uber.org/goleak.IgnoreFirstNonRuntimeFunction
+func IgnoreFirstNonRuntimeFunction(f string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return s.FirstNonRuntimeFunction() == f
+	})
+}
+
+// IgnoreCreatedBy ignores any goroutines that were created by the specified
+// function, as reported in the "created by" line of the stack. This is more
+// stable than the top function for goroutines started by other libraries,
+// where the function they block in may change between Go versions.
+// The function name should be fully qualified,
+// e.g., go.uber.org/goleak.IgnoreCreatedBy
+func IgnoreCreatedBy(f string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return f != "" && s.CreatedBy().Function == f
+	})
+}
+
+// IgnoreCreatedByFile ignores any goroutines that were created from the
+// specified file. The path matches the end of the file's full path at a
+// directory boundary, so a repo-relative path such as "internal/pool/pool.go"
+// matches the absolute path reported by the runtime. This is more stable than
+// the function name when goroutines are spawned by anonymous functions.
+func IgnoreCreatedByFile(path string) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return matchesFile(s.CreatedBy().File, path)
+	})
+}
+
+// IgnoreCreatedByLine ignores any goroutines that were created from the
+// specified line of the specified file. The path is matched like
+// IgnoreCreatedByFile.
+func IgnoreCreatedByLine(path string, line int) Option {
+	return addFilter(func(s stack.Stack) bool {
+		createdBy := s.CreatedBy()
+		return createdBy.Line == line && matchesFile(createdBy.File, path)
+	})
+}
+
+// IgnoreStackRegex ignores any goroutines where the full text of the stack,
+// formatted as by runtime.Stack, matches the specified regular expression.
+// This is an escape hatch for conditions that can't be expressed with the
+// other options, e.g., IgnoreStackRegex(`(?s)/pkg/pool/.*created by main\.main`).
+// It panics if the pattern is not a valid regular expression.
+func IgnoreStackRegex(pattern string) Option {
+	re := regexp.MustCompile(pattern)
+	return addFilter(func(s stack.Stack) bool {
+		return re.MatchString(s.Full())
+	})
+}
+
+// IgnoreShallowStacks ignores any goroutines with fewer than minFrames
+// function calls on the stack, not including the function that created the
+// goroutine. Very short stacks are often scaffolding rather than leaks, but
+// this is only a heuristic: a goroutine that leaks at the top level of its
+// function, e.g., blocked receiving from a channel, may have a single frame
+// if runtime frames are inlined or elided, and would not be reported.
+func IgnoreShallowStacks(minFrames int) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return len(s.Frames()) < minFrames
+	})
+}
+
+// IgnoreStates ignores any goroutines in one of the specified states,
+// regardless of how long they've been blocked for, e.g., IgnoreStates("select")
+// ignores goroutines in the "select, 5 minutes" state. Other qualifiers of the
+// state are ignored unless they're specified, so "select" also matches
+// "select, locked to thread", while "select, locked to thread" only matches
+// goroutines locked to a thread.
+//
+// Use OnlyStates instead to describe the states that should be considered.
+func IgnoreStates(states ...string) Option {
+	return addFilter(inStates(states))
+}
+
+// OnlyStates limits Find to only consider goroutines in one of the specified
+// states as potential leaks, matching states like IgnoreStates, and all
+// other goroutines are ignored. This is useful when only blocked goroutines
+// are of interest, e.g., OnlyStates("chan receive", "chan send", "select")
+// ignores runnable goroutines, which are busy rather than stuck.
+//
+// Goroutines in these states may still be ignored by other options.
+// If OnlyStates is specified multiple times, goroutines must be in one of the
+// states of every option to be considered.
+func OnlyStates(states ...string) Option {
+	match := inStates(states)
+	return addFilter(func(s stack.Stack) bool {
+		return !match(s)
+	})
+}
+
+// inStates returns a predicate that matches goroutines in one of the
+// given states, as documented by IgnoreStates.
+func inStates(states []string) func(stack.Stack) bool {
+	set := make(map[string]bool, len(states))
+	for _, state := range states {
+		set[state] = true
+	}
+	return func(s stack.Stack) bool {
+		base := s.BaseState()
+		if idx := strings.Index(base, ", "); idx >= 0 && set[base[:idx]] {
+			return true
+		}
+		return set[base]
+	}
+}
+
+// IgnoreRuntimeInternal ignores any goroutines that only have runtime frames
+// on the stack and were created by the runtime, without any user or other
+// standard library frames, such as GC workers, the finalizer goroutine, or the
+// timer goroutine of older Go versions. Depending on timing and the Go version,
+// these goroutines occasionally show up in the stacks of all goroutines.
+func IgnoreRuntimeInternal() Option {
+	return addFilter(isRuntimeInternalStack)
+}
+
+// IgnoreTestingDescendants ignores any goroutines started by the testing
+// package, or by the standard library on behalf of goroutines that were
+// themselves started by the testing package, such as timers used for test
+// timeouts. Rather than matching known function names, this walks up the
+// chain of goroutines that created each goroutine, until it finds a creator in
+// the testing package, or a creator goroutine running code outside of the
+// standard library, e.g., a test function, whose goroutines are not ignored.
+//
+// The runtime only reports the ID of the creator goroutine since Go 1.21, and
+// only while the creator is running, so on earlier versions, only goroutines
+// created directly by the testing package are ignored.
+func IgnoreTestingDescendants() Option {
+	return optionFunc(func(opts *opts) {
+		opts.ignoreTestingDescendants = true
+	})
+}
+
+// MinBlockedDuration ignores any goroutines that have been blocked for less
+// than the specified duration. The runtime only reports how long a goroutine
+// has been blocked once it's been blocked for at least a minute, so goroutines
+// that have been blocked for less than that, or that are not blocked, are
+// treated as having been blocked for 0, and are ignored for any d > 0.
+// This is useful to only report long-lived leaks, e.g., in long-running tests.
+func MinBlockedDuration(d time.Duration) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return s.WaitDuration() < d
+	})
+}
+
+// Filter ignores any goroutines for which the predicate returns true. This
+// allows any custom logic using the parsed stack, such as its ID, state and
+// frames, when none of the other options fit:
+//
+//	goleak.Filter(func(s goleak.Stack) bool {
+//		return s.State() == "IO wait" && len(s.Frames()) > 10
+//	})
+//
+// Use OnlyConsider instead to describe the goroutines that should be
+// considered rather than those to ignore.
+func Filter(f func(Stack) bool) Option {
+	return addFilter(f)
+}
+
+// OnlyConsider limits Find to only consider goroutines for which the
+// predicate returns true as potential leaks, and all other goroutines are
+// ignored. This is useful when it's easier to describe the goroutines owned
+// by the code under test than all the other goroutines that may be running:
+//
+//	goleak.OnlyConsider(func(s goleak.Stack) bool {
+//		return strings.HasPrefix(s.CreatedBy().Function, "example.com/mypkg.")
+//	})
+//
+// Goroutines that are considered may still be ignored by other options.
+// If OnlyConsider is specified multiple times, goroutines must match
+// every predicate to be considered.
+func OnlyConsider(f func(Stack) bool) Option {
+	return addFilter(func(s stack.Stack) bool {
+		return !f(s)
+	})
+}
+
+// IgnorePprofLabels ignores any goroutines with all of the specified pprof
+// labels, given as key-value pairs like pprof.Labels. This is useful for
+// background goroutines that already label themselves using pprof.Do:
+//
+//	goleak.IgnorePprofLabels("component", "metrics-flusher")
+//
+// Labels are matched using the goroutine profile, which only identifies
+// goroutines by their stack, so if goroutines with the same stack have
+// different labels, none of them are ignored. It panics if given an odd
+// number of arguments.
+func IgnorePprofLabels(keyValues ...string) Option {
+	if len(keyValues)%2 != 0 {
+		panic("uneven number of arguments to goleak.IgnorePprofLabels")
+	}
+	labels := make(labelSet, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		labels[keyValues[i]] = keyValues[i+1]
+	}
+	return optionFunc(func(opts *opts) {
+		if len(labels) > 0 {
+			opts.ignoreLabels = append(opts.ignoreLabels, labels)
+		}
+	})
+}
+
+// OnlyPprofLabels limits Find to only consider goroutines with all of the
+// specified pprof labels, given as key-value pairs like pprof.Labels, as
+// potential leaks, and all other goroutines are ignored. Goroutines inherit
+// the labels of the goroutine that starts them, so this is useful to only
+// look for goroutines started on behalf of some labeled code, as done by
+// Track for tests.
+//
+// Labels are matched using the goroutine profile, like IgnorePprofLabels, so
+// if goroutines with the same stack have different labels, all of them are
+// considered. If OnlyPprofLabels is specified multiple times, goroutines must
+// have the labels of every option to be considered. It panics if given an
+// odd number of arguments.
+func OnlyPprofLabels(keyValues ...string) Option {
+	if len(keyValues)%2 != 0 {
+		panic("uneven number of arguments to goleak.OnlyPprofLabels")
+	}
+	labels := make(labelSet, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		labels[keyValues[i]] = keyValues[i+1]
+	}
+	return optionFunc(func(opts *opts) {
+		if len(labels) > 0 {
+			opts.onlyLabels = append(opts.onlyLabels, labels)
+		}
+	})
+}
+
+// AllowLeaks tolerates up to n leaked goroutines, so Find only reports leaks
+// if more than n goroutines are found, and then reports all of them.
+// Use AllowLeaksMatching to only tolerate specific goroutines.
+func AllowLeaks(n int) Option {
+	return AllowLeaksMatching(n, func(Stack) bool { return true })
+}
+
+// AllowLeaksMatching tolerates up to n leaked goroutines for which the
+// predicate returns true, e.g., for a third-party library that always leaves
+// a goroutine behind:
+//
+//	goleak.AllowLeaksMatching(1, func(s goleak.Stack) bool {
+//		return strings.HasPrefix(s.FirstFunction(), "example.com/driver.")
+//	})
+//
+// If more than n goroutines match, all of them are reported. Goroutines that
+// are ignored by other options don't count towards n. If specified multiple
+// times, each predicate tolerates its own number of goroutines.
+func AllowLeaksMatching(n int, f func(Stack) bool) Option {
+	return optionFunc(func(opts *opts) {
+		opts.allowances = append(opts.allowances, leakAllowance{n: n, match: f})
+	})
+}
+
+// leakAllowance is a number of leaked goroutines to tolerate.
+type leakAllowance struct {
+	n     int
+	match func(stack.Stack) bool
+}
+
+// _defaultIgnores are the filters for goroutines that are ignored by default,
+// since they're started by the testing package or the runtime.
+var _defaultIgnores = []func(stack.Stack) bool{
+	isTestStack,
+	isSyscallStack,
+	isStdLibStack,
+	isTraceStack,
+	isJSEventStack,
+	isRuntimeGCStack,
+}
+
+// DefaultIgnores returns the options that goleak applies by default to ignore
+// goroutines that aren't started by the code under test, such as those run
+// by the testing package, the runtime's garbage collector, signal handling,
+// execution tracing and the js/wasm event loop.
+//
+// Together with WithoutDefaultIgnores, it can be used as the starting point
+// for a curated list of ignores:
+//
+//	opts := append(goleak.DefaultIgnores(), goleak.IgnoreTopFunction("..."))
+//	goleak.VerifyNone(t, append(opts, goleak.WithoutDefaultIgnores())...)
+func DefaultIgnores() []Option {
+	options := make([]Option, len(_defaultIgnores))
+	for i, f := range _defaultIgnores {
+		options[i] = addFilter(f)
+	}
+	return options
+}
+
+// WithoutDefaultIgnores disables the goroutines that goleak ignores by
+// default, as returned by DefaultIgnores, so goroutines of the testing
+// package and the runtime are reported unless ignored by other options.
+// Functions ignored using the GOLEAK_IGNORE environment variable are still
+// ignored.
+func WithoutDefaultIgnores() Option {
+	return optionFunc(func(opts *opts) {
+		opts.withoutDefaultIgnores = true
+	})
+}
+
 // IgnoreCurrent records all current goroutines when the option is created, and ignores
 // them in any future Find/Verify calls.
 func IgnoreCurrent() Option {
-	excludeIDSet := map[int]bool{}
-	for _, s := range stack.All() {
-		excludeIDSet[s.ID()] = true
-	}
+	return NewSnapshot().ignore()
+}
+
+// IgnoreBeforeTestMain makes VerifyTestMain record the goroutines running
+// before any tests run, such as those started by init functions of imported
+// packages, and ignore them when looking for leaks after the tests.
+// Goroutines are matched by their signature rather than their ID, so a
+// background goroutine that is restarted during the tests is also ignored.
+// It has no effect on Find or VerifyNone.
+func IgnoreBeforeTestMain() Option {
+	return optionFunc(func(opts *opts) {
+		opts.ignoreBeforeTestMain = true
+	})
+}
+
+// CheckFDs makes VerifyTestMain record the open file descriptors before any
+// tests run, and fail if any descriptors opened by the tests are still open
+// after the tests, reporting what each one refers to, such as a file path or
+// "socket:[12345]":
+//
+//	goleak.VerifyTestMain(m, goleak.CheckFDs())
+//
+// File descriptors are only listed on Linux, using /proc/self/fd, and the
+// check is skipped with a warning on other platforms.
+// It has no effect on Find or VerifyNone.
+func CheckFDs() Option {
+	return optionFunc(func(opts *opts) {
+		opts.checkFDs = true
+	})
+}
+
+// CheckThreads makes VerifyTestMain count the OS threads before any tests run,
+// and fail if there are more threads that were not started by the Go runtime
+// after the tests, such as threads started by C code using cgo:
+//
+//	goleak.VerifyTestMain(m, goleak.CheckThreads())
+//
+// Threads started by the Go runtime are not counted, since the runtime keeps
+// idle threads around to reuse them. A thread locked to a goroutine using
+// runtime.LockOSThread is only kept while the goroutine is running, so it's
+// reported as a leaked goroutine instead.
+//
+// The names of new threads are reported where available, which helps find
+// the library that started them, and threads that are expected to keep
+// running can be ignored by name using IgnoreThreadNames.
+//
+// Threads are only counted on Linux, using /proc/self/task, and the check is
+// skipped with a warning on other platforms.
+// It has no effect on Find or VerifyNone.
+func CheckThreads() Option {
+	return optionFunc(func(opts *opts) {
+		opts.checkThreads = true
+	})
+}
+
+// IgnoreThreadNames makes CheckThreads ignore threads with any of the given
+// names, such as the background threads of a C library that are started once
+// and never exit:
+//
+//	goleak.VerifyTestMain(m, goleak.CheckThreads(), goleak.IgnoreThreadNames("grpc_global_tim"))
+//
+// Names are matched exactly, as reported by the OS, which truncates them to
+// 15 bytes on Linux. It has no effect without CheckThreads.
+func IgnoreThreadNames(names ...string) Option {
+	return optionFunc(func(opts *opts) {
+		opts.ignoreThreadNames = append(opts.ignoreThreadNames, names...)
+	})
+}
+
+// CheckHandles makes VerifyTestMain count the open handles of the process
+// before any tests run, and fail if more handles are open after the tests,
+// such as files, events or registry keys that were not closed. This is like
+// CheckFDs, for Windows:
+//
+//	goleak.VerifyTestMain(m, goleak.CheckHandles())
+//
+// The Go runtime opens a few handles for each OS thread it starts, which are
+// kept while the thread is running, so the count allows for these handles.
+//
+// Handles are only counted on Windows, using GetProcessHandleCount, and the
+// check is skipped with a warning on other platforms.
+// It has no effect on Find or VerifyNone.
+func CheckHandles() Option {
+	return optionFunc(func(opts *opts) {
+		opts.checkHandles = true
+	})
+}
+
+// CheckHeap makes VerifyTestMain measure the live heap before any tests run,
+// and fail if it grew by more than budget bytes after the tests, reporting
+// the allocation sites with the most growth according to the heap profile:
+//
+//	goleak.VerifyTestMain(m, goleak.CheckHeap(64<<20))
+//
+// Garbage is collected before measuring the heap, so only memory that's still
+// reachable after the tests is counted, such as objects added to a global
+// cache, or referenced by leaked goroutines. The heap profile only samples
+// allocations, so small allocations may not be reported.
+// It has no effect on Find or VerifyNone.
+func CheckHeap(budget int64) Option {
+	return optionFunc(func(opts *opts) {
+		opts.checkHeap = true
+		opts.heapBudget = budget
+	})
+}
+
+// ignoreSignatures ignores any goroutines with one of the given signatures.
+func ignoreSignatures(signatures map[string]bool) Option {
 	return addFilter(func(s stack.Stack) bool {
-		return excludeIDSet[s.ID()]
+		return signatures[s.Signature()]
 	})
 }
 
-func maxSleep(d time.Duration) Option {
+// currentSignatures returns the signatures of all current goroutines.
+func currentSignatures() map[string]bool {
+	// Any goroutines that could not be parsed are reported by Find.
+	stacks, _ := stack.All()
+	signatures := make(map[string]bool, len(stacks))
+	for _, s := range stacks {
+		signatures[s.Signature()] = true
+	}
+	return signatures
+}
+
+// MaxRetries sets the maximum number of times Find retries looking for leaks
+// after the first attempt, to give goroutines time to exit. This defaults to 20.
+// Use MaxRetries(0) to check exactly once, which makes tests with a leak fail
+// quickly, but may report goroutines that are about to exit as leaks.
+func MaxRetries(n int) Option {
+	return optionFunc(func(opts *opts) {
+		opts.maxRetries = n
+	})
+}
+
+// MaxSleep sets the maximum time that Find sleeps between attempts, as the time
+// to sleep starts at 1µs and doubles after each attempt. This defaults to 100ms.
+// Along with MaxRetries and TotalBudget, this controls how long Find waits for
+// goroutines to exit, e.g., for tests where shutting down takes a few seconds:
+//
+//	goleak.VerifyNone(t, goleak.MaxSleep(time.Second), goleak.TotalBudget(5*time.Second))
+func MaxSleep(d time.Duration) Option {
 	return optionFunc(func(opts *opts) {
 		opts.maxSleep = d
 	})
 }
 
+// RetryJitter randomly adjusts the time that Find sleeps between attempts by
+// up to the given fraction of it, in either direction. This defaults to 0.1,
+// and avoids many processes checking for leaks at the same time: getting the
+// stacks of all goroutines briefly stops the world, so synchronized checks can
+// cause latency spikes on busy machines. Use RetryJitter(0) to disable jitter.
+func RetryJitter(fraction float64) Option {
+	return optionFunc(func(opts *opts) {
+		opts.retryJitter = fraction
+	})
+}
+
+// TotalBudget caps the total time that Find spends looking for leaks across
+// all attempts, regardless of the number of retries or the time to sleep
+// between them. Once the budget is used up, Find stops retrying and reports
+// the leaks found by the last attempt. This bounds the overhead of checking
+// for leaks, e.g., across the packages of a large test suite.
+func TotalBudget(d time.Duration) Option {
+	return optionFunc(func(opts *opts) {
+		opts.totalBudget = d
+	})
+}
+
+// WithClock sets the clock used to measure time and sleep between attempts
+// while looking for leaks, e.g., to drive retries and TotalBudget from a fake
+// clock in tests without real delays. By default, the time package is used.
+func WithClock(c Clock) Option {
+	return optionFunc(func(opts *opts) {
+		opts.clock = c
+	})
+}
+
+// PersistentOnly limits the leaks reported by Find to goroutines whose stack
+// signature was found in every attempt, rather than all goroutines found by
+// the last attempt. Goroutines that are missing from any attempt are likely
+// transient, e.g., short-lived goroutines started in the background, so this
+// reduces flaky reports at the cost of missing leaks whose stacks change.
+// Find stops retrying as soon as no goroutines persisted.
+func PersistentOnly() Option {
+	return optionFunc(func(opts *opts) {
+		opts.persistentOnly = true
+	})
+}
+
+// RequireCleanChecks makes Find check for leaks again after finding none,
+// until n consecutive checks, with the given gap between them, have found no
+// leaks. This catches goroutines that are started shortly after a clean check,
+// e.g., by a callback that runs after the code under test returns. If leaks
+// are found after a clean check, Find retries as usual. Checks stop early,
+// without reporting leaks, once the TotalBudget is used up.
+func RequireCleanChecks(n int, gap time.Duration) Option {
+	return optionFunc(func(opts *opts) {
+		opts.cleanChecks = n
+		opts.cleanCheckGap = gap
+	})
+}
+
+// RetryOnlyFor limits retrying to cases where every remaining goroutine has
+// one of the specified functions at the top of the stack. If any other
+// goroutines remain, Find fails immediately rather than waiting for them to
+// exit. This is useful when only a few known goroutines take a while to stop.
+// The function names should be fully qualified, e.g.,
+// go.uber.org/goleak.RetryOnlyFor
+func RetryOnlyFor(topFunctions ...string) Option {
+	return optionFunc(func(opts *opts) {
+		if opts.retryOnlyFor == nil {
+			opts.retryOnlyFor = make(map[string]bool, len(topFunctions))
+		}
+		for _, f := range topFunctions {
+			opts.retryOnlyFor[f] = true
+		}
+	})
+}
+
+// AnnotateBaseline records all current goroutines when the option is created,
+// and annotates each goroutine reported by future Find/Verify calls as either
+// "pre-existing" if it was running when the option was created, or
+// "new since start" otherwise. Unlike IgnoreCurrent, pre-existing goroutines
+// are still reported.
+//
+// When passed to VerifyTestMain, the baseline is recorded before any tests run:
+//
+//	goleak.VerifyTestMain(m, goleak.AnnotateBaseline())
+func AnnotateBaseline() Option {
+	stacks, _ := stack.All()
+	baseline := map[int]bool{}
+	for _, s := range stacks {
+		baseline[s.ID()] = true
+	}
+	return optionFunc(func(opts *opts) {
+		opts.baseline = baseline
+	})
+}
+
+// Resample takes a second sample of stacks after the given delay when Find
+// finds leaked goroutines, and notes whether each leaked goroutine changed
+// between the two samples in Find's error. A goroutine that changed or exited
+// is likely still winding down, while one that's unchanged is likely leaked.
+func Resample(delay time.Duration) Option {
+	return optionFunc(func(opts *opts) {
+		opts.resampleDelay = delay
+	})
+}
+
+// AnnotatePackages notes the distinct packages of the functions on the stack
+// of each leaked goroutine reported by Find, starting from the top of the
+// stack, e.g., "(packages: runtime example.com/pkg/worker)". This helps route
+// leaks to the owners of the packages involved.
+func AnnotatePackages() Option {
+	return optionFunc(func(opts *opts) {
+		opts.annotatePackages = true
+	})
+}
+
+// SuggestIgnores adds the options that would ignore the leaked goroutines to
+// the error returned by Find, ready to copy into the test, e.g.:
+//
+//	suggested options to ignore these goroutines:
+//		goleak.IgnoreTopFunction("example.com/pool.(*Pool).run"), // or
+//		goleak.IgnoreCreatedBy("example.com/pool.New"),
+//
+// This lowers the cost of ignoring known leaks when adopting goleak, but
+// leaks should only be ignored once they're known to be benign.
+func SuggestIgnores() Option {
+	return optionFunc(func(opts *opts) {
+		opts.suggestIgnores = true
+	})
+}
+
+// AttributeTests notes the test that started each leaked goroutine reported by
+// Find, e.g., "(started by TestServer)". This is most useful with
+// VerifyTestMain, where leaks are only found after all tests have run:
+//
+//	goleak.VerifyTestMain(m, goleak.AttributeTests())
+//
+// A goroutine is attributed to the first test function found by walking up
+// its chain of creators: the function that created it, then the stack and
+// creator of the goroutine that created it, if that goroutine is still running.
+// Creator IDs are only reported since Go 1.21, and a leak can't be attributed
+// once the chain is broken by a goroutine that exited, so no test is noted
+// in that case.
+func AttributeTests() Option {
+	return optionFunc(func(opts *opts) {
+		opts.attributeTests = true
+	})
+}
+
+// AnnotateTimers notes leaked goroutines reported by Find that are sleeping in
+// time.Sleep or running a time.AfterFunc callback, e.g., "(sleeping in
+// time.Sleep, stop a time.Timer or cancel a context instead)".
+//
+// Goroutines waiting on the channel of a time.Timer or time.Ticker, such as
+// those returned by time.Tick or time.After, aren't noted, since the runtime
+// reports them like goroutines waiting on any other channel. Timers that
+// don't hold a goroutine, such as an unstopped time.Ticker that nothing
+// receives from, are not reported, since the runtime doesn't expose the
+// number of timers.
+func AnnotateTimers() Option {
+	return optionFunc(func(opts *opts) {
+		opts.annotateTimers = true
+	})
+}
+
+// SortByWaitDuration reports the leaked goroutines that have been blocked the
+// longest first, as these are the most likely to be leaked. The runtime only
+// reports how long a goroutine has been blocked once it's been blocked for at
+// least a minute, so this is mostly useful for long-running processes.
+// Goroutines blocked for the same duration are reported in the default order.
+func SortByWaitDuration() Option {
+	return optionFunc(func(opts *opts) {
+		opts.sortByWaitDuration = true
+	})
+}
+
+// MaxFrames limits the stack of each leaked goroutine reported by Find to the
+// top n frames, followed by the function that created the goroutine.
+// This keeps the error readable when leaked goroutines have deep stacks.
+func MaxFrames(n int) Option {
+	return optionFunc(func(opts *opts) {
+		opts.maxFrames = n
+	})
+}
+
+// LeakCountFile ratchets down the number of leaked goroutines, failing only if
+// Find finds more leaks than the count recorded in the file at the given path.
+// If Find finds fewer leaks, the recorded count is lowered to match, so the
+// count can only decrease over time. This is useful for gradually fixing leaks
+// in legacy code, where failing on any leak is not yet feasible:
+//
+//	goleak.VerifyTestMain(m, goleak.LeakCountFile("testdata/leaks.count"))
+//
+// If the file doesn't exist, or the GOLEAK_UPDATE environment variable is set
+// to a non-empty value, the current count is recorded without failing.
+//
+// If the tests of the package are split across processes, as indicated by
+// the TEST_TOTAL_SHARDS and TEST_SHARD_INDEX environment variables set by
+// Bazel, or by Shard, each shard records its own count in a file named
+// after path, e.g., "testdata/leaks.shard-0-of-4.count", since each shard
+// runs different tests.
+func LeakCountFile(path string) Option {
+	return optionFunc(func(opts *opts) {
+		opts.leakCountFile = path
+	})
+}
+
+// Shard specifies that the tests run by this process are the shard with
+// the given index, starting at 0, of total shards, for test runners that split
+// the tests of a package across processes without setting the
+// TEST_TOTAL_SHARDS and TEST_SHARD_INDEX environment variables.
+// This is used by LeakCountFile to record a separate count for each shard,
+// and overrides the environment variables. It panics if index is not in
+// [0, total).
+func Shard(index, total int) Option {
+	if index < 0 || index >= total {
+		panic(fmt.Sprintf("goleak.Shard index %v is out of range for %v shards", index, total))
+	}
+	return optionFunc(func(opts *opts) {
+		opts.shardIndex = index
+		opts.totalShards = total
+	})
+}
+
+// IncludeAllStacksOnFailure includes the stacks of all goroutines, including
+// those that were ignored, after the leaked goroutines in the error returned
+// by Find when any leaks are found. This helps debug leaks where a leaked
+// goroutine is blocked on an ignored goroutine, e.g., one holding a lock.
+// With ErrorPerLeak, the stacks are reported in a separate error.
+// The stacks of all goroutines can be large, so this is opt-in.
+func IncludeAllStacksOnFailure() Option {
+	return optionFunc(func(opts *opts) {
+		opts.includeAllStacks = true
+	})
+}
+
+// DumpStacksOnFailure writes the stacks of all goroutines, including those
+// that were ignored, to a file when any leaks are found, and notes the path
+// of the file in the error returned by Find. Unlike IncludeAllStacksOnFailure,
+// this keeps the error short, while the full context is available to debug
+// the leaks. The file is overwritten if it exists. If path is empty, a new
+// file is created in the directory set using go test -outputdir, or in
+// os.TempDir if it's not set.
+func DumpStacksOnFailure(path string) Option {
+	return optionFunc(func(opts *opts) {
+		opts.dumpStacks = true
+		opts.dumpPath = path
+	})
+}
+
+// ErrorPerLeak makes VerifyNone report each leaked goroutine with a separate
+// call to t.Error, rather than a single error listing all of them. Each error
+// starts with a one-line headline naming the function on top of the stack,
+// followed by the goroutine's stack, indented:
+//
+//	found unexpected goroutine 7 with example.com/pkg.(*Server).serve on top of the stack:
+//		goroutine 7 [chan receive]:
+//		...
+//
+// This helps tools that parse test output attribute each leak individually.
+// It has no effect on Find or VerifyTestMain, and leaks are not grouped.
+func ErrorPerLeak() Option {
+	return optionFunc(func(opts *opts) {
+		opts.errorPerLeak = true
+	})
+}
+
+// StableIDs reports leaked goroutines in a stable order, by their stack
+// signature and then their ID, numbered from 1 rather than by their goroutine
+// IDs, which vary between runs. The real ID of each goroutine is still noted
+// once:
+//
+//	Goroutine 1 (ID 4711) in state chan receive, with ...
+//	goroutine 1 [chan receive]:
+//
+// This reduces noise when comparing leak reports across runs. The stacks
+// returned by FindReport keep their real IDs.
+func StableIDs() Option {
+	return optionFunc(func(opts *opts) {
+		opts.stableIDs = true
+	})
+}
+
+// ReportJSON writes a JSON report of the leaked goroutines to w whenever
+// leaks are found, such as by Find, VerifyNone or VerifyTestMain, in addition
+// to the error. The report is a single line with the ID, state, first function,
+// frames and creator of each leaked goroutine:
+//
+//	{"goroutines":[{"id":7,"state":"chan receive","firstFunction":"example.com/pkg.(*Server).serve",...}]}
+//
+// This lets tools consume leak reports without parsing the error message.
+// Errors writing to w are ignored.
+func ReportJSON(w io.Writer) Option {
+	return optionFunc(func(opts *opts) {
+		opts.jsonReport = w
+	})
+}
+
+// ReportHTML writes a self-contained HTML page describing the leaked
+// goroutines to w whenever leaks are found, such as by Find, VerifyNone or
+// VerifyTestMain, in addition to the error. The page has a collapsible
+// section with the stack of each leaked goroutine, grouped as specified by
+// GroupBy, along with controls to filter them by state or text, which makes
+// it easier to browse the leaks of large test suites, e.g., as a CI artifact.
+// Errors writing to w are ignored.
+func ReportHTML(w io.Writer) Option {
+	return optionFunc(func(opts *opts) {
+		opts.htmlReport = w
+	})
+}
+
+// ReportTo writes the leaks reported by VerifyNone and VerifyTestMain to w,
+// such as a file archived by CI. VerifyNone writes each error it reports to w
+// in addition to the TestingT, and VerifyTestMain writes to w instead of
+// standard error, so use io.MultiWriter to keep both:
+//
+//	goleak.VerifyTestMain(m, goleak.ReportTo(io.MultiWriter(os.Stderr, f)))
+//
+// This option has no effect on Find, which returns the leaks as an error.
+// Errors writing to w are ignored.
+func ReportTo(w io.Writer) Option {
+	return optionFunc(func(opts *opts) {
+		opts.reportWriter = w
+	})
+}
+
+// Grouping controls how leaked goroutines are collapsed when they're reported.
+type Grouping int
+
+const (
+	// GroupByNone reports every leaked goroutine separately.
+	GroupByNone Grouping = iota
+
+	// GroupBySignature collapses leaked goroutines with the same stack,
+	// ignoring goroutine IDs, function arguments and PC offsets.
+	GroupBySignature
+
+	// GroupByCreatedBy collapses leaked goroutines created by the same
+	// function, even if they are blocked at different places.
+	GroupByCreatedBy
+)
+
+// GroupBy collapses leaked goroutines with the same grouping key in the
+// error returned by Find, reporting the number of goroutines in each group
+// along with the full stack of the first goroutine in the group:
+//
+//	42 goroutines created by pool.(*Pool).spawn (IDs: 12, 13, ...), such as:
+func GroupBy(g Grouping) Option {
+	return optionFunc(func(opts *opts) {
+		opts.groupBy = g
+	})
+}
+
+// RunningPolicy controls how goroutines that are still runnable or running
+// once Find stops retrying are reported. Unlike goroutines that are parked,
+// e.g., waiting on a channel, these goroutines may be busy, such as a loop
+// that's about to exit, rather than blocked forever.
+type RunningPolicy int
+
+const (
+	// RunningFail reports goroutines that are still running as leaks,
+	// in a separate section of Find's error from parked goroutines.
+	RunningFail RunningPolicy = iota
+
+	// RunningWarn doesn't report goroutines that are still running as leaks,
+	// but reports them as a warning: in a separate section of Find's error if
+	// there are other leaks, and otherwise using the Log method of the
+	// TestingT passed to VerifyNone, or the output of VerifyTestMain, which
+	// are also written to the writer set using ReportTo.
+	RunningWarn
+
+	// RunningIgnore ignores goroutines that are still running.
+	RunningIgnore
+)
+
+// HandleRunning controls how goroutines that are still runnable or running
+// after the last attempt are reported. By default, they're reported as leaks
+// using RunningFail. Use IgnoreStates to ignore goroutines in these states
+// before retrying instead.
+func HandleRunning(p RunningPolicy) Option {
+	return optionFunc(func(opts *opts) {
+		opts.runningPolicy = p
+	})
+}
+
+// LeakExitCode sets the exit code used by VerifyTestMain when it finds leaks
+// on an otherwise successful test run. This defaults to 1, and can be used
+// to distinguish leaks from test failures.
+// This option has no effect on Find or VerifyNone.
+func LeakExitCode(code int) Option {
+	return optionFunc(func(opts *opts) {
+		opts.leakExitCode = code
+	})
+}
+
+// VerifyOnFailure makes VerifyTestMain look for leaks even if the tests fail,
+// reporting any that are found to stderr. A failed test often leaks the
+// goroutines it started, and the leaks can help explain the failure.
+// The exit code of a failed test run is not changed.
+// This option has no effect on Find or VerifyNone.
+func VerifyOnFailure() Option {
+	return optionFunc(func(opts *opts) {
+		opts.verifyOnFailure = true
+	})
+}
+
+// OnExit sets a function that VerifyTestMain calls with the exit code and
+// any leaks that were found, just before the process exits. The error is nil
+// if no leaks were found, and errors.As can be used to get the *LeakError
+// for leaked goroutines. The function can flush coverage data or report the
+// results elsewhere, or exit itself to replace the call to os.Exit.
+// This option has no effect on Find or VerifyNone.
+func OnExit(f func(exitCode int, err error)) Option {
+	return optionFunc(func(opts *opts) {
+		opts.onExit = f
+	})
+}
+
+// WarnOnly makes VerifyNone and VerifyTestMain report leaks without failing
+// the tests. VerifyNone logs the leaks using the test's Log method if it has
+// one, e.g., a *testing.T, and writes them to stderr otherwise.
+// VerifyTestMain writes the leaks to stderr, but doesn't change the exit code.
+// This is useful to make leaks visible while adopting goleak in a large
+// codebase, before failing tests for them.
+// This option has no effect on Find.
+func WarnOnly() Option {
+	return optionFunc(func(opts *opts) {
+		opts.warnOnly = true
+	})
+}
+
+// FailNow makes VerifyNone stop the test by calling t.FailNow after reporting
+// any leaks, like t.Fatal, if t has a FailNow method, as testing.TB does, so
+// that the test doesn't continue after a leak. Like t.FailNow, VerifyNone must
+// then be called from the goroutine running the test.
+// This option has no effect on Find, VerifyTestMain, or with WarnOnly.
+func FailNow() Option {
+	return optionFunc(func(opts *opts) {
+		opts.failNow = true
+	})
+}
+
+func withContext(ctx context.Context) Option {
+	return optionFunc(func(opts *opts) {
+		opts.ctx = ctx
+	})
+}
+
 func addFilter(f func(stack.Stack) bool) Option {
 	return optionFunc(func(opts *opts) {
 		opts.filters = append(opts.filters, f)
 	})
 }
 
+// _registeredOptions are the options installed by RegisterDefaultOptions.
+var _registeredOptions struct {
+	sync.Mutex
+	options []Option
+}
+
+// RegisterDefaultOptions installs options that are applied by every
+// subsequent call that takes options in the process, such as Find, VerifyNone
+// and VerifyTestMain, before the options passed to the call, so that ignores
+// shared by many packages can be set up once, e.g., in the init function of
+// a test helper package:
+//
+//	func init() {
+//		goleak.RegisterDefaultOptions(
+//			goleak.IgnoreTopFunction("go.opencensus.io/stats/view.(*worker).start"),
+//		)
+//	}
+//
+// Options passed to a call override registered options that set the same
+// value, such as MaxRetries. Registering options multiple times adds to the
+// previously registered options.
+func RegisterDefaultOptions(options ...Option) {
+	_registeredOptions.Lock()
+	defer _registeredOptions.Unlock()
+	_registeredOptions.options = append(_registeredOptions.options, options...)
+}
+
+// registeredOptions returns a copy of the options installed by
+// RegisterDefaultOptions.
+func registeredOptions() []Option {
+	_registeredOptions.Lock()
+	defer _registeredOptions.Unlock()
+	return append([]Option(nil), _registeredOptions.options...)
+}
+
 func buildOpts(options ...Option) *opts {
 	opts := &opts{
-		maxRetries: _defaultRetries,
-		maxSleep:   100 * time.Millisecond,
-	}
-	opts.filters = append(opts.filters,
-		isTestStack,
-		isSyscallStack,
-		isStdLibStack,
-		isTraceStack,
-	)
-	for _, option := range options {
+		maxRetries:  _defaultRetries,
+		maxSleep:    _defaultMaxSleep,
+		cleanChecks: 1,
+		retryJitter: _defaultRetryJitter,
+		clock:       realClock{},
+		ctx:         context.Background(),
+		sample:      stack.All,
+		maxFrames:   -1,
+
+		leakExitCode: 1,
+	}
+	for _, option := range append(registeredOptions(), options...) {
 		option.apply(opts)
 	}
+	if !opts.withoutDefaultIgnores {
+		opts.filters = append(opts.filters, _defaultIgnores...)
+	}
+	if ignored := ignoredByEnv(); ignored != nil {
+		opts.filters = append(opts.filters, ignored)
+	}
 	return opts
 }
 
+// matchesFile reports whether the given file path is the specified path or
+// ends with it, starting at a directory boundary.
+func matchesFile(file, path string) bool {
+	if path == "" {
+		return false
+	}
+	return file == path || strings.HasSuffix(file, "/"+strings.TrimPrefix(path, "/"))
+}
+
 func (vo *opts) filter(s stack.Stack) bool {
 	for _, filter := range vo.filters {
 		if filter(s) {
@@ -107,17 +1278,72 @@ func (vo *opts) filter(s stack.Stack) bool {
 	return false
 }
 
-func (vo *opts) retry(i int) bool {
+// shouldRetry returns whether the given remaining stacks are worth retrying.
+func (vo *opts) shouldRetry(stacks []stack.Stack) bool {
+	if len(vo.retryOnlyFor) == 0 {
+		return true
+	}
+	for _, s := range stacks {
+		if !vo.retryOnlyFor[s.FirstFunction()] {
+			return false
+		}
+	}
+	return true
+}
+
+func (vo *opts) retry(i int, deadline time.Time) bool {
 	if i >= vo.maxRetries {
 		return false
 	}
 
+	d := backoff(i, vo.maxSleep)
+	if vo.retryJitter > 0 {
+		_jitterRand.Lock()
+		r := _jitterRand.Float64()
+		_jitterRand.Unlock()
+		d = jitter(d, vo.retryJitter, r)
+	}
+	return vo.sleep(d, deadline)
+}
+
+// recheck sleeps before checking for leaks again after a clean check, and
+// returns false if there's no time left for another check.
+func (vo *opts) recheck(deadline time.Time) bool {
+	return vo.sleep(vo.cleanCheckGap, deadline)
+}
+
+// sleep sleeps for d, or until the deadline if it's sooner. It returns false
+// if the deadline has passed or the sleep was cancelled.
+func (vo *opts) sleep(d time.Duration, deadline time.Time) bool {
+	if !deadline.IsZero() {
+		remaining := deadline.Sub(vo.clock.Now())
+		if remaining <= 0 {
+			return false
+		}
+		if d > remaining {
+			d = remaining
+		}
+	}
+	return vo.clock.Sleep(vo.ctx, d) == nil
+}
+
+// jitter adjusts d by up to the given fraction of it, in either direction,
+// using r in [0, 1) to pick the adjustment.
+func jitter(d time.Duration, fraction, r float64) time.Duration {
+	if fraction > 1 {
+		fraction = 1
+	}
+	return d + time.Duration(float64(d)*fraction*(2*r-1))
+}
+
+// backoff returns the time to sleep before the given attempt, which grows
+// exponentially up to maxSleep.
+func backoff(i int, maxSleep time.Duration) time.Duration {
 	d := time.Duration(int(time.Microsecond) << uint(i))
-	if d > vo.maxSleep {
-		d = vo.maxSleep
+	if d > maxSleep || d <= 0 {
+		d = maxSleep
 	}
-	time.Sleep(d)
-	return true
+	return d
 }
 
 // isTestStack is a default filter installed to automatically skip goroutines
@@ -129,8 +1355,11 @@ func isTestStack(s stack.Stack) bool {
 	// Since go1.7, a separate goroutine is started to wait for signals.
 	// T.Parallel is for parallel tests, which are blocked until all serial
 	// tests have run with T.Parallel at the top of the stack.
+	// Benchmarks are run in a separate goroutine, while the goroutine that
+	// started them waits in B.run1 or B.doBench.
 	switch s.FirstFunction() {
-	case "testing.RunTests", "testing.(*T).Run", "testing.(*T).Parallel":
+	case "testing.RunTests", "testing.(*T).Run", "testing.(*T).Parallel",
+		"testing.(*B).run1", "testing.(*B).doBench":
 		// In pre1.7 and post-1.7, background goroutines started by the testing
 		// package are blocked waiting on a channel.
 		return strings.HasPrefix(s.State(), "chan receive")
@@ -154,3 +1383,112 @@ func isStdLibStack(s stack.Stack) bool {
 	// Using signal.Notify will start a runtime goroutine.
 	return strings.Contains(s.Full(), "runtime.ensureSigM")
 }
+
+func isRuntimeInternalStack(s stack.Stack) bool {
+	frames := s.Frames()
+	if len(frames) == 0 {
+		return false
+	}
+	for _, f := range frames {
+		if !isRuntimePackage(f.Package()) {
+			return false
+		}
+	}
+	createdBy := s.CreatedBy()
+	return createdBy.Function == "" || isRuntimePackage(createdBy.Package())
+}
+
+// isRuntimePackage reports whether the given package is part of the runtime,
+// including its internal packages, but not packages like runtime/trace.
+func isRuntimePackage(pkg string) bool {
+	return pkg == "runtime" ||
+		strings.HasPrefix(pkg, "runtime/internal/") ||
+		strings.HasPrefix(pkg, "internal/runtime/")
+}
+
+// isTestingDescendant reports whether the given goroutine was started on
+// behalf of the testing package, using the other running goroutines by ID
+// to walk up the chain of creators.
+func isTestingDescendant(s stack.Stack, byID map[int]stack.Stack) bool {
+	// Limit the walk in case the runtime reuses goroutine IDs.
+	for i := 0; i < len(byID); i++ {
+		switch pkg := s.CreatedBy().Package(); {
+		case pkg == "testing":
+			return true
+		case !isStdLibPackage(pkg):
+			return false
+		}
+
+		creator, ok := byID[s.CreatorID()]
+		if !ok {
+			return false
+		}
+		for _, f := range creator.Frames() {
+			if !isStdLibPackage(f.Package()) {
+				// The standard library was called by user code.
+				return false
+			}
+		}
+		s = creator
+	}
+	return false
+}
+
+// isStdLibPackage reports whether the given package is in the standard
+// library, where the first element of the import path has no dot.
+func isStdLibPackage(pkg string) bool {
+	if pkg == "" || pkg == "main" {
+		return false
+	}
+	first := pkg
+	if idx := strings.Index(pkg, "/"); idx >= 0 {
+		first = pkg[:idx]
+	}
+	return !strings.Contains(first, ".")
+}
+
+// _runtimeGCFunctions are the functions that start the runtime's finalizer
+// and garbage collection goroutines, at the bottom of their stacks.
+var _runtimeGCFunctions = map[string]bool{
+	"runtime.runfinq":        true,
+	"runtime.runFinalizers":  true, // Since Go 1.25.
+	"runtime.gcBgMarkWorker": true,
+	"runtime.bgsweep":        true,
+	"runtime.bgscavenge":     true,
+	"runtime.forcegchelper":  true,
+}
+
+func isRuntimeGCStack(s stack.Stack) bool {
+	// The runtime hides these goroutines, except for the finalizer goroutine
+	// while it runs finalizers. A finalizer blocked in user code may be a
+	// leak, so only ignore stacks that are entirely in the runtime, with the
+	// function that starts the goroutine at the bottom of the stack.
+	frames := s.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i].Function
+		if f == "runtime.goexit" {
+			continue
+		}
+		if !_runtimeGCFunctions[f] {
+			return false
+		}
+		for _, f := range frames[:i] {
+			if !isRuntimePackage(f.Package()) {
+				return false
+			}
+		}
+		createdBy := s.CreatedBy()
+		return createdBy.Function == "" || createdBy.Package() == "runtime"
+	}
+	return false
+}
+
+func isJSEventStack(s stack.Stack) bool {
+	// On js/wasm, the runtime starts a goroutine to handle events from JavaScript.
+	for _, f := range s.Frames() {
+		if f.Function == "runtime.handleEvent" {
+			return strings.HasPrefix(s.State(), "waiting")
+		}
+	}
+	return false
+}
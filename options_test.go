@@ -21,12 +21,14 @@
 package goleak
 
 import (
+	"errors"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
-	"go.uber.org/goleak/internal/stack"
+	"go.uber.org/goleak/stack"
 )
 
 func TestOptionsFilters(t *testing.T) {
@@ -48,7 +50,7 @@ func TestOptionsFilters(t *testing.T) {
 	// Now the filters should find something that doesn't match a filter.
 	countUnfiltered := func() int {
 		var unmatched int
-		for _, s := range stack.All() {
+		for _, s := range allStacks(t) {
 			if s.ID() == cur.ID() {
 				continue
 			}
@@ -62,7 +64,732 @@ func TestOptionsFilters(t *testing.T) {
 
 	// If we add an extra filter to ignore blockTill, it shouldn't match.
 	opts = buildOpts(IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run"))
-	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", stack.All())
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+
+	// blockedG is in the goleak package, but not in its parent.
+	opts = buildOpts(IgnoreTopPackage("go.uber.org"))
+	require.Equal(t, 1, countUnfiltered(), "blockedG should not be filtered out")
+	opts = buildOpts(IgnoreTopPackage("go.uber.org/goleak"))
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+
+	// Similarly, blockedG is the first non-runtime function on the stack.
+	opts = buildOpts(IgnoreFirstNonRuntimeFunction("go.uber.org/goleak.(*blockedG).run"))
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+
+	// blockedG only has a single frame, as runtime frames are hidden.
+	opts = buildOpts(IgnoreShallowStacks(1))
+	require.Equal(t, 1, countUnfiltered(), "blockedG should not be filtered out")
+	opts = buildOpts(IgnoreShallowStacks(2))
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+
+	// blockedG is created by startBlockedG in utils_test.go.
+	opts = buildOpts(IgnoreCreatedBy("go.uber.org/goleak.TestOptionsFilters"))
+	require.Equal(t, 1, countUnfiltered(), "blockedG should not be filtered out")
+	opts = buildOpts(IgnoreCreatedBy("go.uber.org/goleak.startBlockedG"))
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+	opts = buildOpts(IgnoreCreatedByFile("goleak/options_test.go"))
+	require.Equal(t, 1, countUnfiltered(), "blockedG should not be filtered out")
+	opts = buildOpts(IgnoreCreatedByFile("utils_test.go"))
+	require.Zero(t, countUnfiltered(), "blockedG should be filtered out. running: %v", allStacks(t))
+}
+
+func TestOptionsCreatedByFile(t *testing.T) {
+	s, err := stack.ParseStack(`goroutine 7 [chan receive]:
+example.com/pkg.worker()
+	/home/user/src/example.com/pkg/worker.go:20 +0x1f
+created by example.com/pkg.Start.func1 in goroutine 1
+	/home/user/src/example.com/pkg/start.go:42 +0x6b
+`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		msg  string
+		opt  Option
+		want bool
+	}{
+		{"function", IgnoreCreatedBy("example.com/pkg.Start.func1"), true},
+		{"outer function", IgnoreCreatedBy("example.com/pkg.Start"), false},
+		{"top of stack function", IgnoreCreatedBy("example.com/pkg.worker"), false},
+		{"empty function", IgnoreCreatedBy(""), false},
+		{"absolute path", IgnoreCreatedByFile("/home/user/src/example.com/pkg/start.go"), true},
+		{"relative path", IgnoreCreatedByFile("pkg/start.go"), true},
+		{"file name", IgnoreCreatedByFile("start.go"), true},
+		{"partial file name", IgnoreCreatedByFile("art.go"), false},
+		{"top of stack file", IgnoreCreatedByFile("pkg/worker.go"), false},
+		{"empty path", IgnoreCreatedByFile(""), false},
+		{"line", IgnoreCreatedByLine("pkg/start.go", 42), true},
+		{"different line", IgnoreCreatedByLine("pkg/start.go", 43), false},
+		{"different file", IgnoreCreatedByLine("pkg/stop.go", 42), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.want, buildOpts(tt.opt).filter(s))
+		})
+	}
+}
+
+func TestOptionsIgnoreRuntimeInternal(t *testing.T) {
+	tests := []struct {
+		msg  string
+		dump string
+		want bool
+	}{
+		{
+			msg: "GC worker, go1.17",
+			dump: `goroutine 5 [GC worker (idle)]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:366 +0xd6
+runtime.gcBgMarkWorker()
+	/usr/local/go/src/runtime/mgc.go:1200 +0xe5
+created by runtime.gcBgMarkStartWorkers
+	/usr/local/go/src/runtime/mgc.go:1124 +0x25
+`,
+			want: true,
+		},
+		{
+			msg: "GC worker, go1.21",
+			dump: `goroutine 18 [GC worker (idle)]:
+runtime.gopark(0x1a2b3c4d5e6f?, 0x1?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.gcBgMarkWorker()
+	/usr/local/go/src/runtime/mgc.go:1295 +0xe5
+runtime.goexit()
+	/usr/local/go/src/runtime/asm_amd64.s:1650 +0x1
+created by runtime.gcBgMarkStartWorkers in goroutine 1
+	/usr/local/go/src/runtime/mgc.go:1219 +0x1c
+`,
+			want: true,
+		},
+		{
+			msg: "timer goroutine, go1.13",
+			dump: `goroutine 4 [timer goroutine (idle)]:
+runtime.gopark(0x8a1e40, 0xb6b7e0, 0x1415, 0x1)
+	/usr/local/go/src/runtime/proc.go:304 +0xe0
+runtime.timerproc(0xb6b7e0)
+	/usr/local/go/src/runtime/time.go:303 +0x27b
+created by runtime.(*timersBucket).addtimerLocked
+	/usr/local/go/src/runtime/time.go:169 +0x10e
+`,
+			want: true,
+		},
+		{
+			msg: "finalizer goroutine",
+			dump: `goroutine 3 [finalizer wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.runfinq()
+	/usr/local/go/src/runtime/mfinal.go:193 +0x107
+created by runtime.createfing in goroutine 1
+	/usr/local/go/src/runtime/mfinal.go:163 +0x3d
+`,
+			want: true,
+		},
+		{
+			msg: "internal runtime package",
+			dump: `goroutine 9 [sync.Mutex.Lock]:
+internal/runtime/sync.runtime_SemacquireMutex(0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+runtime.bgsweep(0x0?)
+	/usr/local/go/src/runtime/mgcsweep.go:301 +0xff
+created by runtime.gcenable in goroutine 1
+	/usr/local/go/src/runtime/mgc.go:204 +0x66
+`,
+			want: true,
+		},
+		{
+			msg: "netpoller wait",
+			dump: `goroutine 21 [IO wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.netpollblock(0x0?, 0x4a5b1e?, 0x0?)
+	/usr/local/go/src/runtime/netpoll.go:564 +0xf7
+internal/poll.runtime_pollWait(0x7f8e5c0a1e28, 0x72)
+	/usr/local/go/src/runtime/netpoll.go:343 +0x85
+internal/poll.(*pollDesc).wait(0xc000130080?, 0x0?, 0x0)
+	/usr/local/go/src/internal/poll/fd_poll_runtime.go:84 +0x27
+net.(*netFD).accept(0xc000130080)
+	/usr/local/go/src/net/fd_unix.go:172 +0x29
+created by example.com/server.Start in goroutine 1
+	/path/to/server.go:20 +0x1f
+`,
+			want: false,
+		},
+		{
+			msg: "user goroutine in the runtime",
+			dump: `goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.chanrecv1(0x0?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:442 +0x12
+created by example.com/pkg.Start in goroutine 1
+	/path/to/pkg.go:20 +0x1f
+`,
+			want: false,
+		},
+		{
+			msg:  "no frames",
+			dump: "goroutine 7 [running]:\n",
+			want: false,
+		},
+		{
+			msg: "trace reader",
+			dump: `goroutine 8 [chan receive]:
+runtime/trace.Start.func1()
+	/usr/local/go/src/runtime/trace/trace.go:130 +0x7c
+created by runtime/trace.Start in goroutine 1
+	/usr/local/go/src/runtime/trace/trace.go:128 +0xd4
+`,
+			want: false,
+		},
+	}
+
+	opts := buildOpts(IgnoreRuntimeInternal())
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack(tt.dump)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, isRuntimeInternalStack(s), "isRuntimeInternalStack")
+			if tt.want {
+				assert.True(t, opts.filter(s), "Expected stack to be ignored")
+			}
+		})
+	}
+}
+
+func TestIsRuntimeGCStack(t *testing.T) {
+	tests := []struct {
+		msg  string
+		dump string
+		want bool
+	}{
+		{
+			msg: "finalizer running a finalizer, go1.17",
+			dump: `goroutine 18 [chan send]:
+example.com/pkg.(*Conn).finalize(0xc00012a000)
+	/path/to/pkg/conn.go:40 +0x45
+runtime.call16(0x0, 0x4e6f28, 0xc000138000, 0x10, 0x10, 0x10, 0xc00004ff08)
+	/usr/local/go/src/runtime/asm_amd64.s:625 +0x48
+runtime.runfinq()
+	/usr/local/go/src/runtime/mfinal.go:222 +0x1f3
+created by runtime.createfing
+	/usr/local/go/src/runtime/mfinal.go:156 +0x65
+`,
+			want: false,
+		},
+		{
+			msg: "finalizer wait, go1.21",
+			dump: `goroutine 3 [finalizer wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.runfinq()
+	/usr/local/go/src/runtime/mfinal.go:193 +0x107
+runtime.goexit()
+	/usr/local/go/src/runtime/asm_amd64.s:1650 +0x1
+created by runtime.createfing in goroutine 1
+	/usr/local/go/src/runtime/mfinal.go:163 +0x3d
+`,
+			want: true,
+		},
+		{
+			msg: "finalizer wait, go1.27",
+			dump: `goroutine 5 [finalizer wait]:
+runtime.gopark(0x0?, 0xfd6ab99e658?, 0x6f?, 0x9e?, 0xfd6ab9ac068?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca
+runtime.runFinalizers()
+	/usr/local/go/src/runtime/mfinal.go:210 +0x107
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1
+created by runtime.createfing in goroutine 1
+	/usr/local/go/src/runtime/mfinal.go:172 +0x3d
+`,
+			want: true,
+		},
+		{
+			msg: "finalizer blocked in user code, go1.27",
+			dump: `goroutine 5 [chan send]:
+runtime.gopark(0x5a9200?, 0x1f80005?, 0x88?, 0x65?, 0x41b117?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca
+runtime.chansend(0x758c6ae60e0, 0x4b16d0, 0x1, 0x7f323b70d108?)
+	/usr/local/go/src/runtime/chan.go:283 +0x3fc
+runtime.chansend1(0x758c6ae6070?, 0x479e8b?)
+	/usr/local/go/src/runtime/chan.go:161 +0x17
+example.com/pkg.(*Conn).finalize(0x0?)
+	/path/to/pkg/conn.go:40 +0x2d
+runtime.call16(0x0, 0x57d900, 0x758c6a92130, 0x10, 0x10, 0x10, 0x758c6ab6698)
+	/usr/local/go/src/runtime/asm_amd64.s:804 +0x3a
+runtime.runFinalizers()
+	/usr/local/go/src/runtime/mfinal.go:272 +0x3f7
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_amd64.s:1264 +0x1
+created by runtime.createfing in goroutine 1
+	/usr/local/go/src/runtime/mfinal.go:172 +0x3d
+`,
+			want: false,
+		},
+		{
+			msg: "GC worker, go1.21",
+			dump: `goroutine 18 [GC worker (idle)]:
+runtime.gopark(0x1a2b3c4d5e6f?, 0x1?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.gcBgMarkWorker()
+	/usr/local/go/src/runtime/mgc.go:1295 +0xe5
+runtime.goexit()
+	/usr/local/go/src/runtime/asm_amd64.s:1650 +0x1
+created by runtime.gcBgMarkStartWorkers in goroutine 1
+	/usr/local/go/src/runtime/mgc.go:1219 +0x1c
+`,
+			want: true,
+		},
+		{
+			msg: "sweeper, go1.17",
+			dump: `goroutine 4 [GC sweep wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:366 +0xd6
+runtime.goparkunlock(...)
+	/usr/local/go/src/runtime/proc.go:372
+runtime.bgsweep()
+	/usr/local/go/src/runtime/mgcsweep.go:163 +0x88
+created by runtime.gcenable
+	/usr/local/go/src/runtime/mgc.go:181 +0x55
+`,
+			want: true,
+		},
+		{
+			msg: "user goroutine running a GC",
+			dump: `goroutine 7 [running]:
+runtime.GC()
+	/usr/local/go/src/runtime/mgc.go:422 +0x4a
+example.com/pkg.collect()
+	/path/to/pkg/gc.go:10 +0x1f
+created by example.com/pkg.Start in goroutine 1
+	/path/to/pkg/gc.go:5 +0x6b
+`,
+			want: false,
+		},
+		{
+			msg: "user goroutine named like a runtime goroutine",
+			dump: `goroutine 7 [chan receive]:
+runtime.runfinq()
+	/path/to/fake/runtime.go:10 +0x1f
+created by example.com/pkg.Start in goroutine 1
+	/path/to/pkg/start.go:5 +0x6b
+`,
+			want: false,
+		},
+	}
+
+	opts := buildOpts()
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack(tt.dump)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, isRuntimeGCStack(s), "isRuntimeGCStack")
+			if tt.want {
+				assert.True(t, opts.filter(s), "Expected stack to be ignored by default")
+			}
+		})
+	}
+}
+
+func TestOptionsWithoutDefaultIgnores(t *testing.T) {
+	s, err := stack.ParseStack(`goroutine 3 [finalizer wait]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.runfinq()
+	/usr/local/go/src/runtime/mfinal.go:193 +0x107
+runtime.goexit()
+	/usr/local/go/src/runtime/asm_amd64.s:1650 +0x1
+created by runtime.createfing in goroutine 1
+	/usr/local/go/src/runtime/mfinal.go:163 +0x3d
+`)
+	require.NoError(t, err)
+
+	assert.True(t, buildOpts().filter(s), "Expected runtime goroutine to be ignored by default")
+	assert.False(t, buildOpts(WithoutDefaultIgnores()).filter(s),
+		"Expected runtime goroutine to not be ignored without default ignores")
+
+	opts := append(DefaultIgnores(), WithoutDefaultIgnores())
+	assert.True(t, buildOpts(opts...).filter(s), "Expected DefaultIgnores to restore the default ignores")
+	assert.True(t, buildOpts(WithoutDefaultIgnores(), IgnoreTopFunction("runtime.gopark")).filter(s),
+		"Expected other options to apply without default ignores")
+
+	t.Run("Find", func(t *testing.T) {
+		// The parent test is blocked in testing.(*T).Run running this test.
+		err := Find(testOptions(), WithoutDefaultIgnores(), MaxRetries(0))
+		require.Error(t, err, "Expected goroutines of the testing package to be reported")
+		assert.Contains(t, err.Error(), "testing.(*T).Run")
+		require.NoError(t, Find(append(DefaultIgnores(), testOptions(), WithoutDefaultIgnores())...))
+	})
+}
+
+func TestRegisterDefaultOptions(t *testing.T) {
+	defer func(orig []Option) { _registeredOptions.options = orig }(_registeredOptions.options)
+
+	bg := startBlockedG()
+	defer bg.unblock()
+	require.Error(t, Find(testOptions()), "Expected blockedG to be reported")
+
+	RegisterDefaultOptions(IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run"))
+	require.NoError(t, Find(testOptions()), "Expected registered option to ignore blockedG")
+	require.NoError(t, Find(), "Expected registered option to apply without other options")
+
+	t.Run("options override registered options", func(t *testing.T) {
+		RegisterDefaultOptions(MaxRetries(3))
+		assert.Equal(t, 3, buildOpts().maxRetries)
+		assert.Equal(t, 1, buildOpts(MaxRetries(1)).maxRetries)
+	})
+
+	t.Run("registered options add to each other", func(t *testing.T) {
+		bg2 := startBlockedG()
+		defer bg2.unblock()
+		RegisterDefaultOptions(IgnoreCreatedBy("go.uber.org/goleak.startBlockedG"))
+		assert.Len(t, registeredOptions(), 3, "Expected all registered options")
+		require.NoError(t, Find(testOptions()))
+	})
+}
+
+func TestFinalizerBlockedReported(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	finished := make(chan struct{})
+
+	// Block the finalizer goroutine in user code.
+	obj := new([16]byte)
+	runtime.SetFinalizer(obj, func(*[16]byte) {
+		defer close(finished)
+		close(started)
+		<-done
+	})
+	obj = nil
+	for {
+		runtime.GC()
+		select {
+		case <-started:
+		case <-time.After(time.Millisecond):
+			continue
+		}
+		break
+	}
+
+	err := Find(testOptions())
+	close(done)
+	<-finished
+	require.Error(t, err, "Finalizer blocked in user code should be reported")
+	assert.Contains(t, err.Error(), "TestFinalizerBlockedReported.func1")
+	require.NoError(t, Find(), "Finalizer goroutine should be ignored once it's waiting for finalizers")
+}
+
+func TestIsTestingDescendant(t *testing.T) {
+	dumps := []string{
+		`goroutine 7 [chan receive]:
+example.com/pkg.TestServer(0xc000007a00)
+	/path/to/pkg/server_test.go:20 +0x1f
+testing.tRunner(0xc000007a00, 0x6e8a10)
+	/usr/local/go/src/testing/testing.go:1595 +0xff
+created by testing.(*T).Run in goroutine 1
+	/usr/local/go/src/testing/testing.go:1648 +0x3ad
+`,
+		`goroutine 10 [IO wait]:
+net/http.(*Server).Serve(0xc0000c8000, {0x7b6ee0, 0xc0000a4000})
+	/usr/local/go/src/net/http/server.go:3056 +0x394
+net/http/httptest.(*Server).goServe.func1()
+	/usr/local/go/src/net/http/httptest/server.go:310 +0x6e
+created by net/http/httptest.(*Server).goServe in goroutine 7
+	/usr/local/go/src/net/http/httptest/server.go:308 +0x6a
+`,
+		`goroutine 9 [IO wait]:
+net/http.(*conn).serve(0xc0000b2000, {0x7b7318, 0xc0000a0120})
+	/usr/local/go/src/net/http/server.go:2009 +0x1ab
+created by net/http.(*Server).Serve in goroutine 10
+	/usr/local/go/src/net/http/server.go:3086 +0x5cb
+`,
+		`goroutine 12 [sleep]:
+time.Sleep(0x3b9aca00)
+	/usr/local/go/src/runtime/time.go:195 +0x125
+testing.(*M).startAlarm.func1()
+	/usr/local/go/src/testing/testing.go:2249 +0x2a
+created by testing.(*M).startAlarm in goroutine 1
+	/usr/local/go/src/testing/testing.go:2245 +0x1c5
+`,
+		`goroutine 11 [chan receive]:
+context.(*cancelCtx).propagateCancel.func2()
+	/usr/local/go/src/context/context.go:510 +0x9e
+created by context.(*cancelCtx).propagateCancel in goroutine 12
+	/usr/local/go/src/context/context.go:509 +0x3f3
+`,
+		`goroutine 13 [chan receive]:
+example.com/pkg.worker()
+	/path/to/pkg/worker.go:10 +0x1f
+created by example.com/pkg.TestServer in goroutine 7
+	/path/to/pkg/server_test.go:25 +0x6b
+`,
+		`goroutine 14 [IO wait]:
+net/http.(*conn).serve(0xc0000b2000, {0x7b7318, 0xc0000a0120})
+	/usr/local/go/src/net/http/server.go:2009 +0x1ab
+created by net/http.(*Server).Serve in goroutine 99
+	/usr/local/go/src/net/http/server.go:3086 +0x5cb
+`,
+		`goroutine 15 [chan receive]:
+testing.(*T).Parallel(0xc000007d40)
+	/usr/local/go/src/testing/testing.go:1206 +0x1ac
+testing.tRunner(0xc000007d40, 0x6e8a10)
+	/usr/local/go/src/testing/testing.go:1595 +0xff
+created by testing.(*T).Run
+	/usr/local/go/src/testing/testing.go:1648 +0x3ad
+`,
+	}
+
+	byID := make(map[int]stack.Stack, len(dumps))
+	for _, dump := range dumps {
+		s, err := stack.ParseStack(dump)
+		require.NoError(t, err)
+		byID[s.ID()] = s
+	}
+
+	tests := []struct {
+		id   int
+		msg  string
+		want bool
+	}{
+		{7, "created by the testing package", true},
+		{10, "created by the standard library from a test", false},
+		{9, "created by the standard library, several hops from a test", false},
+		{12, "created by the testing package for a timeout", true},
+		{11, "created by the standard library from the testing package", true},
+		{13, "created by a test", false},
+		{14, "creator has exited", false},
+		{15, "created by the testing package before Go 1.21", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.want, isTestingDescendant(byID[tt.id], byID))
+		})
+	}
+}
+
+func TestOptionsIgnoreTestingDescendants(t *testing.T) {
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	// blockedG is started by a test, so it should still be reported.
+	err := Find(testOptions(), IgnoreTestingDescendants())
+	require.Error(t, err, "Goroutines started by tests should be reported")
+	assert.Contains(t, err.Error(), "blockedG")
+}
+
+func TestOptionsIgnoreAnyFunction(t *testing.T) {
+	defer startBlockedG().unblock()
+	require.Error(t, Find(testOptions(), IgnoreAnyFunction("go.uber.org/goleak.startBlockedG")),
+		"The created by function should not be matched")
+	require.NoError(t, Find(testOptions(), IgnoreAnyFunction("go.uber.org/goleak.(*blockedG).run")),
+		"blockedG should be ignored by a function on the stack")
+
+	s, err := stack.ParseStack(`goroutine 7 [select]:
+main.wait()
+	/path/to/main.go:20 +0x1f
+main.run()
+	/path/to/main.go:10 +0x1f
+`)
+	require.NoError(t, err)
+	assert.True(t, buildOpts(IgnoreAnyFunction("main.run")).filter(s), "Expected function below the top to be ignored")
+	assert.True(t, buildOpts(IgnoreAnyFunction("main.wait")).filter(s), "Expected top function to be ignored")
+	assert.False(t, buildOpts(IgnoreAnyFunction("main.ru")).filter(s), "Expected function names to match exactly")
+}
+
+func TestOptionsIgnorePackagePrefix(t *testing.T) {
+	const (
+		// Blocked in the standard library, below the package.
+		blockedInStdLib = `goroutine 7 [IO wait]:
+internal/poll.(*FD).Read(0xc000010000, {0xc000020000, 0x1000, 0x1000})
+	/usr/local/go/src/internal/poll/fd_unix.go:164 +0x27a
+net.(*conn).Read(0xc000030000, {0xc000020000, 0x1000, 0x1000})
+	/usr/local/go/src/net/net.go:179 +0x45
+github.com/Shopify/sarama/internal/conn.(*Broker).read(0xc000040000)
+	/path/to/sarama/internal/conn/broker.go:20 +0x1f
+github.com/Shopify/sarama.(*Client).run(0xc000050000)
+	/path/to/sarama/client.go:30 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:10 +0x6b
+`
+		// Called from user code, but created by the package.
+		createdByPackage = `goroutine 8 [chan receive]:
+main.handle(0xc000010000)
+	/path/to/main.go:20 +0x1f
+created by github.com/Shopify/sarama.(*Consumer).dispatch in goroutine 7
+	/path/to/sarama/consumer.go:40 +0x6b
+`
+		// Calls into the package from user code.
+		callsPackage = `goroutine 9 [chan receive]:
+github.com/Shopify/sarama.(*Client).wait(0xc000050000)
+	/path/to/sarama/client.go:50 +0x1f
+main.run()
+	/path/to/main.go:30 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:11 +0x6b
+`
+	)
+
+	tests := []struct {
+		msg      string
+		dump     string
+		prefixes []string
+		want     bool
+	}{
+		{"blocked in std lib", blockedInStdLib, []string{"github.com/Shopify/sarama"}, true},
+		{"trailing slash", blockedInStdLib, []string{"github.com/Shopify/sarama/"}, true},
+		{"multiple prefixes", blockedInStdLib, []string{"example.com/other", "github.com/Shopify"}, true},
+		{"partial element", blockedInStdLib, []string{"github.com/Shopify/sar"}, false},
+		{"subpackage only", blockedInStdLib, []string{"github.com/Shopify/sarama/internal"}, false},
+		{"created by package", createdByPackage, []string{"github.com/Shopify/sarama"}, true},
+		{"calls package", callsPackage, []string{"github.com/Shopify/sarama"}, false},
+		{"empty prefix", createdByPackage, []string{""}, false},
+		{"no prefixes", blockedInStdLib, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack(tt.dump)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, buildOpts(IgnorePackagePrefix(tt.prefixes...)).filter(s))
+		})
+	}
+}
+
+func TestOptionsIgnoreStackRegex(t *testing.T) {
+	s, err := stack.ParseStack(`goroutine 7 [chan receive]:
+example.com/pkg/pool.(*Pool).run(0xc000010000)
+	/path/to/pkg/pool/pool.go:20 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:10 +0x6b
+`)
+	require.NoError(t, err)
+
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{`pool\.\(\*Pool\)\.run`, true},
+		{`(?s)/pkg/pool/.*created by main\.main`, true},
+		{`^goroutine 7 \[chan receive\]:`, true},
+		{`\+0x1f$`, false},
+		{`(?m)\+0x1f$`, true},
+		{`created by example\.com`, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, buildOpts(IgnoreStackRegex(tt.pattern)).filter(s), "IgnoreStackRegex(%q)", tt.pattern)
+	}
+
+	assert.Panics(t, func() { IgnoreStackRegex("(") }, "Expected invalid pattern to panic")
+}
+
+func TestOptionsIgnoreTopFunctionInState(t *testing.T) {
+	parse := func(state, fn string) stack.Stack {
+		s, err := stack.ParseStack("goroutine 7 [" + state + "]:\n" + fn + "()\n\t/path/to/main.go:10 +0x1f\n")
+		require.NoError(t, err)
+		return s
+	}
+
+	opts := buildOpts(IgnoreTopFunctionInState("main.run", "select"))
+	assert.True(t, opts.filter(parse("select", "main.run")), "Expected function in state to be ignored")
+	assert.True(t, opts.filter(parse("select, 10 minutes", "main.run")), "Expected wait duration to not matter")
+	assert.False(t, opts.filter(parse("chan receive", "main.run")), "Expected function in other state to be reported")
+	assert.False(t, opts.filter(parse("select, locked to thread", "main.run")), "Expected state qualifiers to matter")
+	assert.False(t, opts.filter(parse("select", "main.other")), "Expected other function in state to be reported")
+
+	// blockedG blocks receiving from a channel.
+	defer startBlockedG().unblock()
+	require.Error(t, Find(testOptions(), IgnoreTopFunctionInState("go.uber.org/goleak.(*blockedG).run", "select")),
+		"blockedG should be reported in a different state")
+	require.NoError(t, Find(testOptions(), IgnoreTopFunctionInState("go.uber.org/goleak.(*blockedG).run", "chan receive")),
+		"blockedG should be ignored in the expected state")
+}
+
+func TestOptionsIgnoreStates(t *testing.T) {
+	tests := []struct {
+		state  string
+		ignore []string
+		want   bool
+	}{
+		{"runnable", []string{"runnable", "running"}, true},
+		{"running", []string{"runnable", "running"}, true},
+		{"chan receive", []string{"runnable", "running"}, false},
+		{"select, 5 minutes", []string{"select"}, true},
+		{"select, 5 minutes, locked to thread", []string{"select"}, true},
+		{"select, locked to thread", []string{"select, locked to thread"}, true},
+		{"select", []string{"select, locked to thread"}, false},
+		{"select", []string{"sel"}, false},
+		{"select", nil, false},
+	}
+
+	for _, tt := range tests {
+		s, err := stack.ParseStack("goroutine 7 [" + tt.state + "]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n")
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, buildOpts(IgnoreStates(tt.ignore...)).filter(s), "IgnoreStates(%q) for %q", tt.ignore, tt.state)
+	}
+}
+
+func TestOptionsOnlyStates(t *testing.T) {
+	tests := []struct {
+		state string
+		only  []string
+		want  bool
+	}{
+		{"runnable", []string{"chan receive", "select"}, true},
+		{"running", []string{"chan receive", "select"}, true},
+		{"chan receive", []string{"chan receive", "select"}, false},
+		{"select, 5 minutes, locked to thread", []string{"select"}, false},
+		{"select", []string{"select, locked to thread"}, true},
+		{"select", nil, true},
+	}
+
+	for _, tt := range tests {
+		s, err := stack.ParseStack("goroutine 7 [" + tt.state + "]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n")
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, buildOpts(OnlyStates(tt.only...)).filter(s), "OnlyStates(%q) for %q", tt.only, tt.state)
+	}
+
+	defer startBlockedG().unblock()
+	require.NoError(t, Find(testOptions(), OnlyStates("select")), "blockedG should be ignored in another state")
+	require.Error(t, Find(testOptions(), OnlyStates("chan receive")), "blockedG should be considered")
+}
+
+func TestOptionsAllowLeaks(t *testing.T) {
+	bg1 := startBlockedG()
+	defer bg1.unblock()
+
+	require.NoError(t, Find(testOptions(), AllowLeaks(1)), "One leak should be tolerated")
+	require.NoError(t, Find(testOptions(), AllowLeaks(2)), "Fewer leaks than allowed should be tolerated")
+	require.Error(t, Find(testOptions(), AllowLeaks(0)), "No leaks should be tolerated")
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() { <-done }()
+
+	isBlockedG := func(s Stack) bool {
+		return s.FirstFunction() == "go.uber.org/goleak.(*blockedG).run"
+	}
+	err := Find(testOptions(), AllowLeaks(1))
+	require.Error(t, err, "More leaks than allowed should be reported")
+	var leakErr *LeakError
+	require.True(t, errors.As(err, &leakErr))
+	assert.Len(t, leakErr.Stacks(), 2, "Expected all leaks to be reported")
+
+	err = Find(testOptions(), AllowLeaksMatching(1, isBlockedG))
+	require.Error(t, err, "Leaks that don't match should be reported")
+	require.True(t, errors.As(err, &leakErr))
+	require.Len(t, leakErr.Stacks(), 1)
+	assert.NotEqual(t, "go.uber.org/goleak.(*blockedG).run", leakErr.Stacks()[0].FirstFunction(),
+		"Matching leak should be tolerated")
+
+	require.NoError(t, Find(testOptions(), AllowLeaksMatching(1, isBlockedG), AllowLeaks(1)),
+		"Each allowance should tolerate its own leaks")
+
+	bg2 := startBlockedG()
+	defer bg2.unblock()
+	err = Find(testOptions(), AllowLeaksMatching(1, isBlockedG), IgnoreAnyFunction("go.uber.org/goleak.TestOptionsAllowLeaks.func1"))
+	require.Error(t, err, "More matching leaks than allowed should be reported")
+	require.True(t, errors.As(err, &leakErr))
+	assert.Len(t, leakErr.Stacks(), 2, "Expected all matching leaks to be reported")
 }
 
 func TestOptionsRetry(t *testing.T) {
@@ -71,8 +798,102 @@ func TestOptionsRetry(t *testing.T) {
 	opts.maxSleep = time.Millisecond
 
 	for i := 0; i < 50; i++ {
-		assert.True(t, opts.retry(i), "Attempt %v/51 should allow retrying", i)
+		assert.True(t, opts.retry(i, time.Time{}), "Attempt %v/51 should allow retrying", i)
 	}
-	assert.False(t, opts.retry(51), "Attempt 51/51 should not allow retrying")
-	assert.False(t, opts.retry(52), "Attempt 52/51 should not allow retrying")
+	assert.False(t, opts.retry(51, time.Time{}), "Attempt 51/51 should not allow retrying")
+	assert.False(t, opts.retry(52, time.Time{}), "Attempt 52/51 should not allow retrying")
+}
+
+func TestOptionsMaxRetries(t *testing.T) {
+	opts := buildOpts(MaxRetries(0))
+	assert.False(t, opts.retry(0, time.Time{}), "Attempt 1/1 should not allow retrying")
+
+	opts = buildOpts(MaxRetries(2), MaxSleep(time.Millisecond))
+	assert.True(t, opts.retry(0, time.Time{}), "Attempt 1/3 should allow retrying")
+	assert.True(t, opts.retry(1, time.Time{}), "Attempt 2/3 should allow retrying")
+	assert.False(t, opts.retry(2, time.Time{}), "Attempt 3/3 should not allow retrying")
+}
+
+func TestOptionsRetryDeadline(t *testing.T) {
+	opts := buildOpts(MaxSleep(time.Second))
+	assert.False(t, opts.retry(0, time.Now().Add(-time.Millisecond)), "Should not retry past the deadline")
+
+	start := time.Now()
+	assert.True(t, opts.retry(19, start.Add(10*time.Millisecond)), "Should retry before the deadline")
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond), "Sleep should be capped by the deadline")
+}
+
+func TestOptionsRetryOnlyFor(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	var leaked []stack.Stack
+	for _, s := range allStacks(t) {
+		if s.FirstFunction() == "go.uber.org/goleak.(*blockedG).run" {
+			leaked = append(leaked, s)
+		}
+	}
+	require.Len(t, leaked, 1, "Expected to find blockedG")
+
+	tests := []struct {
+		msg          string
+		topFunctions []string
+		want         bool
+	}{
+		{
+			msg:  "no functions retries everything",
+			want: true,
+		},
+		{
+			msg:          "matching function",
+			topFunctions: []string{"go.uber.org/goleak.(*blockedG).run"},
+			want:         true,
+		},
+		{
+			msg:          "one of multiple functions",
+			topFunctions: []string{"foo.bar", "go.uber.org/goleak.(*blockedG).run"},
+			want:         true,
+		},
+		{
+			msg:          "no matching function",
+			topFunctions: []string{"foo.bar"},
+			want:         false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			opts := buildOpts(RetryOnlyFor(tt.topFunctions...))
+			assert.Equal(t, tt.want, opts.shouldRetry(leaked))
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		msg      string
+		d        time.Duration
+		fraction float64
+		r        float64
+		want     time.Duration
+	}{
+		{"no jitter", time.Second, 0, 0.9, time.Second},
+		{"minimum", time.Second, 0.1, 0, 900 * time.Millisecond},
+		{"middle", time.Second, 0.1, 0.5, time.Second},
+		{"near maximum", time.Second, 0.5, 0.75, 1250 * time.Millisecond},
+		{"fraction above 1", time.Second, 2, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			assert.Equal(t, tt.want, jitter(tt.d, tt.fraction, tt.r))
+		})
+	}
+}
+
+func TestOptionsRetryJitter(t *testing.T) {
+	assert.Equal(t, _defaultRetryJitter, buildOpts().retryJitter, "Expected jitter by default")
+	assert.Zero(t, buildOpts(RetryJitter(0)).retryJitter, "Expected jitter to be disabled")
+
+	opts := buildOpts(RetryJitter(0.5), MaxSleep(time.Millisecond))
+	assert.True(t, opts.retry(0, time.Time{}), "Attempt 1 should allow retrying with jitter")
 }
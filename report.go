@@ -0,0 +1,104 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"io"
+
+	"go.uber.org/goleak/stack"
+)
+
+// Report is the result of looking for extra goroutines with FindReport.
+type Report struct {
+	res  findResult
+	opts *opts
+}
+
+// FindReport looks for extra goroutines like Find, and returns a report of any
+// that are found, rather than an error. This is useful to inspect or log the
+// leaked goroutines in a custom format. An error is only returned if the stacks
+// of running goroutines could not be parsed. LeakCountFile is not supported.
+func FindReport(options ...Option) (*Report, error) {
+	opts := buildOpts(options...)
+	res, err := findLeaks(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Report{res: res, opts: opts}, nil
+}
+
+// Analyze parses a dump of the stacks of all goroutines read from r, such as
+// the traceback printed by a crashed process, and returns a report of the
+// goroutines in it that are not ignored by the given options, grouped and
+// formatted the same as Find. Any text outside of the goroutines, like the
+// panic message or a trailing "exit status 2", is skipped.
+//
+// The dump is analyzed once, so options to retry or resample, such as
+// MaxRetries and Resample, have no effect. Options that refer to goroutines
+// of the current process, such as IgnoreCurrent and IgnorePprofLabels, should
+// not be used.
+// An error is returned if r could not be read or a goroutine in the dump
+// could not be parsed.
+func Analyze(r io.Reader, options ...Option) (*Report, error) {
+	stacks, err := stack.Parse(r)
+	if err != nil {
+		return nil, &stackParseError{err}
+	}
+
+	opts := buildOpts(options...)
+	var res findResult
+	if opts.attributeTests {
+		// Index the stacks before they're modified by filterStacks.
+		res.byID = stacksByID(stacks)
+	}
+	// Goroutine 0 is used for the system stack of each thread,
+	// which is included in dumps printed with GOTRACEBACK=crash.
+	res.stacks = filterStacks(stacks, 0 /* skipID */, opts)
+	res.attempts = 1
+	applyRunningPolicy(&res, opts)
+	if opts.sortByWaitDuration {
+		sortByWaitDuration(res.stacks)
+	}
+	return &Report{res: res, opts: opts}, nil
+}
+
+// Stacks returns the stacks of the extra goroutines that were found,
+// which is empty if there were none.
+func (r *Report) Stacks() []Stack {
+	return append([]Stack(nil), r.res.stacks...)
+}
+
+// String returns the same description of the extra goroutines as the error
+// returned by Find. If there were none, it returns the warning about
+// goroutines that are still running for RunningWarn, if any, and otherwise
+// an empty string.
+func (r *Report) String() string {
+	if len(r.res.stacks) == 0 {
+		return runningWarning(r.res, r.opts)
+	}
+	return leakError(r.res, r.opts).Error()
+}
+
+// WriteHTML writes a self-contained HTML page describing the extra
+// goroutines to w, like ReportHTML.
+func (r *Report) WriteHTML(w io.Writer) error {
+	return writeHTMLReport(w, r.res, r.opts)
+}
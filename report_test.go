@@ -0,0 +1,153 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindReport(t *testing.T) {
+	report, err := FindReport()
+	require.NoError(t, err)
+	assert.Empty(t, report.Stacks(), "Expected no leaks")
+	assert.Empty(t, report.String(), "Expected no leaks")
+
+	bg := startBlockedG()
+	defer bg.unblock()
+
+	// Use a fake clock so both calls report the same duration.
+	opts := []Option{WithClock(newFakeClock()), MaxRetries(0), GroupBy(GroupBySignature)}
+	report, err = FindReport(opts...)
+	require.NoError(t, err)
+	require.Len(t, report.Stacks(), 1, "Expected a leaked goroutine")
+	assert.Equal(t, "go.uber.org/goleak.(*blockedG).run", report.Stacks()[0].FirstFunction())
+
+	findErr := Find(opts...)
+	require.Error(t, findErr)
+	assert.Equal(t, findErr.Error(), report.String(), "Report should match Find's error")
+
+	report.Stacks()[0] = Stack{}
+	assert.NotZero(t, report.Stacks()[0].ID(), "Stacks should return a copy")
+}
+
+func TestAnalyze(t *testing.T) {
+	const dump = `panic: something went wrong
+
+goroutine 1 [running]:
+main.main()
+	/path/to/main.go:10 +0x1f
+
+goroutine 6 [chan receive, 3 minutes]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+
+goroutine 7 [chan receive, 3 minutes]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+
+goroutine 8 [select]:
+main.ticker()
+	/path/to/main.go:30 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:8 +0x6
+exit status 2
+`
+
+	t.Run("all", func(t *testing.T) {
+		report, err := Analyze(strings.NewReader(dump))
+		require.NoError(t, err)
+
+		var ids []int
+		for _, s := range report.Stacks() {
+			ids = append(ids, s.ID())
+		}
+		assert.Equal(t, []int{1, 6, 7, 8}, ids)
+		assert.Contains(t, report.String(), "found unexpected goroutines after 1 attempt")
+		assert.NotContains(t, report.String(), "exit status", "Trailer should not be reported")
+	})
+
+	t.Run("filtered and grouped", func(t *testing.T) {
+		report, err := Analyze(strings.NewReader(dump),
+			IgnoreTopFunction("main.main"),
+			IgnoreTopFunction("main.ticker"),
+			GroupBy(GroupBySignature),
+		)
+		require.NoError(t, err)
+		require.Len(t, report.Stacks(), 2)
+		assert.Contains(t, report.String(), "2 goroutines with the same stack")
+	})
+
+	t.Run("crash dump", func(t *testing.T) {
+		const crash = `goroutine 6 gp=0xc000007a40 m=nil [chan receive]:
+main.worker()
+	/path/to/main.go:20 +0x2 fp=0xc000051720 sp=0xc000051700 pc=0x476e8a
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+
+-----
+
+goroutine 0 gp=0xc000007340 m=1 mp=0xc000080008 [idle]:
+runtime.futex(0x53ef20, 0x80, 0x0, 0xc00007fea0, 0x0, 0x0)
+	/usr/local/go/src/runtime/sys_linux_amd64.s:576 +0x23 fp=0xc00007fe70 sp=0xc00007fe68 pc=0x47dd23
+rax    0xfffffffffffffffc
+`
+		report, err := Analyze(strings.NewReader(crash))
+		require.NoError(t, err)
+		require.Len(t, report.Stacks(), 1, "System stacks of threads should not be reported")
+		assert.Equal(t, 6, report.Stacks()[0].ID())
+	})
+
+	t.Run("ancestors", func(t *testing.T) {
+		const ancestors = `goroutine 7 [chan receive]:
+main.leaf()
+	/path/to/main.go:8 +0x19
+created by main.mid in goroutine 6
+	/path/to/main.go:11 +0x5f
+[originating from goroutine 6]:
+main.mid(...)
+	/path/to/main.go:12 +0x5f
+created by main.main
+	/path/to/main.go:18 +0x95
+[originating from goroutine 1]:
+main.main(...)
+	/path/to/main.go:19 +0x95
+`
+		report, err := Analyze(strings.NewReader(ancestors), MaxFrames(0))
+		require.NoError(t, err)
+		out := report.String()
+		assert.Contains(t, out, "(ancestors: 6 (main.mid) <- 1 (main.main)) Goroutine 7")
+		assert.Contains(t, out, "[originating from goroutine 1]:\nmain.main(...)", "Ancestors should be kept when truncating")
+	})
+
+	t.Run("invalid dump", func(t *testing.T) {
+		_, err := Analyze(strings.NewReader("goroutine x [running]:\nmain.main()\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse goroutine stacks")
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import "go.uber.org/goleak/stack"
+
+// Snapshot is a record of the goroutines that were running at a point in
+// time, which can be used to look for goroutines started after that point.
+//
+// Unlike IgnoreCurrent, a Snapshot is created explicitly, and can be checked
+// any number of times:
+//
+//	snap := goleak.NewSnapshot()
+//	// start and stop some goroutines
+//	require.NoError(t, snap.Check())
+type Snapshot struct {
+	ids        map[int]bool
+	signatures map[string]bool
+}
+
+// NewSnapshot records all current goroutines.
+func NewSnapshot() *Snapshot {
+	// Any goroutines that could not be parsed are reported by Find.
+	stacks, _ := stack.All()
+	ids := make(map[int]bool, len(stacks))
+	signatures := make(map[string]bool, len(stacks))
+	for _, s := range stacks {
+		ids[s.ID()] = true
+		signatures[s.Signature()] = true
+	}
+	return &Snapshot{ids: ids, signatures: signatures}
+}
+
+// Check looks for goroutines that were not running when the snapshot was
+// created like Find, and returns a descriptive error if any are found.
+func (s *Snapshot) Check(options ...Option) error {
+	opts := make([]Option, 0, len(options)+1)
+	opts = append(opts, options...)
+	opts = append(opts, s.ignore())
+	return Find(opts...)
+}
+
+// ignore returns an option that ignores the goroutines in the snapshot.
+func (s *Snapshot) ignore() Option {
+	return addFilter(func(st stack.Stack) bool {
+		return s.ids[st.ID()]
+	})
+}
+
+// VerifyNoNewLeaks marks the given TestingT as failed if any goroutines are
+// found by Find with a stack that was not seen when the baseline snapshot
+// was created. Unlike Snapshot.Check, goroutines are compared by their stack
+// signature rather than their ID, so goroutines that are restarted after the
+// snapshot, e.g., by infrastructure shared by integration tests, are not
+// reported. New goroutines blocked at the same place as a goroutine in the
+// snapshot are not reported either.
+func VerifyNoNewLeaks(t TestingT, baseline *Snapshot, options ...Option) {
+	if h, ok := t.(helperT); ok {
+		h.Helper()
+	}
+	// Copy the options so we don't modify the caller's slice.
+	VerifyNone(t, append(options[:len(options):len(options)], ignoreSignatures(baseline.signatures))...)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	before := startBlockedG()
+	defer before.unblock()
+
+	snap := NewSnapshot()
+	require.NoError(t, snap.Check(), "Goroutines in the snapshot should be ignored")
+
+	after := startBlockedG()
+	err := snap.Check(testOptions())
+	require.Error(t, err, "Goroutines started after the snapshot should be reported")
+	assert.Contains(t, err.Error(), "blockedG")
+
+	// A second, independent snapshot includes the new goroutine.
+	snap2 := NewSnapshot()
+	require.NoError(t, snap2.Check())
+	require.Error(t, snap.Check(testOptions()), "First snapshot should be unaffected")
+
+	require.NoError(t, snap.Check(IgnoreTopFunction("go.uber.org/goleak.(*blockedG).run")),
+		"Goroutines started after the snapshot can be ignored")
+
+	after.unblock()
+	require.NoError(t, snap.Check(), "Snapshot can be checked repeatedly")
+}
+
+func TestVerifyNoNewLeaks(t *testing.T) {
+	before := startBlockedG()
+	baseline := NewSnapshot()
+	before.unblock()
+
+	// A goroutine with the same stack, started after the snapshot.
+	restarted := startBlockedG()
+	defer restarted.unblock()
+
+	ft := &fakeT{}
+	VerifyNoNewLeaks(ft, baseline, testOptions())
+	assert.Empty(t, ft.errors, "Goroutines with a stack in the snapshot should be ignored")
+
+	done := make(chan struct{})
+	go func() { <-done }()
+	VerifyNoNewLeaks(ft, baseline, testOptions())
+	require.Len(t, ft.errors, 1, "Goroutines with new stacks should be reported")
+	assert.Contains(t, ft.errors[0], "TestVerifyNoNewLeaks.func1")
+	assert.NotContains(t, ft.errors[0], "blockedG")
+
+	close(done)
+	ft = &fakeT{}
+	VerifyNoNewLeaks(ft, baseline)
+	assert.Empty(t, ft.errors, "Expect no errors once the new goroutine exits")
+}
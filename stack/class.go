@@ -0,0 +1,133 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import "strings"
+
+// Class is a coarse category of what a goroutine is doing,
+// derived from its state.
+type Class int
+
+const (
+	// ClassUnknown is used for states that are not recognized.
+	ClassUnknown Class = iota
+
+	// ClassRunning is used for goroutines that are running, or are ready to run.
+	ClassRunning
+
+	// ClassChannel is used for goroutines blocked on a channel operation.
+	ClassChannel
+
+	// ClassSync is used for goroutines blocked on a sync primitive,
+	// such as a sync.Mutex or sync.WaitGroup.
+	ClassSync
+
+	// ClassSyscall is used for goroutines in a system call, or waiting for I/O.
+	ClassSyscall
+
+	// ClassWaiting is used for goroutines waiting for any other reason,
+	// such as sleeping or waiting on the garbage collector.
+	ClassWaiting
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassRunning:
+		return "running"
+	case ClassChannel:
+		return "channel"
+	case ClassSync:
+		return "sync"
+	case ClassSyscall:
+		return "syscall"
+	case ClassWaiting:
+		return "waiting"
+	default:
+		return "unknown"
+	}
+}
+
+// _stateClasses maps goroutine states, as printed by the runtime,
+// to their class. See the waitReason strings in runtime/runtime2.go.
+var _stateClasses = map[string]Class{
+	"idle":      ClassRunning,
+	"runnable":  ClassRunning,
+	"running":   ClassRunning,
+	"preempted": ClassRunning,
+	"copystack": ClassRunning,
+
+	"chan receive":            ClassChannel,
+	"chan send":               ClassChannel,
+	"chan receive (nil chan)": ClassChannel,
+	"chan send (nil chan)":    ClassChannel,
+	"chan receive (synctest)": ClassChannel,
+	"chan send (synctest)":    ClassChannel,
+	"select":                  ClassChannel,
+	"select (no cases)":       ClassChannel,
+	"select (synctest)":       ClassChannel,
+
+	"semacquire":          ClassSync,
+	"sync.Cond.Wait":      ClassSync,
+	"sync.Mutex.Lock":     ClassSync,
+	"sync.RWMutex.Lock":   ClassSync,
+	"sync.RWMutex.RLock":  ClassSync,
+	"sync.WaitGroup.Wait": ClassSync,
+
+	"syscall": ClassSyscall,
+	"IO wait": ClassSyscall,
+
+	"waiting":                 ClassWaiting,
+	"sleep":                   ClassWaiting,
+	"finalizer wait":          ClassWaiting,
+	"cleanup wait":            ClassWaiting,
+	"force gc (idle)":         ClassWaiting,
+	"GC assist marking":       ClassWaiting,
+	"GC assist wait":          ClassWaiting,
+	"GC sweep wait":           ClassWaiting,
+	"GC scavenge wait":        ClassWaiting,
+	"GC worker (idle)":        ClassWaiting,
+	"GC worker (active)":      ClassWaiting,
+	"garbage collection":      ClassWaiting,
+	"garbage collection scan": ClassWaiting,
+	"wait for GC cycle":       ClassWaiting,
+	"trace reader (blocked)":  ClassWaiting,
+	"dumping heap":            ClassWaiting,
+	"panicwait":               ClassWaiting,
+	"debug call":              ClassWaiting,
+	"stopping the world":      ClassWaiting,
+	"flushing proc caches":    ClassWaiting,
+	"coroutine":               ClassWaiting,
+	"synctest.Run":            ClassWaiting,
+	"synctest.Wait":           ClassWaiting,
+}
+
+// Class returns the class of the goroutine, determined from its state.
+func (s Stack) Class() Class {
+	state := s.state
+	if idx := strings.Index(state, ", "); idx >= 0 {
+		// Ignore the wait duration or other details after the state,
+		// e.g., "chan receive, 6 minutes, locked to thread".
+		state = state[:idx]
+	}
+	// The runtime marks goroutines whose stacks are being scanned.
+	state = strings.TrimSuffix(state, " (scan)")
+	return _stateClasses[state]
+}
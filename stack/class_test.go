@@ -0,0 +1,113 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		state string
+		want  Class
+	}{
+		{"running", ClassRunning},
+		{"runnable", ClassRunning},
+		{"runnable (scan)", ClassRunning},
+		{"chan receive", ClassChannel},
+		{"chan send, 3 minutes", ClassChannel},
+		{"chan receive (nil chan)", ClassChannel},
+		{"select", ClassChannel},
+		{"select (no cases), locked to thread", ClassChannel},
+		{"semacquire", ClassSync},
+		{"sync.Mutex.Lock", ClassSync},
+		{"sync.RWMutex.RLock", ClassSync},
+		{"sync.Cond.Wait, 10 minutes", ClassSync},
+		{"syscall", ClassSyscall},
+		{"syscall, locked to thread", ClassSyscall},
+		{"IO wait", ClassSyscall},
+		{"sleep", ClassWaiting},
+		{"finalizer wait", ClassWaiting},
+		{"GC worker (idle)", ClassWaiting},
+		{"waiting", ClassWaiting},
+		{"some new state", ClassUnknown},
+		{"", ClassUnknown},
+	}
+
+	for _, tt := range tests {
+		s := Stack{state: tt.state}
+		assert.Equal(t, tt.want, s.Class(), "Class for state %q", tt.state)
+	}
+}
+
+func TestClassString(t *testing.T) {
+	tests := []struct {
+		class Class
+		want  string
+	}{
+		{ClassUnknown, "unknown"},
+		{ClassRunning, "running"},
+		{ClassChannel, "channel"},
+		{ClassSync, "sync"},
+		{ClassSyscall, "syscall"},
+		{ClassWaiting, "waiting"},
+		{Class(42), "unknown"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.class.String())
+	}
+}
+
+func TestClassAll(t *testing.T) {
+	var mu sync.Mutex
+	mu.Lock()
+	defer mu.Unlock()
+
+	ch := make(chan struct{})
+	defer close(ch)
+
+	go func() { <-ch }()
+	go func() {
+		mu.Lock()
+		mu.Unlock()
+	}()
+
+	want := map[Class]bool{
+		ClassChannel: true,
+		ClassSync:    true,
+	}
+	for retry := 0; len(want) > 0; retry++ {
+		require.True(t, retry < 1000, "failed to find goroutines with classes %v", want)
+
+		all, err := All()
+		require.NoError(t, err)
+		for _, s := range all {
+			delete(want, s.Class())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
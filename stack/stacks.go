@@ -0,0 +1,847 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package stack parses goroutine stack dumps, such as those produced by
+// runtime.Stack, SIGQUIT, or the goroutine profile with debug=2, and
+// provides helpers to inspect the parsed stacks. It is the parser used
+// by goleak, and can be used to build other tools that analyze goroutines.
+package stack
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const _defaultBufferSize = 64 * 1024 // 64 KiB
+
+// Stack represents a single Goroutine's stack.
+type Stack struct {
+	id            int
+	state         string
+	firstFunction string
+	frames        []Frame
+	createdBy     Frame
+	creatorID     int
+	elidedFrames  int
+	ancestors     []Ancestor
+	labels        map[string]string
+	fullStack     *bytes.Buffer
+}
+
+// _ancestorPrefix starts the stack of each ancestor of a goroutine,
+// e.g., "[originating from goroutine 6]:".
+const _ancestorPrefix = "[originating from goroutine "
+
+// Ancestor is the stack of a goroutine that created another goroutine,
+// directly or indirectly, as of when it created the next goroutine in the
+// chain. It's reported by the runtime with GODEBUG=tracebackancestors=N.
+type Ancestor struct {
+	// ID is the ID of the ancestor goroutine, which may have exited.
+	ID int
+
+	// Frames are the function calls on the ancestor's stack, and
+	// CreatedBy is the function call that created the ancestor.
+	Frames    []Frame
+	CreatedBy Frame
+}
+
+// Frame is a single function call on a goroutine's stack.
+type Frame struct {
+	// Function is the fully qualified name of the function,
+	// e.g., "go.uber.org/goleak.Find".
+	Function string
+
+	// File is the path of the source file containing the call,
+	// and Line is the line number within it.
+	File string
+	Line int
+
+	// Offset is the offset of the program counter from the start of the
+	// function as reported by the runtime, e.g., "+0x1f". It is empty for
+	// frames without an offset, such as inlined function calls.
+	Offset string
+}
+
+// Package returns the import path of the package containing the function,
+// e.g., "go.uber.org/goleak" for "go.uber.org/goleak.(*opts).filter".
+// For vendored packages, the path excludes the vendor directory.
+func (f Frame) Package() string {
+	pkg, _ := splitFunction(f.Function)
+	return pkg
+}
+
+// ID returns the goroutine ID.
+func (s Stack) ID() int {
+	return s.id
+}
+
+// State returns the Goroutine's state, exactly as reported between the
+// brackets of the stack header, including any qualifiers such as how long
+// the goroutine has been blocked, e.g., "chan receive, 6 minutes".
+func (s Stack) State() string {
+	return s.state
+}
+
+// Labels returns the pprof labels of the goroutine, which the runtime only
+// includes in its stack since Go 1.27, for modules that declare Go 1.27 or
+// later, or with GODEBUG=tracebacklabels=1. It returns nil if the stack has
+// no labels, which includes goroutines with labels on earlier versions.
+func (s Stack) Labels() map[string]string {
+	return s.labels
+}
+
+// BaseState returns the Goroutine's state without how long the goroutine
+// has been blocked, e.g., "chan receive" for "chan receive, 6 minutes".
+// Other qualifiers, such as "locked to thread", are kept.
+func (s Stack) BaseState() string {
+	return baseState(s.state)
+}
+
+// Header returns the original header line of the goroutine's stack, without
+// the trailing newline, e.g., "goroutine 7 [chan receive, 6 minutes]:".
+// This includes any fields that aren't parsed, such as those in extended
+// headers, which is useful for runtime output that goleak doesn't model.
+func (s Stack) Header() string {
+	return firstLine(s.Full())
+}
+
+// WaitDuration returns how long the goroutine has been blocked, as reported
+// in its state, e.g., "chan receive, 6 minutes". The runtime only reports
+// this for goroutines that have been blocked for at least a minute, and
+// with minute granularity, so WaitDuration returns 0 otherwise.
+func (s Stack) WaitDuration() time.Duration {
+	for _, part := range strings.Split(s.state, ", ") {
+		if d, ok := parseWaitDuration(part); ok {
+			return d
+		}
+	}
+	return 0
+}
+
+// Full returns the full stack trace for this goroutine.
+func (s Stack) Full() string {
+	return s.fullStack.String()
+}
+
+// FirstFunction returns the name of the first function on the stack.
+// It returns an empty string if the goroutine has no frames, which can
+// happen in rare runtime states where only the goroutine header is printed.
+func (s Stack) FirstFunction() string {
+	return s.firstFunction
+}
+
+// Frames returns the function calls on the stack, starting with the
+// first function. It does not include the "created by" function.
+func (s Stack) Frames() []Frame {
+	return s.frames
+}
+
+// ElidedFrames returns the number of function calls that the runtime left
+// out of the stack when printing it, which happens for very deep stacks,
+// and are therefore missing from Frames. It returns -1 if frames were left
+// out, but the runtime didn't report how many, as done by older Go versions.
+func (s Stack) ElidedFrames() int {
+	return s.elidedFrames
+}
+
+// HasFunction reports whether the specified function is anywhere
+// on the stack. It does not check the "created by" function.
+func (s Stack) HasFunction(name string) bool {
+	for _, f := range s.frames {
+		if f.Function == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Packages returns the distinct import paths of the packages of the functions
+// on the stack, in the order they first appear, starting from the top of the
+// stack. It does not include the package of the "created by" function.
+func (s Stack) Packages() []string {
+	var (
+		pkgs []string
+		seen = make(map[string]bool, len(s.frames))
+	)
+	for _, f := range s.frames {
+		pkg := f.Package()
+		if pkg == "" || seen[pkg] {
+			continue
+		}
+		seen[pkg] = true
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs
+}
+
+// CreatedBy returns the function call that created this goroutine, which
+// is the zero Frame if the goroutine was not created by another goroutine,
+// e.g., for the main goroutine.
+func (s Stack) CreatedBy() Frame {
+	return s.createdBy
+}
+
+// CreatorID returns the ID of the goroutine that created this goroutine,
+// which is only reported since Go 1.21, and is 0 if it's not reported, or
+// if the goroutine was not created by another goroutine.
+func (s Stack) CreatorID() int {
+	return s.creatorID
+}
+
+// Ancestors returns the stacks of the goroutines that led to this goroutine
+// being created, starting with its creator, followed by the creator's creator,
+// and so on. The runtime only reports ancestors if GODEBUG=tracebackancestors=N
+// is set, for up to N ancestors, so Ancestors is usually empty.
+func (s Stack) Ancestors() []Ancestor {
+	return s.ancestors
+}
+
+// FirstNonRuntimeFunction returns the name of the first function on the stack
+// that is not in the runtime package. For a goroutine blocked on a channel
+// operation, this is the function performing the channel operation rather
+// than runtime functions like runtime.gopark, which are included in stacks
+// when GOTRACEBACK=system is set.
+// It returns an empty string if all functions on the stack are in the runtime.
+func (s Stack) FirstNonRuntimeFunction() string {
+	for _, f := range s.frames {
+		if !strings.HasPrefix(f.Function, "runtime.") {
+			return f.Function
+		}
+	}
+	return ""
+}
+
+// Truncate returns a copy of the stack that only includes the first
+// maxFrames frames, in both Frames and Full. Any omitted frames are replaced
+// with a line noting how many were omitted, and the function that created
+// the goroutine is always included. This is intended for reporting stacks
+// where only the top of the stack is relevant.
+func (s Stack) Truncate(maxFrames int) Stack {
+	if maxFrames < 0 || len(s.frames) <= maxFrames {
+		return s
+	}
+
+	full := &bytes.Buffer{}
+	lines := strings.SplitAfter(s.Full(), "\n")
+	full.WriteString(lines[0])
+
+	var frames int
+	for i, line := range lines[1:] {
+		if strings.HasPrefix(line, "created by ") || line == "\n" {
+			// Keep the creator, and anything after it.
+			full.WriteString(strings.Join(lines[i+1:], ""))
+			break
+		}
+		if _, ok := parseFunc(line); ok && !strings.HasPrefix(line, "\t") {
+			frames++
+			if frames == maxFrames+1 {
+				fmt.Fprintf(full, "...%v frames omitted...\n", len(s.frames)-maxFrames)
+			}
+		}
+		if frames <= maxFrames {
+			full.WriteString(line)
+		}
+	}
+
+	s.frames = s.frames[:maxFrames:maxFrames]
+	s.fullStack = full
+	return s
+}
+
+// Equal reports whether the two stacks are the same, ignoring the details
+// that are ignored by Signature, such as the goroutine ID.
+func (s Stack) Equal(other Stack) bool {
+	return s.normalized() == other.normalized()
+}
+
+// Signature returns an identifier for the stack which is the same for all
+// goroutines blocked at the same place with the same frames. It ignores
+// details that vary between otherwise identical goroutines: the goroutine ID,
+// function arguments, PC offsets, and how long the goroutine has been waiting.
+func (s Stack) Signature() string {
+	h := fnv.New64a()
+	io.WriteString(h, s.normalized())
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// normalized returns the full stack with any details that are not part of
+// the signature removed.
+func (s Stack) normalized() string {
+	var b strings.Builder
+	b.WriteString("[" + s.BaseState() + "]\n")
+
+	lines := strings.Split(s.Full(), "\n")
+	for _, line := range lines[1:] {
+		switch {
+		case line == "":
+			// Skip the blank line separating goroutines, which is not
+			// present for the last goroutine in the dump.
+			continue
+		case strings.HasPrefix(line, "\t"):
+			// File and line, followed by the PC offset: "\t/path/to/file.go:10 +0x1f"
+			if idx := strings.LastIndex(line, " +0x"); idx > 0 {
+				line = line[:idx]
+			}
+		case strings.HasPrefix(line, _ancestorPrefix):
+			// The ID of an ancestor varies like the goroutine's own ID.
+			line = _ancestorPrefix + "]:"
+		case strings.HasPrefix(line, "created by "):
+			// Since Go 1.21, the creator's goroutine ID is included:
+			// "created by main.main in goroutine 1"
+			if idx := strings.LastIndex(line, " in goroutine "); idx > 0 {
+				line = line[:idx]
+			}
+		default:
+			// Function with arguments: "main.foo(0xc000012345, 0x1)"
+			if idx := strings.LastIndex(line, "("); idx > 0 {
+				line = line[:idx]
+			}
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+func (s Stack) String() string {
+	if s.firstFunction == "" {
+		return fmt.Sprintf(
+			"Goroutine %v in state %v, with no frames on the stack:\n%s",
+			s.id, s.state, s.Full())
+	}
+	return fmt.Sprintf(
+		"Goroutine %v in state %v, with %v on top of the stack:\n%s",
+		s.id, s.state, s.firstFunction, s.Full())
+}
+
+func getStacks(all bool) ([]Stack, error) {
+	return parseStacks(getStackBuffer(nil, all))
+}
+
+// parseStacks parses the stacks of all goroutines in the given dump, which
+// is formatted the same as the output of runtime.Stack.
+// If any goroutine could not be parsed, it is skipped and an error is
+// returned along with the stacks of all other goroutines.
+func parseStacks(buf []byte) ([]Stack, error) {
+	return parseDump(buf, false /* ignoreOther */)
+}
+
+// Parse parses the stacks of all goroutines in a dump read from r,
+// such as the traceback printed by a crashed process or on SIGQUIT,
+// or the goroutine profile with debug=2 served by net/http/pprof.
+// Tracebacks printed with GOTRACEBACK=crash, which include the
+// registers and system stacks of each thread, are also supported.
+//
+// Unlike the output of runtime.Stack, such dumps often include other text
+// around the goroutines, such as the panic message before them, or the
+// "exit status 2" printed by "go run" after them. Lines outside of
+// a goroutine are ignored.
+func Parse(r io.Reader) ([]Stack, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read stack dump: %v", err)
+	}
+	return parseDump(buf, true /* ignoreOther */)
+}
+
+// parseDump parses the stacks of all goroutines in buf.
+// If ignoreOther is set, lines outside of a goroutine are skipped
+// instead of being reported as an error.
+func parseDump(buf []byte, ignoreOther bool) ([]Stack, error) {
+	var (
+		stacks   []Stack
+		parseErr error
+	)
+
+	var (
+		curStack    *Stack
+		inCreatedBy bool
+		ended       bool
+		lastLine    string
+	)
+	stackReader := bufio.NewReader(bytes.NewReader(buf))
+	for {
+		line, err := stackReader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			// We're reading using bytes.NewReader which should never fail.
+			panic("bufio.NewReader failed on a fixed string")
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+
+		// If we see the goroutine header, start a new stack.
+		if strings.HasPrefix(line, "goroutine ") {
+			// flush any previous stack
+			if curStack != nil {
+				stacks = append(stacks, *curStack)
+				curStack = nil
+			}
+
+			id, goState, labels, err := parseGoStackHeader(line)
+			if err != nil {
+				// Skip the lines of this goroutine till the next header.
+				if parseErr == nil {
+					parseErr = err
+				}
+				continue
+			}
+
+			curStack = &Stack{
+				id:        id,
+				state:     goState,
+				labels:    labels,
+				fullStack: &bytes.Buffer{},
+			}
+			curStack.fullStack.WriteString(line)
+			inCreatedBy = false
+			ended = false
+			lastLine = line
+			continue
+		}
+
+		if curStack != nil && (ended || ignoreOther && isTrailer(curStack, inCreatedBy, line)) && strings.TrimSpace(line) != "" {
+			// The previous goroutine is followed by something other
+			// than the next goroutine.
+			stacks = append(stacks, *curStack)
+			curStack = nil
+		}
+
+		if curStack == nil {
+			if !ignoreOther && strings.TrimSpace(line) != "" && parseErr == nil {
+				parseErr = fmt.Errorf("unexpected line outside of a goroutine: %q", line)
+			}
+			continue
+		}
+		curStack.fullStack.WriteString(line)
+		lastLine = line
+
+		switch {
+		case strings.TrimSpace(line) == "":
+			// Goroutines are separated by a blank line, which is the only line
+			// following the header for a goroutine without any frames.
+			ended = true
+		case strings.HasPrefix(line, "\t"):
+			// The file and line for the preceding function call.
+			if frame := curStack.lastFrame(inCreatedBy); frame != nil {
+				parseFileLine(line, frame)
+			}
+		case strings.HasPrefix(line, _ancestorPrefix):
+			// The stack of an ancestor, which follows the goroutine's
+			// own stack and any earlier ancestors.
+			id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(line), _ancestorPrefix), "]:"))
+			curStack.ancestors = append(curStack.ancestors, Ancestor{ID: id})
+			inCreatedBy = false
+		case strings.HasPrefix(line, "created by "):
+			fn, creatorID := parseCreatedBy(line)
+			if n := len(curStack.ancestors); n > 0 {
+				curStack.ancestors[n-1].CreatedBy = Frame{Function: fn}
+			} else {
+				curStack.createdBy = Frame{Function: fn}
+				curStack.creatorID = creatorID
+			}
+			inCreatedBy = true
+		default:
+			// Lines that aren't function calls, such as
+			// "...additional frames elided...", are skipped.
+			fn, ok := parseFunc(line)
+			switch n := len(curStack.ancestors); {
+			case !ok && n == 0:
+				if elided := parseElidedFrames(line); elided != 0 {
+					curStack.elidedFrames = elided
+				}
+			case !ok:
+			case n > 0:
+				curStack.ancestors[n-1].Frames = append(curStack.ancestors[n-1].Frames, Frame{Function: fn})
+			default:
+				if curStack.firstFunction == "" {
+					curStack.firstFunction = fn
+				}
+				curStack.frames = append(curStack.frames, Frame{Function: fn})
+			}
+		}
+	}
+
+	if curStack != nil {
+		if isTruncated(curStack, inCreatedBy, lastLine) {
+			// The dump was cut off in the middle of this goroutine,
+			// so drop it rather than returning a partial stack.
+			if parseErr == nil {
+				parseErr = fmt.Errorf("incomplete stack for goroutine %v, the stack dump may be truncated", curStack.id)
+			}
+		} else {
+			stacks = append(stacks, *curStack)
+		}
+	}
+	return stacks, parseErr
+}
+
+// isTrailer reports whether the given line of a dump that follows the lines
+// parsed so far for s is not part of the goroutine, such as the
+// "exit status 2" printed after the last goroutine by "go run".
+func isTrailer(s *Stack, inCreatedBy bool, line string) bool {
+	switch {
+	case strings.HasPrefix(line, "\t"), strings.TrimSpace(line) == "":
+		return false
+	case len(s.frames) == 0, !strings.HasSuffix(line, "\n"):
+		// A goroutine must have a function call after its header,
+		// and a line at the end of the dump without a newline may be
+		// a function call that was cut off.
+		return false
+	case strings.HasPrefix(line, _ancestorPrefix):
+		return false
+	case inCreatedBy:
+		// "created by" is always the last frame of a goroutine,
+		// unless it's followed by the stacks of its ancestors.
+		return s.lastFrame(inCreatedBy).Line > 0
+	case strings.HasPrefix(line, "created by "), strings.HasPrefix(line, "..."):
+		return false
+	}
+	_, ok := parseFunc(line)
+	return !ok
+}
+
+// isTruncated reports whether the given stack, which is the last in the dump,
+// was cut off, based on the last line of the dump.
+func isTruncated(s *Stack, inCreatedBy bool, lastLine string) bool {
+	if !strings.HasSuffix(lastLine, "\n") && !strings.HasPrefix(lastLine, "\t") && strings.TrimSpace(lastLine) != "" {
+		// A function call or "created by" line that was cut off.
+		// The last line of a complete dump may not end with a newline,
+		// but it's always a file and line.
+		return !strings.HasPrefix(lastLine, "goroutine ")
+	}
+
+	// Every function call is followed by its file and line,
+	// which are cut off, or missing the line number, if truncated.
+	last := s.lastFrame(inCreatedBy)
+	return last != nil && last.Line == 0
+}
+
+// lastFrame returns the last function call parsed so far for the stack, which
+// is the "created by" function if inCreatedBy is set, and is in the stack of
+// the last ancestor if there are any. It returns nil if there are no calls.
+func (s *Stack) lastFrame(inCreatedBy bool) *Frame {
+	frames, createdBy := s.frames, &s.createdBy
+	if n := len(s.ancestors); n > 0 {
+		frames, createdBy = s.ancestors[n-1].Frames, &s.ancestors[n-1].CreatedBy
+	}
+	switch {
+	case inCreatedBy:
+		return createdBy
+	case len(frames) > 0:
+		return &frames[len(frames)-1]
+	}
+	return nil
+}
+
+// ParseStack parses the stack of a single goroutine, formatted the same as
+// the output of runtime.Stack, e.g., from a log or a panic:
+//
+//	goroutine 1 [chan receive]:
+//	main.main()
+//		/path/to/main.go:10 +0x1f
+//
+// It returns an error if the text does not start with a valid goroutine
+// header, or if it contains more than one goroutine.
+func ParseStack(text string) (Stack, error) {
+	if !strings.HasPrefix(text, "goroutine ") {
+		return Stack{}, fmt.Errorf("missing goroutine header in %q", firstLine(text))
+	}
+
+	stacks, err := parseStacks([]byte(text))
+	if err != nil {
+		return Stack{}, err
+	}
+	if len(stacks) != 1 {
+		return Stack{}, fmt.Errorf("expected a single goroutine, found %v", len(stacks))
+	}
+	return stacks[0], nil
+}
+
+func firstLine(text string) string {
+	if idx := strings.Index(text, "\n"); idx >= 0 {
+		return text[:idx]
+	}
+	return text
+}
+
+// All returns the stacks for all running goroutines.
+// If the stacks of any goroutines could not be parsed, an error is returned
+// along with the stacks of all other goroutines.
+func All() ([]Stack, error) {
+	return getStacks(true)
+}
+
+// Sampler gets the stacks of all running goroutines like All, reusing the
+// buffer for the stack dump between calls. The zero value is ready to use.
+// A Sampler is not safe for concurrent use.
+type Sampler struct {
+	buf []byte
+}
+
+// All returns the stacks for all running goroutines, like the All function.
+func (s *Sampler) All() ([]Stack, error) {
+	s.buf = getStackBuffer(s.buf, true /* all */)
+	return parseStacks(s.buf)
+}
+
+// Current returns the stack for the current goroutine.
+func Current() Stack {
+	stacks, _ := getStacks(false)
+	if len(stacks) == 0 {
+		// The current goroutine's stack could not be parsed.
+		return Stack{fullStack: &bytes.Buffer{}}
+	}
+	return stacks[0]
+}
+
+// getStackBuffer returns the stack dump, using buf if it's large enough,
+// and otherwise, a new buffer that's large enough.
+func getStackBuffer(buf []byte, all bool) []byte {
+	if cap(buf) < _defaultBufferSize {
+		buf = make([]byte, _defaultBufferSize)
+	}
+	for buf = buf[:cap(buf)]; ; buf = make([]byte, 2*len(buf)) {
+		if n := runtime.Stack(buf, all); n < len(buf) {
+			return buf[:n]
+		}
+	}
+}
+
+// parseFunc parses the function name from a function call line that looks like:
+// go.uber.org/goleak.(*blockedG).run(0xc000012345)\n
+func parseFunc(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if idx := strings.LastIndex(line, "("); idx > 0 {
+		return line[:idx], true
+	}
+	return "", false
+}
+
+// splitFunction splits a fully qualified function name into the import path
+// of its package and the function name within the package, e.g.,
+// "go.uber.org/goleak.(*opts).filter" is split into "go.uber.org/goleak"
+// and "(*opts).filter".
+func splitFunction(fn string) (pkg string, name string) {
+	// Generic functions include type parameters, which may contain
+	// other package paths, e.g., "pkg.Map[...]" or "pkg.Map[other/pkg.T]".
+	nonGeneric := fn
+	if idx := strings.Index(fn, "["); idx >= 0 {
+		nonGeneric = fn[:idx]
+	}
+
+	// The package path ends at the first "." after the last "/",
+	// since dots in the last element are escaped, e.g., "gopkg.in/yaml%2ev2".
+	start := strings.LastIndex(nonGeneric, "/") + 1
+	idx := strings.Index(nonGeneric[start:], ".")
+	if idx < 0 {
+		return "", fn
+	}
+	pkg, name = fn[:start+idx], fn[start+idx+1:]
+
+	if unescaped, err := url.PathUnescape(pkg); err == nil {
+		pkg = unescaped
+	}
+	if idx := strings.LastIndex(pkg, "/vendor/"); idx >= 0 {
+		pkg = pkg[idx+len("/vendor/"):]
+	}
+	pkg = strings.TrimPrefix(pkg, "vendor/")
+	return pkg, name
+}
+
+// parseCreatedBy parses the function name from a line that looks like:
+// created by go.uber.org/goleak.startBlockedG in goroutine 1\n
+// Go versions before 1.21 do not include the creator's goroutine ID.
+func parseCreatedBy(line string) (fn string, creatorID int) {
+	line = strings.TrimPrefix(strings.TrimSpace(line), "created by ")
+	if idx := strings.LastIndex(line, " in goroutine "); idx > 0 {
+		creatorID, _ = strconv.Atoi(line[idx+len(" in goroutine "):])
+		line = line[:idx]
+	}
+	return line, creatorID
+}
+
+// parseFileLine parses the file, line number and offset into the given frame
+// from a line that looks like:
+// \t/path/to/file.go:10 +0x1f\n
+// With GOTRACEBACK=system, the offset is followed by the frame, stack and
+// program counters, which are ignored.
+// The line number is 0 if it could not be parsed.
+func parseFileLine(line string, frame *Frame) {
+	line = strings.TrimSpace(line)
+	if idx := strings.LastIndex(line, " +0x"); idx > 0 {
+		frame.Offset = line[idx+1:]
+		if end := strings.IndexByte(frame.Offset, ' '); end > 0 {
+			frame.Offset = frame.Offset[:end]
+		}
+		line = line[:idx]
+	}
+
+	frame.File = line
+	idx := strings.LastIndex(line, ":")
+	if idx < 0 {
+		return
+	}
+
+	lineNum, err := strconv.Atoi(line[idx+1:])
+	if err != nil {
+		return
+	}
+	frame.File, frame.Line = line[:idx], lineNum
+}
+
+// baseState returns the state without the wait duration that the runtime
+// includes for goroutines that have been blocked for over a minute, e.g.,
+// "chan receive, 6 minutes" becomes "chan receive".
+func baseState(state string) string {
+	parts := strings.Split(state, ", ")
+	base := parts[:0]
+	for _, part := range parts {
+		if _, ok := parseWaitDuration(part); !ok {
+			base = append(base, part)
+		}
+	}
+	return strings.Join(base, ", ")
+}
+
+// parseWaitDuration parses the wait duration of a goroutine from a part of
+// its state that looks like "6 minutes".
+func parseWaitDuration(part string) (time.Duration, bool) {
+	if !strings.HasSuffix(part, " minutes") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(part, " minutes"))
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(n) * time.Minute, true
+}
+
+// parseElidedFrames returns the number of frames that were elided according
+// to a line like "...5 frames elided...", which is -1 for the line
+// "...additional frames elided...", and 0 for any other line.
+func parseElidedFrames(line string) int {
+	line = strings.TrimSpace(line)
+	if line == "...additional frames elided..." {
+		return -1
+	}
+	if !strings.HasPrefix(line, "...") || !strings.HasSuffix(line, " frames elided...") {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(line, "..."), " frames elided..."))
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// parseGoStackHeader parses a stack header that looks like:
+//
+//	goroutine 643 [runnable]:\n
+//
+// Some runtimes include extra fields between the ID and the state, e.g.,
+//
+//	goroutine 643 gp=0xc000102000 m=nil [runnable]:\n
+//
+// And since Go 1.27, the pprof labels of the goroutine follow the state:
+//
+//	goroutine 643 [runnable] {worker: bg, "peer name": "a b"}:\n
+//
+// And returns the goroutine ID, the state, and the labels, if any.
+func parseGoStackHeader(line string) (goroutineID int, state string, labels map[string]string, err error) {
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), ":")
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 {
+		return 0, "", nil, fmt.Errorf("unexpected stack header format: %q", line)
+	}
+
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to parse goroutine ID: %v in line %q", parts[1], line)
+	}
+
+	// The state is the bracketed segment at the end of the header,
+	// which may be preceded by extra fields, and may itself contain spaces.
+	rest := parts[2]
+	if idx := strings.LastIndex(rest, "] {"); idx >= 0 && strings.HasSuffix(rest, "}") {
+		labels, err = parseHeaderLabels(rest[idx+3 : len(rest)-1])
+		if err != nil {
+			return 0, "", nil, fmt.Errorf("failed to parse goroutine labels: %v in line %q", err, line)
+		}
+		rest = rest[:idx+1]
+	}
+	open := strings.Index(rest, "[")
+	if open < 0 || !strings.HasSuffix(rest, "]") {
+		return 0, "", nil, fmt.Errorf("missing bracketed goroutine state in line %q", line)
+	}
+	state = rest[open+1 : len(rest)-1]
+	return id, state, labels, nil
+}
+
+// parseHeaderLabels parses the labels in a stack header, e.g.,
+// `worker: bg, "peer name": "a b"`, where keys and values are quoted
+// if they contain characters other than letters, digits, '.', '/' and '_'.
+func parseHeaderLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for s != "" {
+		key, rest, err := parseHeaderLabel(s, ": ")
+		if err != nil {
+			return nil, err
+		}
+		value, rest, err := parseHeaderLabel(rest, ", ")
+		if err != nil {
+			return nil, err
+		}
+		labels[key] = value
+		s = rest
+	}
+	return labels, nil
+}
+
+// parseHeaderLabel parses a possibly quoted key or value at the start of s,
+// followed by sep, or the end of s, and returns the text after sep.
+func parseHeaderLabel(s, sep string) (label, rest string, _ error) {
+	if strings.HasPrefix(s, `"`) {
+		quoted, err := strconv.QuotedPrefix(s)
+		if err != nil {
+			return "", "", fmt.Errorf("invalid quoted label %q", s)
+		}
+		if label, err = strconv.Unquote(quoted); err != nil {
+			return "", "", fmt.Errorf("invalid quoted label %q", quoted)
+		}
+		rest = s[len(quoted):]
+	} else if idx := strings.Index(s, sep); idx >= 0 {
+		label, rest = s[:idx], s[idx:]
+	} else {
+		label = s
+	}
+
+	if rest != "" && !strings.HasPrefix(rest, sep) {
+		return "", "", fmt.Errorf("expected %q after label %q", sep, label)
+	}
+	return label, strings.TrimPrefix(rest, sep), nil
+}
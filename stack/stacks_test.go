@@ -0,0 +1,1058 @@
+// Copyright (c) 2017 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package stack
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _allDone chan struct{}
+
+func waitForDone() {
+	<-_allDone
+}
+
+func TestAll(t *testing.T) {
+	// We use a global channel so that the function below does not
+	// receive any arguments, so we can test that parseFirstFunc works
+	// regardless of arguments on the stack.
+	_allDone = make(chan struct{})
+	defer close(_allDone)
+
+	for i := 0; i < 5; i++ {
+		go waitForDone()
+	}
+
+	cur := Current()
+	got, err := All()
+	require.NoError(t, err)
+
+	// Retry until the background stacks are not runnable/running.
+	for {
+		if !isBackgroundRunning(cur, got) {
+			break
+		}
+		runtime.Gosched()
+		got, err = All()
+		require.NoError(t, err)
+	}
+
+	// On js/wasm, the runtime may start a goroutine to handle events.
+	filtered := got[:0]
+	for _, s := range got {
+		if !strings.Contains(s.Full(), "runtime.handleEvent") {
+			filtered = append(filtered, s)
+		}
+	}
+	got = filtered
+
+	// We have exactly 7 gorotuines:
+	// "main" goroutine
+	// test goroutine
+	// 5 goroutines started above.
+	require.Len(t, got, 7)
+	sort.Sort(byGoroutineID(got))
+
+	assert.Contains(t, got[0].Full(), "testing.(*T).Run")
+	assert.Contains(t, got[1].Full(), "TestAll")
+	for i := 0; i < 5; i++ {
+		assert.Contains(t, got[2+i].Full(), "stack.waitForDone")
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	got := Current()
+	assert.NotZero(t, got.ID(), "Should get non-zero goroutine id")
+	assert.Equal(t, "running", got.State())
+	assert.Equal(t, "go.uber.org/goleak/stack.getStackBuffer", got.FirstFunction())
+
+	wantFrames := []string{
+		"stack.getStackBuffer",
+		"stack.getStacks",
+		"stack.Current",
+		"stack.Current",
+		"stack.TestCurrent",
+	}
+	all := got.Full()
+	for _, frame := range wantFrames {
+		assert.Contains(t, all, frame)
+	}
+	assert.Contains(t, got.String(), "in state")
+	assert.Contains(t, got.String(), "on top of the stack")
+
+	// Ensure that we are not returning the buffer without slicing it
+	// from getStackBuffer.
+	if len(got.Full()) > 1024 {
+		t.Fatalf("Returned stack is too large")
+	}
+}
+
+func TestAllLargeStack(t *testing.T) {
+	const (
+		stackDepth    = 100
+		numGoroutines = 100
+	)
+
+	var started sync.WaitGroup
+
+	done := make(chan struct{})
+	for i := 0; i < numGoroutines; i++ {
+		var f func(int)
+		f = func(count int) {
+			if count == 0 {
+				started.Done()
+				<-done
+				return
+			}
+			f(count - 1)
+		}
+		started.Add(1)
+		go f(stackDepth)
+	}
+
+	started.Wait()
+	buf := getStackBuffer(nil, true /* all */)
+	if len(buf) <= _defaultBufferSize {
+		t.Fatalf("Expected larger stack buffer")
+	}
+
+	// Start enough goroutines so we exceed the default buffer size.
+	close(done)
+}
+
+type byGoroutineID []Stack
+
+func (ss byGoroutineID) Len() int           { return len(ss) }
+func (ss byGoroutineID) Less(i, j int) bool { return ss[i].ID() < ss[j].ID() }
+func (ss byGoroutineID) Swap(i, j int)      { ss[i], ss[j] = ss[j], ss[i] }
+
+// Note: This is the same logic as in ../../utils_test.go
+// Copy+pasted to avoid dependency loops and exporting this test-helper.
+func isBackgroundRunning(cur Stack, stacks []Stack) bool {
+	for _, s := range stacks {
+		if cur.ID() == s.ID() {
+			continue
+		}
+
+		if strings.Contains(s.State(), "run") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestSampler(t *testing.T) {
+	var sampler Sampler
+	for i := 0; i < 3; i++ {
+		got, err := sampler.All()
+		require.NoError(t, err)
+
+		var found bool
+		for _, s := range got {
+			if s.ID() == Current().ID() {
+				found = true
+				assert.Contains(t, s.Full(), "TestSampler")
+			}
+		}
+		assert.True(t, found, "Expected the current goroutine in %v", got)
+	}
+	assert.GreaterOrEqual(t, cap(sampler.buf), _defaultBufferSize, "Expected buffer to be reused")
+}
+
+func TestParseStacksHeaderOnly(t *testing.T) {
+	const dump = `goroutine 1 [running]:
+
+goroutine 2 [chan receive]:
+main.waitForDone()
+	/path/to/main.go:10 +0x1f
+created by main.main
+	/path/to/main.go:5 +0x25
+
+goroutine 3 [runnable]:
+`
+	stacks, err := parseStacks([]byte(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 3)
+
+	assert.Equal(t, 1, stacks[0].ID())
+	assert.Equal(t, "running", stacks[0].State())
+	assert.Empty(t, stacks[0].FirstFunction())
+	assert.Equal(t, "goroutine 1 [running]:\n\n", stacks[0].Full())
+	assert.Contains(t, stacks[0].String(), "with no frames on the stack")
+
+	assert.Equal(t, 2, stacks[1].ID())
+	assert.Equal(t, "main.waitForDone", stacks[1].FirstFunction())
+	assert.Contains(t, stacks[1].String(), "with main.waitForDone on top of the stack")
+
+	assert.Equal(t, 3, stacks[2].ID())
+	assert.Equal(t, "runnable", stacks[2].State())
+	assert.Empty(t, stacks[2].FirstFunction())
+}
+
+func TestSignature(t *testing.T) {
+	const dump = `goroutine 10 [chan receive]:
+main.worker(0xc000012345, 0x1)
+	/path/to/main.go:10 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x25
+
+goroutine 11 [chan receive, 6 minutes]:
+main.worker(0xc000054321, 0x2)
+	/path/to/main.go:10 +0x2b
+created by main.main in goroutine 7
+	/path/to/main.go:5 +0x30
+
+goroutine 12 [chan receive]:
+main.worker(0xc000012345, 0x1)
+	/path/to/main.go:12 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x25
+
+goroutine 13 [select]:
+main.worker(0xc000012345, 0x1)
+	/path/to/main.go:10 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x25
+`
+	stacks, err := parseStacks([]byte(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 4)
+
+	sig := stacks[0].Signature()
+	assert.Len(t, sig, 16, "Signature should be a fixed-width hash")
+	assert.Equal(t, sig, stacks[1].Signature(), "Signature should ignore ID, arguments, offsets and wait duration")
+	assert.NotEqual(t, sig, stacks[2].Signature(), "Signature should differ for a different line")
+	assert.NotEqual(t, sig, stacks[3].Signature(), "Signature should differ for a different state")
+}
+
+func waitOn(ch chan struct{}) {
+	<-ch
+}
+
+func TestEqual(t *testing.T) {
+	parse := func(text string) Stack {
+		s, err := ParseStack(text)
+		require.NoError(t, err)
+		return s
+	}
+
+	s := parse("goroutine 7 [chan receive]:\nmain.run(0xc000010000)\n\t/path/to/main.go:10 +0x1f\n")
+	assert.True(t, s.Equal(s), "Stack should equal itself")
+	assert.True(t, s.Equal(parse("goroutine 8 [chan receive, 3 minutes]:\nmain.run(0xc000020000)\n\t/path/to/main.go:10 +0x2e\n")),
+		"Stacks should be equal ignoring ID, arguments, offsets and wait duration")
+	assert.False(t, s.Equal(parse("goroutine 7 [select]:\nmain.run(0xc000010000)\n\t/path/to/main.go:10 +0x1f\n")),
+		"Stacks with different states should not be equal")
+	assert.False(t, s.Equal(parse("goroutine 7 [chan receive]:\nmain.run(0xc000010000)\n\t/path/to/main.go:11 +0x1f\n")),
+		"Stacks with different lines should not be equal")
+	assert.False(t, s.Equal(Stack{}), "Stack should not equal the zero Stack")
+}
+
+func TestSignatureAll(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	for i := 0; i < 2; i++ {
+		go waitOn(done)
+	}
+
+	var sigs []string
+	for {
+		sigs = sigs[:0]
+		all, err := All()
+		require.NoError(t, err)
+		for _, s := range all {
+			if s.FirstFunction() == "go.uber.org/goleak/stack.waitOn" && s.State() == "chan receive" {
+				sigs = append(sigs, s.Signature())
+			}
+		}
+		if len(sigs) == 2 {
+			break
+		}
+		runtime.Gosched()
+	}
+	assert.Equal(t, sigs[0], sigs[1], "Goroutines blocked at the same place should have the same signature")
+}
+
+func TestAllLabels(t *testing.T) {
+	// Only Go 1.27 and later include labels in stacks.
+	t.Setenv("GODEBUG", "tracebacklabels=1")
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	pprof.Do(context.Background(), pprof.Labels("worker", "bg", "peer name", "a b"), func(context.Context) {
+		go func() {
+			close(started)
+			<-done
+		}()
+	})
+	<-started
+
+	stacks, err := All()
+	require.NoError(t, err)
+	for _, s := range stacks {
+		if s.Labels() != nil {
+			assert.Equal(t, map[string]string{"worker": "bg", "peer name": "a b"}, s.Labels())
+			return
+		}
+	}
+	t.Skip("runtime doesn't include labels in stacks")
+}
+
+func TestParseGoStackHeader(t *testing.T) {
+	tests := []struct {
+		msg        string
+		line       string
+		wantID     int
+		wantState  string
+		wantLabels map[string]string
+	}{
+		{
+			msg:       "classic",
+			line:      "goroutine 643 [runnable]:\n",
+			wantID:    643,
+			wantState: "runnable",
+		},
+		{
+			msg:       "classic with wait duration",
+			line:      "goroutine 7 [chan receive, 6 minutes]:\n",
+			wantID:    7,
+			wantState: "chan receive, 6 minutes",
+		},
+		{
+			msg:       "extended",
+			line:      "goroutine 1 gp=0xc000002380 m=nil [chan receive]:\n",
+			wantID:    1,
+			wantState: "chan receive",
+		},
+		{
+			msg:       "extended running",
+			line:      "goroutine 18 gp=0xc000102000 m=3 mp=0xc000080808 [running]:\n",
+			wantID:    18,
+			wantState: "running",
+		},
+		{
+			msg:       "extended with wait duration",
+			line:      "goroutine 5 gp=0xc000007dc0 m=nil [select, 2 minutes, locked to thread]:\n",
+			wantID:    5,
+			wantState: "select, 2 minutes, locked to thread",
+		},
+		{
+			msg:        "labels",
+			line:       "goroutine 7 [chan receive, 6 minutes] {worker: bg, goleak.test: TestFoo/bar_1}:\n",
+			wantID:     7,
+			wantState:  "chan receive, 6 minutes",
+			wantLabels: map[string]string{"worker": "bg", "goleak.test": "TestFoo/bar_1"},
+		},
+		{
+			msg:        "quoted labels",
+			line:       `goroutine 8 gp=0xc000102000 m=nil [select] {"peer name": "a, \"b\"", id: "1\n2"}:` + "\n",
+			wantID:     8,
+			wantState:  "select",
+			wantLabels: map[string]string{"peer name": `a, "b"`, "id": "1\n2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			id, state, labels, err := parseGoStackHeader(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantID, id, "ID")
+			assert.Equal(t, tt.wantState, state, "state")
+			assert.Equal(t, tt.wantLabels, labels, "labels")
+		})
+	}
+}
+
+func TestParseStacksExtendedHeader(t *testing.T) {
+	classic := `goroutine 1 [chan receive]:
+main.main()
+	/path/to/main.go:10 +0x1f
+`
+	extended := `goroutine 1 gp=0xc000002380 m=nil [chan receive]:
+main.main()
+	/path/to/main.go:10 +0x1f
+`
+
+	want, err := ParseStack(classic)
+	require.NoError(t, err)
+	got, err := ParseStack(extended)
+	require.NoError(t, err)
+
+	assert.Equal(t, want.ID(), got.ID(), "ID")
+	assert.Equal(t, want.State(), got.State(), "state")
+	assert.Equal(t, want.Frames(), got.Frames(), "frames")
+	assert.Equal(t, want.Signature(), got.Signature(), "Extra header fields should not affect the signature")
+
+	assert.Equal(t, "goroutine 1 [chan receive]:", want.Header(), "classic header")
+	assert.Equal(t, "goroutine 1 gp=0xc000002380 m=nil [chan receive]:", got.Header(), "extended header")
+}
+
+func TestBaseState(t *testing.T) {
+	tests := []struct {
+		state string
+		want  string
+	}{
+		{"running", "running"},
+		{"chan receive", "chan receive"},
+		{"chan receive, 6 minutes", "chan receive"},
+		{"select, 1 minutes, locked to thread", "select, locked to thread"},
+		{"syscall, locked to thread", "syscall, locked to thread"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, baseState(tt.state), "baseState(%q)", tt.state)
+		assert.Equal(t, tt.want, Stack{state: tt.state}.BaseState(), "BaseState for %q", tt.state)
+	}
+}
+
+func TestWaitDuration(t *testing.T) {
+	tests := []struct {
+		state string
+		want  time.Duration
+	}{
+		{"running", 0},
+		{"chan receive", 0},
+		{"chan receive, 6 minutes", 6 * time.Minute},
+		{"select, 1 minutes, locked to thread", time.Minute},
+		{"syscall, locked to thread", 0},
+		{"select, many minutes", 0},
+	}
+
+	for _, tt := range tests {
+		s := Stack{state: tt.state}
+		assert.Equal(t, tt.want, s.WaitDuration(), "WaitDuration for state %q", tt.state)
+	}
+}
+
+func TestFrames(t *testing.T) {
+	// Stack captured with GOTRACEBACK=system, which includes runtime frames.
+	const dump = `goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce fp=0xc000047ed8 sp=0xc000047eb8 pc=0x43b5ee
+runtime.chanrecv(0xc00001c120, 0x0, 0x1)
+	/usr/local/go/src/runtime/chan.go:583 +0x3cd fp=0xc000047f50 sp=0xc000047ed8 pc=0x40760d
+runtime.chanrecv1(0xc000047f98?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:442 +0x12 fp=0xc000047f78 sp=0xc000047f50 pc=0x407212
+main.(*worker).run(...)
+	/path/to/main.go:10
+main.main.func1()
+	/path/to/main.go:20 +0x25 fp=0xc000047fe0 sp=0xc000047f78 pc=0x4a1c45
+created by main.main in goroutine 1
+	/path/to/main.go:19 +0x6b
+
+goroutine 8 [select]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+...additional frames elided...
+created by main.main in goroutine 1
+	/path/to/main.go:25 +0x6b
+
+goroutine 9 [select]:
+main.recurse(...)
+	/path/to/main.go:30
+...5 frames elided...
+main.recurse(...)
+	/path/to/main.go:30
+main.main.func2()
+	/path/to/main.go:35 +0x25
+created by main.main in goroutine 1
+	/path/to/main.go:34 +0x6b
+`
+	stacks, err := parseStacks([]byte(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 3)
+
+	assert.Equal(t, []Frame{
+		{Function: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 398, Offset: "+0xce"},
+		{Function: "runtime.chanrecv", File: "/usr/local/go/src/runtime/chan.go", Line: 583, Offset: "+0x3cd"},
+		{Function: "runtime.chanrecv1", File: "/usr/local/go/src/runtime/chan.go", Line: 442, Offset: "+0x12"},
+		{Function: "main.(*worker).run", File: "/path/to/main.go", Line: 10},
+		{Function: "main.main.func1", File: "/path/to/main.go", Line: 20, Offset: "+0x25"},
+	}, stacks[0].Frames())
+	assert.Equal(t, "runtime.gopark", stacks[0].FirstFunction())
+	assert.Equal(t, "main.(*worker).run", stacks[0].FirstNonRuntimeFunction())
+	assert.Equal(t, Frame{Function: "main.main", File: "/path/to/main.go", Line: 19, Offset: "+0x6b"}, stacks[0].CreatedBy())
+
+	assert.Equal(t, []Frame{
+		{Function: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 398, Offset: "+0xce"},
+	}, stacks[1].Frames())
+	assert.Empty(t, stacks[1].FirstNonRuntimeFunction(), "No functions outside the runtime")
+
+	assert.Zero(t, stacks[0].ElidedFrames())
+	assert.Equal(t, -1, stacks[1].ElidedFrames(), "Unknown number of elided frames")
+	assert.Equal(t, 5, stacks[2].ElidedFrames())
+	assert.Len(t, stacks[2].Frames(), 3)
+}
+
+func TestFramesCurrent(t *testing.T) {
+	frames := Current().Frames()
+	require.NotEmpty(t, frames)
+	assert.Equal(t, "go.uber.org/goleak/stack.getStackBuffer", frames[0].Function)
+	assert.True(t, strings.HasSuffix(frames[0].File, "stacks.go"), "unexpected file: %v", frames[0].File)
+	assert.NotZero(t, frames[0].Line)
+	assert.True(t, strings.HasPrefix(frames[0].Offset, "+0x"), "unexpected offset: %v", frames[0].Offset)
+}
+
+func TestParseStacksWASM(t *testing.T) {
+	// Stacks from a GOOS=js GOARCH=wasm binary, which has a background
+	// goroutine with runtime frames for handling events.
+	const dump = `goroutine 1 [running]:
+main.main()
+	/path/to/main.go:8 +0x9
+
+goroutine 6 [chan receive]:
+main.main.func1()
+	/path/to/main.go:5 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x6
+
+goroutine 7 [waiting]:
+runtime.gopark(0x0, 0x0, 0x0, 0x0, 0x1)
+	/usr/local/go/src/runtime/proc.go:474 +0x24
+runtime.handleEvent()
+	/usr/local/go/src/runtime/lock_js.go:296 +0x25
+runtime.goexit({})
+	/usr/local/go/src/runtime/asm_wasm.s:413 +0x1`
+
+	stacks, err := parseStacks([]byte(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 3)
+
+	assert.Equal(t, "main.main", stacks[0].FirstFunction())
+	assert.Zero(t, stacks[0].CreatedBy(), "main goroutine has no creator")
+	assert.Equal(t, "main.main.func1", stacks[1].FirstFunction())
+	assert.Equal(t, Frame{Function: "main.main", File: "/path/to/main.go", Line: 5, Offset: "+0x6"}, stacks[1].CreatedBy())
+	assert.Equal(t, 1, stacks[1].CreatorID(), "creator ID")
+	assert.Zero(t, stacks[0].CreatorID(), "main goroutine has no creator")
+	assert.Equal(t, "waiting", stacks[2].State())
+	assert.Equal(t, []Frame{
+		{Function: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 474, Offset: "+0x24"},
+		{Function: "runtime.handleEvent", File: "/usr/local/go/src/runtime/lock_js.go", Line: 296, Offset: "+0x25"},
+		{Function: "runtime.goexit", File: "/usr/local/go/src/runtime/asm_wasm.s", Line: 413, Offset: "+0x1"},
+	}, stacks[2].Frames(), "Last line without a trailing newline should be parsed")
+}
+
+func TestParseStacksErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		dump    string
+		wantIDs []int
+		wantErr string
+	}{
+		{
+			msg:     "missing state",
+			dump:    "goroutine 1:\nmain.main()\n\ngoroutine 2 [running]:\nmain.foo()\n\t/path/to/main.go:10 +0x1f\n",
+			wantIDs: []int{2},
+			wantErr: "unexpected stack header format",
+		},
+		{
+			msg:     "invalid ID",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\ngoroutine x [running]:\nmain.foo()\n",
+			wantIDs: []int{1},
+			wantErr: "failed to parse goroutine ID",
+		},
+		{
+			msg:     "state without brackets",
+			dump:    "goroutine 1 running:\nmain.main()\n\ngoroutine 2 [running]:\nmain.foo()\n\t/path/to/main.go:10 +0x1f\n",
+			wantIDs: []int{2},
+			wantErr: "missing bracketed goroutine state",
+		},
+		{
+			msg:     "extended header without state",
+			dump:    "goroutine 1 gp=0xc000002380 m=nil:\nmain.main()\n\ngoroutine 2 [running]:\nmain.foo()\n\t/path/to/main.go:10 +0x1f\n",
+			wantIDs: []int{2},
+			wantErr: "missing bracketed goroutine state",
+		},
+		{
+			msg:     "invalid labels",
+			dump:    "goroutine 1 [running] {\"worker: bg}:\nmain.main()\n\ngoroutine 2 [running]:\nmain.foo()\n\t/path/to/main.go:10 +0x1f\n",
+			wantIDs: []int{2},
+			wantErr: "failed to parse goroutine labels",
+		},
+		{
+			msg:     "line before header",
+			dump:    "main.main()\ngoroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n",
+			wantIDs: []int{1},
+			wantErr: "unexpected line outside of a goroutine",
+		},
+		{
+			msg:     "line after goroutine",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\nexit status 2\n",
+			wantIDs: []int{1},
+			wantErr: "unexpected line outside of a goroutine",
+		},
+		{
+			msg:     "function without arguments",
+			dump:    "goroutine 1 [running]:\n\tgoroutine running on other thread; stack unavailable\nmain.main\n",
+			wantIDs: []int{1},
+		},
+		{
+			msg:     "truncated after function",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan receive]:\nmain.foo()\n",
+			wantIDs: []int{1},
+			wantErr: "incomplete stack for goroutine 2",
+		},
+		{
+			msg:     "truncated in function",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan receive]:\nmain.foo()\n\t/path/to/foo.go:5 +0x1\nmain.ba",
+			wantIDs: []int{1},
+			wantErr: "incomplete stack for goroutine 2",
+		},
+		{
+			msg:     "truncated in file",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan receive]:\nmain.foo()\n\t/path/to/fo",
+			wantIDs: []int{1},
+			wantErr: "incomplete stack for goroutine 2",
+		},
+		{
+			msg:     "truncated after created by",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan receive]:\nmain.foo()\n\t/path/to/foo.go:5 +0x1\ncreated by main.main in goroutine 1\n",
+			wantIDs: []int{1},
+			wantErr: "incomplete stack for goroutine 2",
+		},
+		{
+			msg:     "truncated in header",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan rec",
+			wantIDs: []int{1},
+			wantErr: "missing bracketed goroutine state",
+		},
+		{
+			msg:     "complete without trailing newline",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [chan receive]:\nmain.foo()\n\t/path/to/foo.go:5 +0x1",
+			wantIDs: []int{1, 2},
+		},
+		{
+			msg:     "header only at the end",
+			dump:    "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [running]:\n",
+			wantIDs: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			stacks, err := parseStacks([]byte(tt.dump))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var ids []int
+			for _, s := range stacks {
+				ids = append(ids, s.ID())
+			}
+			assert.Equal(t, tt.wantIDs, ids)
+		})
+	}
+}
+
+func TestParseStack(t *testing.T) {
+	const text = `goroutine 6 [chan receive, 3 minutes]:
+main.main.func1(0xc000012345)
+	/path/to/main.go:5 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:4 +0x6
+`
+	s, err := ParseStack(text)
+	require.NoError(t, err)
+	assert.Equal(t, 6, s.ID())
+	assert.Equal(t, "chan receive, 3 minutes", s.State())
+	assert.Equal(t, 3*time.Minute, s.WaitDuration())
+	assert.Equal(t, "main.main.func1", s.FirstFunction())
+	assert.Equal(t, "main.main", s.CreatedBy().Function)
+	assert.Equal(t, text, s.Full())
+}
+
+func TestParseStackErrors(t *testing.T) {
+	tests := []struct {
+		msg     string
+		text    string
+		wantErr string
+	}{
+		{
+			msg:     "empty",
+			text:    "",
+			wantErr: "missing goroutine header",
+		},
+		{
+			msg:     "no header",
+			text:    "main.main()\n\t/path/to/main.go:5 +0x2\n",
+			wantErr: `missing goroutine header in "main.main()"`,
+		},
+		{
+			msg:     "invalid header",
+			text:    "goroutine 1:\nmain.main()\n",
+			wantErr: "unexpected stack header format",
+		},
+		{
+			msg:     "multiple goroutines",
+			text:    "goroutine 1 [running]:\nmain.main()\n\ngoroutine 2 [running]:\nmain.foo()\n\t/path/to/main.go:10 +0x1f\n",
+			wantErr: "expected a single goroutine, found 2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			_, err := ParseStack(tt.text)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	const dump = `panic: something went wrong
+
+goroutine 1 [running]:
+main.main()
+	/path/to/main.go:10 +0x1f
+
+goroutine 6 [chan receive, 3 minutes]:
+main.worker()
+	/path/to/main.go:20 +0x2
+created by main.main in goroutine 1
+	/path/to/main.go:9 +0x6
+exit status 2
+`
+	stacks, err := Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 2)
+
+	assert.Equal(t, 1, stacks[0].ID())
+	assert.Equal(t, "main.main", stacks[0].FirstFunction())
+	assert.Equal(t, "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\n", stacks[0].Full())
+
+	assert.Equal(t, 6, stacks[1].ID())
+	assert.Equal(t, "main.worker", stacks[1].FirstFunction())
+	assert.Equal(t, "main.main", stacks[1].CreatedBy().Function)
+	assert.NotContains(t, stacks[1].Full(), "exit status", "Trailer should not be part of the stack")
+}
+
+func TestParseTrailers(t *testing.T) {
+	const goroutine = "goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n"
+	tests := []struct {
+		msg     string
+		trailer string
+	}{
+		{msg: "exit status", trailer: "exit status 2\n"},
+		{msg: "after blank line", trailer: "\nexit status 2\n"},
+		{msg: "test failure", trailer: "FAIL\tgo.uber.org/goleak\t0.123s\n"},
+		{msg: "multiple lines", trailer: "\n[signal SIGQUIT: quit]\n\nrax    0x0\nrbx    0x1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			stacks, err := Parse(strings.NewReader(goroutine + tt.trailer))
+			require.NoError(t, err)
+			require.Len(t, stacks, 1)
+			assert.Equal(t, "main.main", stacks[0].FirstFunction())
+			assert.Equal(t, 10, stacks[0].Frames()[0].Line)
+			assert.NotContains(t, stacks[0].Full(), strings.TrimSpace(tt.trailer))
+		})
+	}
+}
+
+func TestParseCrashDump(t *testing.T) {
+	// Printed on SIGQUIT with GOTRACEBACK=crash.
+	const dump = `SIGQUIT: quit
+PC=0x40c84e m=0 sigcode=0
+
+goroutine 6 gp=0xc000007a40 m=nil [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca fp=0xc000051720 sp=0xc000051700 pc=0x476e8a
+main.main.func1()
+	/path/to/main.go:11 +0x19 fp=0xc0000517e0 sp=0xc0000517c0 pc=0x4832f9
+created by main.main in goroutine 1
+	/path/to/main.go:11 +0x76
+
+rax    0x0
+rbx    0x35d8
+gs     0x0
+
+-----
+
+SIGQUIT: quit
+PC=0x47dd23 m=1 sigcode=0
+
+goroutine 0 gp=0xc000007340 m=1 mp=0xc000080008 [idle]:
+runtime.futex(0x53ef20, 0x80, 0x0, 0xc00007fea0, 0x0, 0x0)
+	/usr/local/go/src/runtime/sys_linux_amd64.s:576 +0x23 fp=0xc00007fe70 sp=0xc00007fe68 pc=0x47dd23
+runtime.mstart()
+	/usr/local/go/src/runtime/asm_amd64.s:393 +0xa fp=0xc000080000 sp=0xc00007fff8 pc=0x47a76a
+rax    0xfffffffffffffffc
+gs     0x0
+exit status 2
+`
+	stacks, err := Parse(strings.NewReader(dump))
+	require.NoError(t, err)
+	require.Len(t, stacks, 2)
+
+	assert.Equal(t, 6, stacks[0].ID())
+	assert.Equal(t, "chan receive", stacks[0].State())
+	assert.Equal(t, []Frame{
+		{Function: "runtime.gopark", File: "/usr/local/go/src/runtime/proc.go", Line: 474, Offset: "+0xca"},
+		{Function: "main.main.func1", File: "/path/to/main.go", Line: 11, Offset: "+0x19"},
+	}, stacks[0].Frames())
+	assert.Equal(t, "main.main", stacks[0].CreatedBy().Function)
+	assert.NotContains(t, stacks[0].Full(), "rax", "Registers should not be part of the stack")
+
+	plain, err := ParseStack(`goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:474 +0xca
+main.main.func1()
+	/path/to/main.go:11 +0x19
+created by main.main in goroutine 1
+	/path/to/main.go:11 +0x76
+`)
+	require.NoError(t, err)
+	assert.Equal(t, plain.Signature(), stacks[0].Signature(),
+		"Signature should not depend on the traceback level")
+
+	assert.Equal(t, 0, stacks[1].ID())
+	assert.Equal(t, "runtime.futex", stacks[1].FirstFunction())
+	assert.Len(t, stacks[1].Frames(), 2)
+	assert.NotContains(t, stacks[1].Full(), "rax", "Registers should not be part of the stack")
+}
+
+func TestParseAncestors(t *testing.T) {
+	// Printed with GODEBUG=tracebackancestors=5.
+	const dump = `goroutine 1 [running]:
+main.main()
+	/path/to/main.go:21 +0xce
+
+goroutine 7 [chan receive]:
+main.leaf(0xc000020060)
+	/path/to/main.go:8 +0x19
+created by main.mid in goroutine 6
+	/path/to/main.go:11 +0x5f
+[originating from goroutine 6]:
+main.mid(...)
+	/path/to/main.go:12 +0x5f
+created by main.main
+	/path/to/main.go:18 +0x95
+[originating from goroutine 1]:
+main.main(...)
+	/path/to/main.go:19 +0x95
+`
+	tests := []struct {
+		msg   string
+		parse func(string) ([]Stack, error)
+		text  string
+	}{
+		{msg: "runtime.Stack", parse: func(text string) ([]Stack, error) { return parseStacks([]byte(text)) }, text: dump},
+		{msg: "Parse with trailer", parse: func(text string) ([]Stack, error) { return Parse(strings.NewReader(text)) }, text: dump + "exit status 2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			stacks, err := tt.parse(tt.text)
+			require.NoError(t, err)
+			require.Len(t, stacks, 2)
+			assert.Empty(t, stacks[0].Ancestors(), "Expected no ancestors for the main goroutine")
+
+			s := stacks[1]
+			assert.Equal(t, []Frame{
+				{Function: "main.leaf", File: "/path/to/main.go", Line: 8, Offset: "+0x19"},
+			}, s.Frames(), "Ancestor frames should not be part of the stack")
+			assert.Equal(t, Frame{Function: "main.mid", File: "/path/to/main.go", Line: 11, Offset: "+0x5f"}, s.CreatedBy())
+			assert.Equal(t, 6, s.CreatorID())
+			assert.Equal(t, []Ancestor{
+				{
+					ID:        6,
+					Frames:    []Frame{{Function: "main.mid", File: "/path/to/main.go", Line: 12, Offset: "+0x5f"}},
+					CreatedBy: Frame{Function: "main.main", File: "/path/to/main.go", Line: 18, Offset: "+0x95"},
+				},
+				{
+					ID:     1,
+					Frames: []Frame{{Function: "main.main", File: "/path/to/main.go", Line: 19, Offset: "+0x95"}},
+				},
+			}, s.Ancestors())
+			assert.Contains(t, s.Full(), "[originating from goroutine 1]:\nmain.main(...)")
+			assert.NotContains(t, s.Full(), "exit status")
+		})
+	}
+
+	t.Run("signature", func(t *testing.T) {
+		a, err := ParseStack("goroutine 7 [chan receive]:\nmain.leaf()\n\t/path/to/main.go:8 +0x19\n" +
+			"created by main.mid in goroutine 6\n\t/path/to/main.go:11 +0x5f\n" +
+			"[originating from goroutine 6]:\nmain.mid(...)\n\t/path/to/main.go:12 +0x5f\n")
+		require.NoError(t, err)
+		b, err := ParseStack("goroutine 9 [chan receive]:\nmain.leaf()\n\t/path/to/main.go:8 +0x19\n" +
+			"created by main.mid in goroutine 8\n\t/path/to/main.go:11 +0x5f\n" +
+			"[originating from goroutine 8]:\nmain.mid(...)\n\t/path/to/main.go:12 +0x5f\n")
+		require.NoError(t, err)
+		assert.Equal(t, a.Signature(), b.Signature(), "Signature should not depend on ancestor IDs")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		_, err := Parse(strings.NewReader("goroutine 7 [chan receive]:\nmain.leaf()\n\t/path/to/main.go:8 +0x19\n" +
+			"created by main.mid in goroutine 6\n\t/path/to/main.go:11 +0x5f\n" +
+			"[originating from goroutine 6]:\nmain.mid(...)\n"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "truncated")
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Run("read failure", func(t *testing.T) {
+		_, err := Parse(iotest.ErrReader(errors.New("great sadness")))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "great sadness")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		stacks, err := Parse(strings.NewReader("goroutine 1 [running]:\nmain.main()\n\t/path/to/main.go:10 +0x1f\n\ngoroutine 2 [running]:\nmain.fo"))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "incomplete stack for goroutine 2")
+		require.Len(t, stacks, 1)
+		assert.Equal(t, 1, stacks[0].ID())
+	})
+}
+
+func TestFramePackage(t *testing.T) {
+	tests := []struct {
+		fn       string
+		wantPkg  string
+		wantName string
+	}{
+		{"main.main", "main", "main"},
+		{"main.main.func1", "main", "main.func1"},
+		{"runtime.gopark", "runtime", "gopark"},
+		{"os/signal.loop", "os/signal", "loop"},
+		{"go.uber.org/goleak.(*opts).filter", "go.uber.org/goleak", "(*opts).filter"},
+		{"go.uber.org/goleak/stack.getStackBuffer", "go.uber.org/goleak/stack", "getStackBuffer"},
+		{"gopkg.in/yaml%2ev2.(*decoder).unmarshal", "gopkg.in/yaml.v2", "(*decoder).unmarshal"},
+		{"example.com/pkg.Map[...]", "example.com/pkg", "Map[...]"},
+		{"example.com/pkg.(*List[...]).Push", "example.com/pkg", "(*List[...]).Push"},
+		{"example.com/pkg.Map[example.com/other.T]", "example.com/pkg", "Map[example.com/other.T]"},
+		{"example.com/app/vendor/github.com/lib/pq.(*conn).recv", "github.com/lib/pq", "(*conn).recv"},
+		{"vendor/golang.org/x/net/http2.(*Framer).ReadFrame", "golang.org/x/net/http2", "(*Framer).ReadFrame"},
+		{"nopackage", "", "nopackage"},
+	}
+
+	for _, tt := range tests {
+		pkg, name := splitFunction(tt.fn)
+		assert.Equal(t, tt.wantPkg, pkg, "package for %q", tt.fn)
+		assert.Equal(t, tt.wantName, name, "name for %q", tt.fn)
+		assert.Equal(t, tt.wantPkg, Frame{Function: tt.fn}.Package(), "Package for %q", tt.fn)
+	}
+}
+
+func TestPackages(t *testing.T) {
+	s, err := ParseStack(`goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:398 +0xce
+runtime.chanrecv1(0x0?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:442 +0x12
+example.com/pkg/worker.(*Pool).run(0xc000010000)
+	/path/to/worker/pool.go:20 +0x1f
+example.com/pkg/worker.(*Pool).run-fm()
+	/path/to/worker/pool.go:15 +0x25
+nopackage()
+	/path/to/nopackage.go:1 +0x1
+created by example.com/pkg.Start in goroutine 1
+	/path/to/pkg.go:10 +0x6b
+`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"runtime", "example.com/pkg/worker"}, s.Packages())
+	assert.True(t, s.HasFunction("runtime.chanrecv1"))
+	assert.True(t, s.HasFunction("example.com/pkg/worker.(*Pool).run"))
+	assert.False(t, s.HasFunction("example.com/pkg.Start"), "The created by function should not be matched")
+
+	s, err = ParseStack("goroutine 7 [running]:\n")
+	require.NoError(t, err)
+	assert.Empty(t, s.Packages(), "Goroutine without frames has no packages")
+}
+
+func TestTruncate(t *testing.T) {
+	const text = `goroutine 7 [chan receive]:
+main.c(...)
+	/path/to/main.go:30
+main.b()
+	/path/to/main.go:20 +0x25
+main.a()
+	/path/to/main.go:10 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x6b
+`
+	s, err := ParseStack(text)
+	require.NoError(t, err)
+
+	tests := []struct {
+		maxFrames int
+		want      string
+	}{
+		{
+			maxFrames: 0,
+			want: `goroutine 7 [chan receive]:
+...3 frames omitted...
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x6b
+`,
+		},
+		{
+			maxFrames: 2,
+			want: `goroutine 7 [chan receive]:
+main.c(...)
+	/path/to/main.go:30
+main.b()
+	/path/to/main.go:20 +0x25
+...1 frames omitted...
+created by main.main in goroutine 1
+	/path/to/main.go:5 +0x6b
+`,
+		},
+		{
+			maxFrames: 3,
+			want:      text,
+		},
+		{
+			maxFrames: -1,
+			want:      text,
+		},
+	}
+
+	for _, tt := range tests {
+		truncated := s.Truncate(tt.maxFrames)
+		assert.Equal(t, tt.want, truncated.Full(), "Truncate(%v)", tt.maxFrames)
+		if tt.maxFrames >= 0 && tt.maxFrames < len(s.Frames()) {
+			assert.Len(t, truncated.Frames(), tt.maxFrames, "Truncate(%v) frames", tt.maxFrames)
+		}
+		assert.Equal(t, s.ID(), truncated.ID())
+		assert.Equal(t, s.CreatedBy(), truncated.CreatedBy())
+		assert.Equal(t, text, s.Full(), "original stack should not be modified")
+		assert.Len(t, s.Frames(), 3, "original stack should not be modified")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/goleak/stack"
+)
+
+// suggestIgnores returns the options that would ignore the given goroutine
+// for SuggestIgnores, as Go code, starting with the most specific.
+func suggestIgnores(s stack.Stack) []string {
+	var options []string
+	if f := s.FirstFunction(); f != "" && !isRuntimePackage(s.Frames()[0].Package()) {
+		options = append(options, fmt.Sprintf("goleak.IgnoreTopFunction(%q)", f))
+	} else if f := s.FirstNonRuntimeFunction(); f != "" {
+		options = append(options, fmt.Sprintf("goleak.IgnoreFirstNonRuntimeFunction(%q)", f))
+	}
+	// Ignoring the creator of a test's goroutines would ignore all of them.
+	if c := s.CreatedBy(); c.Function != "" && c.Package() != "testing" {
+		options = append(options, fmt.Sprintf("goleak.IgnoreCreatedBy(%q)", c.Function))
+	}
+	return options
+}
+
+// formatSuggestions formats the options that would ignore the given leaked
+// goroutines for SuggestIgnores, to follow the leaked stacks in Find's error.
+// Alternatives for the same goroutine are on consecutive lines.
+func formatSuggestions(stacks []stack.Stack, opts *opts) string {
+	if !opts.suggestIgnores {
+		return ""
+	}
+
+	var (
+		b    strings.Builder
+		seen = make(map[string]bool)
+	)
+	for _, s := range stacks {
+		options := suggestIgnores(s)
+		key := strings.Join(options, "\n")
+		if len(options) == 0 || seen[key] {
+			continue
+		}
+		seen[key] = true
+		for i, option := range options {
+			b.WriteString("\t" + option + ",")
+			if i < len(options)-1 {
+				b.WriteString(" // or")
+			}
+			b.WriteString("\n")
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	these := "these goroutines"
+	if len(stacks) == 1 {
+		these = "this goroutine"
+	}
+	return fmt.Sprintf("\n\nsuggested options to ignore %v:\n%v", these, strings.TrimRight(b.String(), "\n"))
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestSuggestIgnores(t *testing.T) {
+	tests := []struct {
+		msg   string
+		stack string
+		want  []string
+	}{
+		{
+			msg: "top function and creator",
+			stack: "example.com/pool.(*Pool).run()\n\t/path/to/pool.go:10 +0x1f\n" +
+				"created by example.com/pool.New in goroutine 1\n\t/path/to/pool.go:20 +0x1f\n",
+			want: []string{
+				`goleak.IgnoreTopFunction("example.com/pool.(*Pool).run")`,
+				`goleak.IgnoreCreatedBy("example.com/pool.New")`,
+			},
+		},
+		{
+			msg:   "no creator",
+			stack: "main.main()\n\t/path/to/main.go:10 +0x1f\n",
+			want:  []string{`goleak.IgnoreTopFunction("main.main")`},
+		},
+		{
+			msg: "runtime function on top",
+			stack: "runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)\n\t/usr/local/go/src/runtime/proc.go:398 +0xce\n" +
+				"main.worker()\n\t/path/to/main.go:10 +0x1f\n",
+			want: []string{`goleak.IgnoreFirstNonRuntimeFunction("main.worker")`},
+		},
+		{
+			msg: "created by testing",
+			stack: "main.TestWorker.func1()\n\t/path/to/main_test.go:10 +0x1f\n" +
+				"created by testing.(*T).Run in goroutine 1\n\t/usr/local/go/src/testing/testing.go:1648 +0x3ad\n",
+			want: []string{`goleak.IgnoreTopFunction("main.TestWorker.func1")`},
+		},
+		{
+			msg:   "quoted function",
+			stack: "main.\"weird\".f()\n\t/path/to/main.go:10 +0x1f\n",
+			want:  []string{`goleak.IgnoreTopFunction("main.\"weird\".f")`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack("goroutine 7 [chan receive]:\n" + tt.stack)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, suggestIgnores(s))
+		})
+	}
+}
+
+func TestFormatSuggestions(t *testing.T) {
+	parse := func(body string) stack.Stack {
+		s, err := stack.ParseStack("goroutine 7 [chan receive]:\n" + body)
+		require.NoError(t, err)
+		return s
+	}
+	pool := parse("example.com/pool.(*Pool).run()\n\t/path/to/pool.go:10 +0x1f\n" +
+		"created by example.com/pool.New in goroutine 1\n\t/path/to/pool.go:20 +0x1f\n")
+	worker := parse("main.worker()\n\t/path/to/main.go:10 +0x1f\n")
+
+	assert.Empty(t, formatSuggestions([]stack.Stack{pool}, buildOpts()), "Expected no suggestions by default")
+	assert.Equal(t, "\n\nsuggested options to ignore this goroutine:\n"+
+		"\tgoleak.IgnoreTopFunction(\"main.worker\"),",
+		formatSuggestions([]stack.Stack{worker}, buildOpts(SuggestIgnores())))
+	assert.Equal(t, "\n\nsuggested options to ignore these goroutines:\n"+
+		"\tgoleak.IgnoreTopFunction(\"example.com/pool.(*Pool).run\"), // or\n"+
+		"\tgoleak.IgnoreCreatedBy(\"example.com/pool.New\"),\n"+
+		"\tgoleak.IgnoreTopFunction(\"main.worker\"),",
+		formatSuggestions([]stack.Stack{pool, worker, pool}, buildOpts(SuggestIgnores())),
+		"Expected each suggestion once")
+}
+
+func TestFindSuggestIgnores(t *testing.T) {
+	defer startBlockedG().unblock()
+
+	const suggestion = "suggested options to ignore this goroutine:\n" +
+		"\tgoleak.IgnoreTopFunction(\"go.uber.org/goleak.(*blockedG).run\"), // or\n" +
+		"\tgoleak.IgnoreCreatedBy(\"go.uber.org/goleak.startBlockedG\"),"
+
+	err := Find(testOptions(), SuggestIgnores())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "\n\n"+suggestion)
+
+	ft := &fakeT{}
+	VerifyNone(ft, testOptions(), SuggestIgnores(), ErrorPerLeak())
+	require.Len(t, ft.errors, 1)
+	assert.Contains(t, ft.errors[0], "\n\n"+suggestion+"\n")
+}
@@ -21,9 +21,11 @@
 package goleak
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
 )
 
 // Variables for stubbing in unit tests.
@@ -49,15 +51,172 @@ type TestingM interface {
 //
 // This will run all tests as per normal, and if they were successful, look
 // for any goroutine leaks and fail the tests if any leaks were found.
+// The exit code used when leaks are found can be changed using LeakExitCode.
+// Leaks can also be reported after failed tests using VerifyOnFailure.
+// A function to run before the process exits can be set using OnExit.
+// Leaks can be reported without failing the tests using WarnOnly.
+// Leaks are reported to standard error, or the writer set using ReportTo.
+// Goroutines started before the tests, e.g., by init functions, can be ignored
+// using IgnoreBeforeTestMain.
+// If the goroutine stacks cannot be parsed, for example, due to an unsupported
+// runtime format, the leak check is skipped with a warning.
+// Leaked file descriptors and OS threads can also be checked for using
+// CheckFDs and CheckThreads, leaked Windows handles using CheckHandles, and
+// growth of the heap using CheckHeap.
 func VerifyTestMain(m TestingM, options ...Option) {
+	opts := buildOpts(options...)
+	if opts.ignoreBeforeTestMain {
+		// Copy the options so we don't modify the caller's slice.
+		options = append(options[:len(options):len(options)], ignoreSignatures(currentSignatures()))
+	}
+
+	var (
+		fdsBefore fdSet
+		fdsErr    error
+	)
+	if opts.checkFDs {
+		fdsBefore, fdsErr = openFDs()
+	}
+
+	var (
+		threadsBefore threadCount
+		threadsErr    error
+	)
+	if opts.checkThreads {
+		threadsBefore, threadsErr = _threadCounts()
+	}
+
+	var (
+		handlesBefore handleCount
+		handlesErr    error
+	)
+	if opts.checkHandles {
+		handlesBefore, handlesErr = _handleCounts()
+	}
+
+	var (
+		heapBefore heapSnapshot
+		heapErr    error
+	)
+	if opts.checkHeap {
+		heapBefore, heapErr = _heapSnapshot()
+	}
+
 	exitCode := m.Run()
+	var leaks leakErrors
+	out := _osStderr
+	if opts.reportWriter != nil {
+		out = opts.reportWriter
+	}
+
+	if exitCode == 0 || opts.verifyOnFailure {
+		run, failed := "successful", exitCode != 0
+		if failed {
+			run = "failed"
+		}
+		reportLeaks := func(err error) {
+			leaks = append(leaks, err)
+			if opts.warnOnly {
+				fmt.Fprintf(out, "goleak: Warning: leaks on %v test run: %v\n", run, err)
+				return
+			}
+			fmt.Fprintf(out, "goleak: Errors on %v test run: %v\n", run, err)
+			if !failed {
+				exitCode = opts.leakExitCode
+			}
+		}
+
+		var parseErr *stackParseError
+		warning, err := findErrorWarning(buildOpts(options...))
+		if errors.As(err, &parseErr) {
+			fmt.Fprintf(out, "goleak: Skipping leak check: %v\n", err)
+		} else if err != nil {
+			reportLeaks(err)
+		} else if warning != "" {
+			fmt.Fprintf(out, "goleak: Warning: %v\n", warning)
+		}
 
-	if exitCode == 0 {
-		if err := Find(options...); err != nil {
-			fmt.Fprintf(_osStderr, "goleak: Errors on successful test run: %v\n", err)
-			exitCode = 1
+		if opts.checkFDs {
+			var fdsAfter fdSet
+			if fdsErr == nil {
+				fdsAfter, fdsErr = openFDs()
+			}
+			if fdsErr != nil {
+				fmt.Fprintf(out, "goleak: Skipping file descriptor check: %v\n", fdsErr)
+			} else if leaked := leakedFDs(fdsBefore, fdsAfter); len(leaked) > 0 {
+				reportLeaks(fdLeakError(leaked))
+			}
+		}
+
+		if opts.checkThreads {
+			var leaked threadLeaks
+			if threadsErr == nil {
+				leaked, threadsErr = findThreadLeaks(threadsBefore, opts)
+			}
+			if threadsErr != nil {
+				fmt.Fprintf(out, "goleak: Skipping thread check: %v\n", threadsErr)
+			} else if leaked.count > 0 {
+				reportLeaks(threadLeakError(leaked))
+			}
+		}
+
+		if opts.checkHandles {
+			var leaked int
+			if handlesErr == nil {
+				leaked, handlesErr = findHandleLeaks(handlesBefore, opts)
+			}
+			if handlesErr != nil {
+				fmt.Fprintf(out, "goleak: Skipping handle check: %v\n", handlesErr)
+			} else if leaked > 0 {
+				reportLeaks(handleLeakError(leaked))
+			}
+		}
+
+		if opts.checkHeap {
+			var growth heapGrowth
+			if heapErr == nil {
+				growth, heapErr = findHeapGrowth(heapBefore)
+			}
+			if heapErr != nil {
+				fmt.Fprintf(out, "goleak: Skipping heap check: %v\n", heapErr)
+			} else if growth.bytes > opts.heapBudget {
+				reportLeaks(heapGrowthError(growth, opts.heapBudget))
+			}
 		}
 	}
 
+	if opts.onExit != nil {
+		var err error
+		switch len(leaks) {
+		case 0:
+		case 1:
+			err = leaks[0]
+		default:
+			err = leaks
+		}
+		opts.onExit(exitCode, err)
+	}
 	_osExit(exitCode)
 }
+
+// leakErrors combines the errors for each kind of leak found by
+// VerifyTestMain.
+type leakErrors []error
+
+func (errs leakErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// As allows errors.As to match any of the errors, e.g., a *LeakError.
+func (errs leakErrors) As(target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -22,9 +22,16 @@ package goleak
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
 )
 
 func init() {
@@ -44,6 +51,13 @@ func (d dummyTestMain) Run() int {
 	return int(d)
 }
 
+// funcTestMain runs the function in place of the tests.
+type funcTestMain func() int
+
+func (f funcTestMain) Run() int {
+	return f()
+}
+
 func osStubs() (chan int, chan string) {
 	exitCode := make(chan int, 1)
 	stderr := make(chan string, 1)
@@ -76,3 +90,264 @@ func TestVerifyTestMain(t *testing.T) {
 	assert.Equal(t, 0, <-exitCode, "Expect no errors without leaks")
 	assert.NotContains(t, <-stderr, "goleak: Errors", "No errors on successful run without leaks")
 }
+
+func TestVerifyTestMainLeakExitCode(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	blocked := startBlockedG()
+	VerifyTestMain(dummyTestMain(7), LeakExitCode(3))
+	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	assert.NotContains(t, <-stderr, "goleak: Errors", "Ignore leaks on unsuccessful runs")
+
+	VerifyTestMain(dummyTestMain(0), LeakExitCode(3))
+	assert.Equal(t, 3, <-exitCode, "Expect custom exit code due to leaks on successful runs")
+	assert.Contains(t, <-stderr, "goleak: Errors", "Find leaks on successful runs")
+
+	blocked.unblock()
+	VerifyTestMain(dummyTestMain(0), LeakExitCode(3))
+	assert.Equal(t, 0, <-exitCode, "Expect no errors without leaks")
+	assert.NotContains(t, <-stderr, "goleak: Errors", "No errors on successful run without leaks")
+}
+
+func TestVerifyTestMainVerifyOnFailure(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	blocked := startBlockedG()
+	VerifyTestMain(dummyTestMain(7), VerifyOnFailure(), LeakExitCode(3))
+	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	assert.Contains(t, <-stderr, "goleak: Errors on failed test run", "Find leaks on unsuccessful runs")
+
+	VerifyTestMain(dummyTestMain(0), VerifyOnFailure(), LeakExitCode(3))
+	assert.Equal(t, 3, <-exitCode, "Expect custom exit code due to leaks on successful runs")
+	assert.Contains(t, <-stderr, "goleak: Errors on successful test run", "Find leaks on successful runs")
+
+	blocked.unblock()
+	VerifyTestMain(dummyTestMain(7), VerifyOnFailure())
+	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	assert.NotContains(t, <-stderr, "goleak: Errors", "No errors on unsuccessful run without leaks")
+}
+
+func TestVerifyTestMainWarnOnly(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	blocked := startBlockedG()
+	defer blocked.unblock()
+	VerifyTestMain(dummyTestMain(0), WarnOnly(), LeakExitCode(3))
+	assert.Equal(t, 0, <-exitCode, "Exit code should not be modified in warn-only mode")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: Warning: leaks on successful test run: found unexpected goroutines")
+	assert.NotContains(t, out, "goleak: Errors")
+
+	VerifyTestMain(dummyTestMain(7), WarnOnly(), VerifyOnFailure())
+	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	assert.Contains(t, <-stderr, "goleak: Warning: leaks on failed test run")
+}
+
+func TestVerifyTestMainReportTo(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	var report bytes.Buffer
+	blocked := startBlockedG()
+	defer blocked.unblock()
+	VerifyTestMain(dummyTestMain(0), ReportTo(&report))
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks on successful runs")
+	assert.Empty(t, <-stderr, "Leaks should not be written to stderr")
+	assert.Contains(t, report.String(), "goleak: Errors on successful test run: found unexpected goroutines")
+	assert.Contains(t, report.String(), "blockedG")
+}
+
+func TestVerifyTestMainRunningWarn(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	var report bytes.Buffer
+	bg := startBusyG()
+	defer bg.stop()
+	VerifyTestMain(dummyTestMain(0), HandleRunning(RunningWarn), ReportTo(&report))
+	assert.Equal(t, 0, <-exitCode, "Exit code should not be modified for goroutines that are still running")
+	assert.Empty(t, <-stderr, "Warnings should not be written to stderr")
+	assert.Contains(t, report.String(), "goleak: Warning: found goroutines that are still running after")
+	assert.Contains(t, report.String(), "busyG")
+}
+
+func TestVerifyTestMainOnExit(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	var (
+		gotCode int
+		gotErr  error
+	)
+	onExit := OnExit(func(code int, err error) {
+		gotCode, gotErr = code, err
+	})
+
+	blocked := startBlockedG()
+	VerifyTestMain(dummyTestMain(0), onExit, LeakExitCode(3))
+	assert.Equal(t, 3, <-exitCode, "Expect custom exit code due to leaks on successful runs")
+	<-stderr
+	assert.Equal(t, 3, gotCode, "OnExit should get the exit code")
+	var leakErr *LeakError
+	require.True(t, errors.As(gotErr, &leakErr), "OnExit should get a *LeakError, got %v", gotErr)
+	assert.NotEmpty(t, leakErr.Stacks())
+
+	before := threadCount{os: 6, goRuntime: 5}
+	defer stubThreadCounts(before, threadCount{os: 8, goRuntime: 6})()
+	VerifyTestMain(dummyTestMain(0), onExit, CheckThreads(), testOptions())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks on successful runs")
+	<-stderr
+	require.Error(t, gotErr, "OnExit should get the leaks")
+	assert.Contains(t, gotErr.Error(), "found unexpected goroutines")
+	assert.Contains(t, gotErr.Error(), "found 1 unexpected OS thread", "OnExit should get every kind of leak")
+	require.True(t, errors.As(gotErr, &leakErr), "OnExit should get a *LeakError, got %v", gotErr)
+
+	blocked.unblock()
+	VerifyTestMain(dummyTestMain(7), onExit)
+	assert.Equal(t, 7, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	<-stderr
+	assert.Equal(t, 7, gotCode, "OnExit should get the exit code")
+	assert.NoError(t, gotErr, "OnExit should not get an error without leaks")
+}
+
+func TestVerifyTestMainAttributeTests(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	done := make(chan struct{})
+	defer close(done)
+	VerifyTestMain(funcTestMain(func() int {
+		go func() { <-done }()
+		return 0
+	}), AttributeTests(), testOptions())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks started by the tests")
+	assert.Contains(t, <-stderr, "(started by TestVerifyTestMainAttributeTests) Goroutine")
+}
+
+func TestVerifyTestMainCheckFDs(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	if runtime.GOOS != "linux" {
+		VerifyTestMain(dummyTestMain(0), CheckFDs())
+		assert.Equal(t, 0, <-exitCode, "Expect no errors when file descriptors can't be listed")
+		assert.Contains(t, <-stderr, "goleak: Skipping file descriptor check")
+		return
+	}
+
+	path := filepath.Join(t.TempDir(), "leaked.txt")
+	var leaked *os.File
+	VerifyTestMain(funcTestMain(func() int {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		leaked = f
+		return 0
+	}), CheckFDs())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to file descriptors opened by the tests")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: Errors on successful test run: found unexpected open file descriptors:")
+	assert.Contains(t, out, fmt.Sprintf("fd %v: %v", leaked.Fd(), path))
+	require.NoError(t, leaked.Close())
+
+	VerifyTestMain(funcTestMain(func() int {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+		return 0
+	}), CheckFDs(), LeakExitCode(3))
+	assert.Equal(t, 0, <-exitCode, "Expect no errors for file descriptors closed by the tests")
+	assert.Empty(t, <-stderr)
+
+	VerifyTestMain(funcTestMain(func() int {
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		leaked = f
+		return 2
+	}), CheckFDs())
+	assert.Equal(t, 2, <-exitCode, "Exit code should not be modified on unsuccessful runs")
+	assert.NotContains(t, <-stderr, "goleak: Errors", "Ignore leaks on unsuccessful runs")
+	require.NoError(t, leaked.Close())
+}
+
+func TestVerifyTestMainCheckThreads(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	before := threadCount{os: 6, goRuntime: 5}
+	defer stubThreadCounts(before, threadCount{os: 8, goRuntime: 6})()
+	VerifyTestMain(dummyTestMain(0), CheckThreads(), testOptions())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to threads started by the tests")
+	assert.Contains(t, <-stderr, "goleak: Errors on successful test run: found 1 unexpected OS thread")
+
+	defer stubThreadCounts(before, threadCount{os: 8, goRuntime: 7})()
+	VerifyTestMain(dummyTestMain(0), CheckThreads(), testOptions())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors for threads started by the runtime")
+	assert.Empty(t, <-stderr)
+
+	_threadCounts = func() (threadCount, error) {
+		return threadCount{}, errors.New("great sadness")
+	}
+	VerifyTestMain(dummyTestMain(0), CheckThreads())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors when threads can't be counted")
+	assert.Contains(t, <-stderr, "goleak: Skipping thread check: great sadness")
+}
+
+func TestVerifyTestMainCheckHandles(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	before := handleCount{os: 100, goRuntimeThreads: 5}
+	defer stubHandleCounts(before, handleCount{os: 102, goRuntimeThreads: 5})()
+	VerifyTestMain(dummyTestMain(0), CheckHandles(), testOptions())
+	assert.Equal(t, 1, <-exitCode, "Expect error due to handles opened by the tests")
+	assert.Contains(t, <-stderr, "goleak: Errors on successful test run: found 2 unexpected open handles")
+
+	defer stubHandleCounts(before, handleCount{os: 100 + _handlesPerRuntimeThread, goRuntimeThreads: 6})()
+	VerifyTestMain(dummyTestMain(0), CheckHandles(), testOptions())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors for handles of threads started by the runtime")
+	assert.Empty(t, <-stderr)
+
+	_handleCounts = func() (handleCount, error) {
+		return handleCount{}, errors.New("great sadness")
+	}
+	VerifyTestMain(dummyTestMain(0), CheckHandles())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors when handles can't be counted")
+	assert.Contains(t, <-stderr, "goleak: Skipping handle check: great sadness")
+}
+
+func TestVerifyTestMainIgnoreBeforeTestMain(t *testing.T) {
+	defer clearOSStubs()
+	exitCode, stderr := osStubs()
+
+	// Make sure the goroutine is blocked, so it has the same signature
+	// before and after the tests.
+	initG := startBlockedG()
+	getStableAll(t, stack.Current())
+
+	var restarted *blockedG
+	VerifyTestMain(funcTestMain(func() int {
+		// Restart the goroutine with a new ID.
+		initG.unblock()
+		restarted = startBlockedG()
+		getStableAll(t, stack.Current())
+		return 0
+	}), IgnoreBeforeTestMain())
+	assert.Equal(t, 0, <-exitCode, "Expect no errors for goroutines running before the tests")
+	assert.NotContains(t, <-stderr, "goleak: Errors", "No errors for goroutines running before the tests")
+
+	done := make(chan struct{})
+	VerifyTestMain(funcTestMain(func() int {
+		go func() { <-done }()
+		return 0
+	}), IgnoreBeforeTestMain(), testOptions())
+	close(done)
+	assert.Equal(t, 1, <-exitCode, "Expect error due to leaks started by the tests")
+	out := <-stderr
+	assert.Contains(t, out, "goleak: Errors", "Find leaks started by the tests")
+	assert.NotContains(t, out, "blockedG", "Goroutines running before the tests should be ignored")
+
+	restarted.unblock()
+}
@@ -0,0 +1,135 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Variables for stubbing in unit tests.
+var _threadCounts = threadCounts
+
+// threadCount is the number of OS threads of the process.
+type threadCount struct {
+	// os is the number of threads reported by the OS.
+	os int
+
+	// goRuntime is the number of those threads started by the Go runtime.
+	goRuntime int
+
+	// names counts the threads by name, where the OS reports names. Threads
+	// are named after the process unless they're renamed, e.g., by C code
+	// using pthread_setname_np, and process is the name of the process.
+	names   map[string]int
+	process string
+}
+
+// foreign returns the number of threads that were not started by the Go
+// runtime, such as by C code called using cgo, excluding threads with the
+// names to ignore.
+func (c threadCount) foreign(opts *opts) int {
+	n := c.os - c.goRuntime
+	for _, name := range opts.ignoreThreadNames {
+		n -= c.names[name]
+	}
+	return n
+}
+
+// threadLeaks describes the threads not started by the Go runtime that
+// were found by findThreadLeaks.
+type threadLeaks struct {
+	count int
+
+	// names counts the new threads by name, excluding threads named after
+	// the process, which include the threads started by the Go runtime.
+	names map[string]int
+}
+
+// findThreadLeaks returns the threads that were not started by the Go
+// runtime, beyond those counted in before, retrying as specified by opts
+// to allow threads that are exiting to finish.
+func findThreadLeaks(before threadCount, opts *opts) (threadLeaks, error) {
+	var deadline time.Time
+	if opts.totalBudget > 0 {
+		deadline = opts.clock.Now().Add(opts.totalBudget)
+	}
+
+	for i := 0; ; i++ {
+		after, err := _threadCounts()
+		if err != nil {
+			return threadLeaks{}, err
+		}
+		leaked := after.foreign(opts) - before.foreign(opts)
+		if leaked <= 0 || !opts.retry(i, deadline) {
+			return threadLeaks{count: leaked, names: newThreadNames(before, after, opts)}, nil
+		}
+	}
+}
+
+// newThreadNames counts the threads by name that were started after before,
+// excluding threads named after the process and threads with the names to
+// ignore.
+func newThreadNames(before, after threadCount, opts *opts) map[string]int {
+	ignored := make(map[string]bool, len(opts.ignoreThreadNames))
+	for _, name := range opts.ignoreThreadNames {
+		ignored[name] = true
+	}
+
+	var names map[string]int
+	for name, n := range after.names {
+		if n -= before.names[name]; n <= 0 || name == after.process || ignored[name] {
+			continue
+		}
+		if names == nil {
+			names = make(map[string]int)
+		}
+		names[name] = n
+	}
+	return names
+}
+
+// threadLeakError returns the error reported by VerifyTestMain for the given
+// leaked threads.
+func threadLeakError(leaks threadLeaks) error {
+	msg := fmt.Sprintf("found %v not started by the Go runtime, e.g., by cgo", pluralize(leaks.count, "unexpected OS thread"))
+	if len(leaks.names) == 0 {
+		return errors.New(msg)
+	}
+
+	names := make([]string, 0, len(leaks.names))
+	for name := range leaks.names {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if n := leaks.names[name]; n > 1 {
+			names[i] = fmt.Sprintf("%q (%v)", name, n)
+		} else {
+			names[i] = strconv.Quote(name)
+		}
+	}
+	return fmt.Errorf("%v, including new threads named %v", msg, strings.Join(names, ", "))
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build linux
+// +build linux
+
+package goleak
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+)
+
+// threadCounts counts the threads of the process using /proc.
+func threadCounts() (threadCount, error) {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return threadCount{}, fmt.Errorf("failed to list threads: %v", err)
+	}
+	// Threads started by the runtime while the tasks are listed are counted
+	// here, but not in tasks, so they can't be mistaken for foreign threads.
+	goRuntime := pprof.Lookup("threadcreate").Count()
+
+	c := threadCount{
+		os:        len(tasks),
+		goRuntime: goRuntime,
+		names:     make(map[string]int, len(tasks)),
+		process:   readThreadName("/proc/self/comm"),
+	}
+	for _, task := range tasks {
+		// Threads that exit while the tasks are listed have no name.
+		if name := readThreadName(filepath.Join("/proc/self/task", task.Name(), "comm")); name != "" {
+			c.names[name]++
+		}
+	}
+	return c, nil
+}
+
+// readThreadName reads the name of a thread from the given comm file in /proc,
+// returning an empty name if it can't be read.
+func readThreadName(path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(string(b), "\n")
+}
@@ -0,0 +1,133 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubThreadCounts makes _threadCounts return the given counts in order,
+// repeating the last one, and returns a function to undo the stub.
+func stubThreadCounts(counts ...threadCount) func() {
+	orig := _threadCounts
+	_threadCounts = func() (threadCount, error) {
+		c := counts[0]
+		if len(counts) > 1 {
+			counts = counts[1:]
+		}
+		return c, nil
+	}
+	return func() { _threadCounts = orig }
+}
+
+func TestThreadCounts(t *testing.T) {
+	c, err := threadCounts()
+	if runtime.GOOS != "linux" {
+		require.Error(t, err, "Expected thread counts to be unsupported")
+		return
+	}
+	require.NoError(t, err)
+	assert.NotZero(t, c.os, "Expected threads to be listed")
+	assert.NotZero(t, c.goRuntime, "Expected threads started by the runtime")
+	assert.NotEmpty(t, c.process, "Expected the name of the process")
+	assert.NotZero(t, c.names[c.process], "Expected threads named after the process")
+}
+
+func TestFindThreadLeaks(t *testing.T) {
+	before := threadCount{os: 6, goRuntime: 5}
+
+	t.Run("no leaks", func(t *testing.T) {
+		// More threads started by the runtime are not leaks.
+		defer stubThreadCounts(threadCount{os: 10, goRuntime: 9})()
+		leaked, err := findThreadLeaks(before, buildOpts(WithClock(newFakeClock())))
+		require.NoError(t, err)
+		assert.Equal(t, 0, leaked.count)
+	})
+
+	t.Run("leaks", func(t *testing.T) {
+		defer stubThreadCounts(threadCount{os: 8, goRuntime: 5})()
+		clock := newFakeClock()
+		leaked, err := findThreadLeaks(before, buildOpts(WithClock(clock), MaxRetries(3)))
+		require.NoError(t, err)
+		assert.Equal(t, 2, leaked.count)
+		assert.Len(t, clock.sleeps, 3, "Expected retries before reporting leaks")
+	})
+
+	t.Run("names", func(t *testing.T) {
+		before := threadCount{os: 6, goRuntime: 5, names: map[string]int{"test": 5, "worker": 1}, process: "test"}
+		defer stubThreadCounts(threadCount{
+			os:        11,
+			goRuntime: 6,
+			names:     map[string]int{"test": 6, "worker": 3, "timer": 1, "poller": 1},
+			process:   "test",
+		})()
+
+		leaked, err := findThreadLeaks(before, buildOpts(WithClock(newFakeClock()), MaxRetries(0)))
+		require.NoError(t, err)
+		assert.Equal(t, 4, leaked.count)
+		assert.Equal(t, map[string]int{"worker": 2, "timer": 1, "poller": 1}, leaked.names,
+			"Expected names of new threads, except those named after the process")
+
+		leaked, err = findThreadLeaks(before, buildOpts(WithClock(newFakeClock()), MaxRetries(0), IgnoreThreadNames("worker", "timer")))
+		require.NoError(t, err)
+		assert.Equal(t, 1, leaked.count, "Expected threads with ignored names to be ignored")
+		assert.Equal(t, map[string]int{"poller": 1}, leaked.names)
+
+		leaked, err = findThreadLeaks(before, buildOpts(WithClock(newFakeClock()), IgnoreThreadNames("worker"), IgnoreThreadNames("timer", "poller")))
+		require.NoError(t, err)
+		assert.Equal(t, 0, leaked.count, "Expected all threads with ignored names to be ignored")
+	})
+
+	t.Run("retries until threads exit", func(t *testing.T) {
+		defer stubThreadCounts(
+			threadCount{os: 8, goRuntime: 5},
+			threadCount{os: 7, goRuntime: 5},
+			threadCount{os: 6, goRuntime: 5},
+		)()
+		clock := newFakeClock()
+		leaked, err := findThreadLeaks(before, buildOpts(WithClock(clock)))
+		require.NoError(t, err)
+		assert.Equal(t, 0, leaked.count)
+		assert.Len(t, clock.sleeps, 2)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		orig := _threadCounts
+		defer func() { _threadCounts = orig }()
+		_threadCounts = func() (threadCount, error) {
+			return threadCount{}, errors.New("great sadness")
+		}
+		_, err := findThreadLeaks(before, buildOpts())
+		assert.EqualError(t, err, "great sadness")
+	})
+}
+
+func TestThreadLeakError(t *testing.T) {
+	assert.EqualError(t, threadLeakError(threadLeaks{count: 1}), "found 1 unexpected OS thread not started by the Go runtime, e.g., by cgo")
+	assert.EqualError(t, threadLeakError(threadLeaks{count: 2}), "found 2 unexpected OS threads not started by the Go runtime, e.g., by cgo")
+	assert.EqualError(t, threadLeakError(threadLeaks{count: 3, names: map[string]int{"worker": 2, "timer": 1}}),
+		`found 3 unexpected OS threads not started by the Go runtime, e.g., by cgo, including new threads named "timer", "worker" (2)`)
+}
@@ -0,0 +1,41 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import "go.uber.org/goleak/stack"
+
+// timerNote returns a note for a leaked goroutine that is sleeping or running
+// a timer callback, or an empty string if it isn't.
+//
+// Goroutines waiting on the channel of a time.Timer or time.Ticker are
+// reported by the runtime like those waiting on any other channel, and the
+// runtime doesn't report the number of timers, so only timers that are
+// visible in the stack are noted.
+func timerNote(s stack.Stack) string {
+	switch {
+	case s.BaseState() == "sleep":
+		// The runtime reports goroutines in time.Sleep in the sleep state.
+		return "sleeping in time.Sleep, stop a time.Timer or cancel a context instead"
+	case s.CreatedBy().Function == "time.goFunc":
+		return "running a time.AfterFunc callback"
+	}
+	return ""
+}
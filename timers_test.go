@@ -0,0 +1,105 @@
+// Copyright (c) 2026 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package goleak
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
+)
+
+func TestTimerNote(t *testing.T) {
+	tests := []struct {
+		msg  string
+		dump string
+		want string
+	}{
+		{
+			msg: "sleep",
+			dump: `goroutine 6 [sleep]:
+time.Sleep(0x34630b8a000)
+	/usr/local/go/src/runtime/time.go:368 +0x165
+created by main.main in goroutine 1
+	/path/to/main.go:10 +0x1e
+`,
+			want: "sleeping in time.Sleep",
+		},
+		{
+			msg: "AfterFunc callback",
+			dump: `goroutine 8 [chan receive]:
+main.callback()
+	/path/to/main.go:20 +0x1f
+created by time.goFunc
+	/usr/local/go/src/time/sleep.go:215 +0x2d
+`,
+			want: "running a time.AfterFunc callback",
+		},
+		{
+			msg: "timer channel",
+			dump: `goroutine 7 [chan receive]:
+runtime.gopark(0x0?, 0x0?, 0x0?, 0x0?, 0x0?)
+	/usr/local/go/src/runtime/proc.go:435 +0xce
+runtime.chanrecv1(0x0?, 0x0?)
+	/usr/local/go/src/runtime/chan.go:664 +0x3d
+main.receive(0x0?)
+	/path/to/main.go:4 +0x1f
+created by main.main in goroutine 1
+	/path/to/main.go:10 +0x1e
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.msg, func(t *testing.T) {
+			s, err := stack.ParseStack(tt.dump)
+			require.NoError(t, err)
+			note := timerNote(s)
+			if tt.want == "" {
+				assert.Empty(t, note)
+			} else {
+				assert.Contains(t, note, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindAnnotateTimers(t *testing.T) {
+	started := make(chan struct{})
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	defer func() {
+		close(done)
+		<-exited
+	}()
+	time.AfterFunc(0, func() {
+		defer close(exited)
+		close(started)
+		<-done
+	})
+
+	<-started
+	err := Find(testOptions(), AnnotateTimers())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "running a time.AfterFunc callback")
+}
@@ -26,7 +26,7 @@ package goleak
 import (
 	"strings"
 
-	"go.uber.org/goleak/internal/stack"
+	"go.uber.org/goleak/stack"
 )
 
 func isTraceStack(s stack.Stack) bool {
@@ -23,9 +23,11 @@ package goleak
 import (
 	"runtime"
 	"strings"
+	"sync/atomic"
 	"testing"
 
-	"go.uber.org/goleak/internal/stack"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/goleak/stack"
 )
 
 type blockedG struct {
@@ -52,8 +54,36 @@ func (bg *blockedG) unblock() {
 	close(bg.wait)
 }
 
+// busyG is a goroutine that keeps running until it's stopped.
+type busyG struct {
+	stopped int32
+	done    chan struct{}
+}
+
+func startBusyG() *busyG {
+	bg := &busyG{done: make(chan struct{})}
+	started := make(chan struct{})
+	go bg.run(started)
+	<-started
+	return bg
+}
+
+func (bg *busyG) run(started chan struct{}) {
+	defer close(bg.done)
+	close(started)
+	for atomic.LoadInt32(&bg.stopped) == 0 {
+		// Yield so the goroutine stays runnable without starving others.
+		runtime.Gosched()
+	}
+}
+
+func (bg *busyG) stop() {
+	atomic.StoreInt32(&bg.stopped, 1)
+	<-bg.done
+}
+
 func getStableAll(t *testing.T, cur stack.Stack) []stack.Stack {
-	all := stack.All()
+	all := allStacks(t)
 
 	// There may be running goroutines that were just scheduled or finishing up
 	// from previous tests, so reduce flakiness by waiting till no other goroutines
@@ -68,12 +98,18 @@ func getStableAll(t *testing.T, cur stack.Stack) []stack.Stack {
 		}
 
 		runtime.Gosched()
-		all = stack.All()
+		all = allStacks(t)
 	}
 
 	return all
 }
 
+func allStacks(t *testing.T) []stack.Stack {
+	all, err := stack.All()
+	require.NoError(t, err, "failed to parse stacks")
+	return all
+}
+
 // Note: This is the same logic as in internal/stacks/stacks_test.go
 func isBackgroundRunning(cur stack.Stack, stacks []stack.Stack) bool {
 	for _, s := range stacks {